@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_environment "github.com/caigwatkin/go/environment"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_log "github.com/caigwatkin/go/log"
+	go_secrets "github.com/caigwatkin/go/secrets"
+)
+
+var (
+	auditKeyPathToFile string
+	cloudkmsKey        string
+	cloudkmsKeyRing    string
+	gcpProjectId       string
+	pathToFile         string
+	prevHash           string
+	stage              = go_environment.StageDev
+)
+
+func init() {
+	flag.StringVar(&auditKeyPathToFile, "auditKeyPathToFile", "", "Path to file of the audit log key, encrypted with the Cloud KMS key")
+	flag.StringVar(&cloudkmsKey, "cloudkmsKey", "", "Cloud KMS key to use")
+	flag.StringVar(&cloudkmsKeyRing, "cloudkmsKeyRing", "", "Cloud KMS key ring to use")
+	flag.StringVar(&gcpProjectId, "gcpProjectId", "", "GCP project ID which has Cloud KMS used for decryption")
+	flag.StringVar(&pathToFile, "pathToFile", "", "Path to audit log file to be verified")
+	flag.StringVar(&prevHash, "prevHash", "", "Optional hash of the last record of the file the audit log continues, e.g. once archived")
+	flag.Var(&stage, "stage", "Stage of deployment, one of local, dev, staging, or prod")
+	flag.Parse()
+}
+
+func main() {
+	environment, err := go_environment.New("Verify")
+	if err != nil {
+		log.Fatal("Failed generating new environment", err)
+	}
+
+	ctx := go_context.StartUp()
+
+	logClient := go_log.NewClient(ctx, go_log.Config{
+		Env:   environment,
+		Fatal: go_log.FatalPolicyExit,
+	})
+	defer logClient.Close(go_context.ShutDown())
+
+	logClient.Info(ctx, "Starting",
+		go_log.FmtString(auditKeyPathToFile, "auditKeyPathToFile"),
+		go_log.FmtString(cloudkmsKey, "cloudkmsKey"),
+		go_log.FmtString(cloudkmsKeyRing, "cloudkmsKeyRing"),
+		go_log.FmtString(gcpProjectId, "gcpProjectId"),
+		go_log.FmtString(pathToFile, "pathToFile"),
+		go_log.FmtString(prevHash, "prevHash"),
+		go_log.FmtString(string(stage), "stage"),
+	)
+
+	logClient.Info(ctx, "Checking required flags")
+	if err := checkRequiredFlags(); err != nil {
+		logClient.Fatal(ctx, "Failed flag check", go_log.FmtError(err))
+	}
+	logClient.Info(ctx, "Passed flag check")
+
+	secretsClient, err := go_secrets.NewClient(ctx, go_secrets.Config{
+		CloudkmsKey:     cloudkmsKey,
+		CloudkmsKeyRing: cloudkmsKeyRing,
+		Stage:           stage,
+		GcpProjectId:    gcpProjectId,
+	}, logClient)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed creating secrets client", go_log.FmtError(err))
+	}
+	secret, err := secretsClient.SecretFromFile(auditKeyPathToFile)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed reading audit key from file", go_log.FmtError(err))
+	}
+	key, err := secretsClient.Decrypt(*secret)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed decrypting audit key", go_log.FmtError(err))
+	}
+
+	f, err := os.Open(pathToFile)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed opening audit log", go_log.FmtError(err))
+	}
+	defer f.Close()
+
+	last, err := go_log.VerifyAudit(f, key, prevHash)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed verifying audit log", go_log.FmtError(err), go_log.FmtAny(last, "lastVerified"))
+	}
+	if last == nil {
+		logClient.Notice(ctx, "Verified empty audit log")
+		return
+	}
+	logClient.Notice(ctx, "Verified audit log",
+		go_log.FmtUint64(last.Seq, "lastSeq"),
+		go_log.FmtString(last.Hash, "lastHash"),
+		go_log.FmtTime(last.Time, "lastTime"),
+	)
+}
+
+func checkRequiredFlags() error {
+	if pathToFile == "" {
+		return go_errors.New("Missing `pathToFile` flag value")
+	} else if auditKeyPathToFile == "" {
+		return go_errors.New("Missing `auditKeyPathToFile` flag value")
+	} else if gcpProjectId == "" {
+		return go_errors.New("Missing `gcpProjectId` flag value")
+	} else if cloudkmsKey == "" {
+		return go_errors.New("Missing `cloudkmsKey` flag value")
+	} else if cloudkmsKeyRing == "" {
+		return go_errors.New("Missing `cloudkmsKeyRing` flag value")
+	}
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
 
 	go_context "github.com/caigwatkin/go/context"
@@ -33,22 +34,26 @@ import (
 )
 
 var (
+	auditLog           string
+	auditKeyPathToFile string
 	ciphertext         string
 	cloudkmsKey        string
 	cloudkmsKeyRing    string
-	env                string
 	gcpProjectId       string
 	pathToFile         string
 	saveAsFileType     string
 	saveAsSecretType   string
 	saveAsSecretDomain string
+	stage              = go_environment.StageDev
 )
 
 func init() {
+	flag.StringVar(&auditLog, "auditLog", "", "Optional path to audit log file to record the decryption in")
+	flag.StringVar(&auditKeyPathToFile, "auditKeyPathToFile", "", "Path to file of the audit log key, encrypted with the Cloud KMS key. Required if `auditLog` given")
 	flag.StringVar(&ciphertext, "ciphertext", "", "Ciphertext to be decrypted. Required if no `pathToFile` given")
 	flag.StringVar(&cloudkmsKey, "cloudkmsKey", "", "Cloud KMS key to use")
 	flag.StringVar(&cloudkmsKeyRing, "cloudkmsKeyRing", "", "Cloud KMS key ring to use")
-	flag.StringVar(&env, "env", "dev", "Friendly environment name, used for file naming")
+	flag.Var(&stage, "stage", "Stage of deployment, used for file naming, one of local, dev, staging, or prod")
 	flag.StringVar(&pathToFile, "pathToFile", "", "Path to file to be decrypted. Required if no `ciphertext` given")
 	flag.StringVar(&gcpProjectId, "gcpProjectId", "", "GCP project ID which has Cloud KMS used for decryption")
 	flag.StringVar(&saveAsFileType, "saveAsFileType", "json", "Optional file type to use as file name for saving")
@@ -58,7 +63,7 @@ func init() {
 }
 
 func main() {
-	osEnviron := os.Environ()
+	osEnviron := go_environment.Environ()
 	log.Println("Starting", osEnviron)
 
 	environment, err := go_environment.New("Decrypt")
@@ -69,12 +74,18 @@ func main() {
 	ctx := go_context.StartUp()
 
 	logClient := go_log.NewClient(ctx, go_log.Config{
-		Env: environment,
+		Env:   environment,
+		Fatal: go_log.FatalPolicyExit,
 	})
+	defer logClient.Close(go_context.ShutDown())
+	defer go_log.RedirectStdLog(ctx, logClient, go_log.SeverityInfo)()
+	logClient.Info(ctx, "Generated environment", go_log.FmtAny(environment, "environment"))
 
 	logClient.Info(ctx, "Starting",
+		go_log.FmtString(auditLog, "auditLog"),
+		go_log.FmtString(auditKeyPathToFile, "auditKeyPathToFile"),
 		go_log.FmtString(ciphertext, "ciphertext"),
-		go_log.FmtString(env, "env"),
+		go_log.FmtString(string(stage), "stage"),
 		go_log.FmtString(pathToFile, "pathToFile"),
 		go_log.FmtString(gcpProjectId, "gcpProjectId"),
 		go_log.FmtString(cloudkmsKey, "cloudkmsKey"),
@@ -93,23 +104,57 @@ func main() {
 	secretsClient, err := go_secrets.NewClient(ctx, go_secrets.Config{
 		CloudkmsKey:     cloudkmsKey,
 		CloudkmsKeyRing: cloudkmsKeyRing,
-		Env:             env,
+		Stage:           stage,
 		GcpProjectId:    gcpProjectId,
 	}, logClient)
 	if err != nil {
 		logClient.Fatal(ctx, "Failed creating secrets client", go_log.FmtError(err))
 	}
 
-	decrypt(ctx, logClient, secretsClient)
+	var auditLogger go_log.AuditLogger
+	if auditLog != "" {
+		key, err := auditKey(secretsClient)
+		if err != nil {
+			logClient.Fatal(ctx, "Failed decrypting audit key", go_log.FmtError(err))
+		}
+		auditLogger, err = go_log.NewAuditLogger(go_log.AuditConfig{
+			Key:  key,
+			Path: auditLog,
+		})
+		if err != nil {
+			logClient.Fatal(ctx, "Failed creating audit logger", go_log.FmtError(err))
+		}
+		defer auditLogger.Close()
+		ctx = go_context.WithActor(ctx, actor())
+	}
+
+	decrypt(ctx, logClient, secretsClient, auditLogger)
+}
+
+// auditKey of the audit log, decrypted from its file
+func auditKey(secretsClient go_secrets.Client) ([]byte, error) {
+	secret, err := secretsClient.SecretFromFile(auditKeyPathToFile)
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed reading audit key from file")
+	}
+	return secretsClient.Decrypt(*secret)
+}
+
+// actor running the tool, for the audit log
+func actor() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
 }
 
 func checkRequiredFlags() error {
 	if (ciphertext != "") == (pathToFile != "") {
 		return go_errors.New("Either `ciphertext` or `pathToFile` flag values must be provided, not both")
+	} else if auditLog != "" && auditKeyPathToFile == "" {
+		return go_errors.New("Missing `auditKeyPathToFile` flag value, required if `auditLog` flag value provided")
 	} else if (saveAsSecretDomain != "") != (saveAsSecretType != "") {
 		return go_errors.New("Both or neither `saveAsSecretDomain` and `saveAsSecretType` flag values must be provided")
-	} else if env == "" {
-		return go_errors.New("Missing `env` flag value")
 	} else if gcpProjectId == "" {
 		return go_errors.New("Missing `gcpProjectId` flag value")
 	} else if cloudkmsKey == "" {
@@ -120,7 +165,7 @@ func checkRequiredFlags() error {
 	return nil
 }
 
-func decrypt(ctx context.Context, logClient go_log.Client, secretsClient go_secrets.Client) {
+func decrypt(ctx context.Context, logClient go_log.Client, secretsClient go_secrets.Client, auditLogger go_log.AuditLogger) {
 	secret := go_secrets.Secret{
 		Ciphertext: ciphertext,
 	}
@@ -136,15 +181,30 @@ func decrypt(ctx context.Context, logClient go_log.Client, secretsClient go_secr
 	logClient.Info(ctx, "Decrypting", go_log.FmtAny(secret, "secret"))
 	plaintext, err := secretsClient.Decrypt(secret)
 	if err != nil {
+		audit(ctx, logClient, auditLogger, go_log.AuditOutcomeFailure, go_log.FmtError(err))
 		logClient.Fatal(ctx, "Failed decrypting ciphertext", go_log.FmtError(err))
 	}
-	logClient.Info(ctx, "Decrypted", go_log.FmtBytes(plaintext, "plaintext"))
+	audit(ctx, logClient, auditLogger, go_log.AuditOutcomeSuccess)
+	logClient.Info(ctx, "Decrypted", go_log.FmtSecret(plaintext, "plaintext"))
 
 	if saveAsSecretType != "" {
 		saveAs(ctx, logClient, plaintext)
 	}
 }
 
+// audit the decryption with the key, if auditing
+func audit(ctx context.Context, logClient go_log.Client, auditLogger go_log.AuditLogger, outcome go_log.AuditOutcome, details ...go_log.Field) {
+	if auditLogger == nil {
+		return
+	}
+	resource := fmt.Sprintf("projects/%s/locations/global/keyRings/%s/cryptoKeys/%s", gcpProjectId, cloudkmsKeyRing, cloudkmsKey)
+	details = append(details, go_log.FmtString(pathToFile, "pathToFile"), go_log.FmtString(string(stage), "stage"))
+	if err := auditLogger.Audit(ctx, "secrets.decrypt", resource, outcome, details...); err != nil {
+		logClient.Fatal(ctx, "Failed auditing decryption", go_log.FmtError(err))
+	}
+	logClient.Info(ctx, "Audited decryption", go_log.FmtString(auditLog, "auditLog"))
+}
+
 func saveAs(ctx context.Context, logClient go_log.Client, plaintext []byte) {
 	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
@@ -36,18 +36,18 @@ import (
 var (
 	cloudkmsKeyRing    string
 	cloudkmsKey        string
-	env                string
 	gcpProjectId       string
 	pathToFile         string
 	plaintext          []byte
 	saveAsSecretDomain string
 	saveAsSecretType   string
+	stage              = go_environment.StageDev
 )
 
 func init() {
 	flag.StringVar(&cloudkmsKey, "cloudkmsKey", "", "Cloud KMS key to use")
 	flag.StringVar(&cloudkmsKeyRing, "cloudkmsKeyRing", "", "Cloud KMS key ring to use")
-	flag.StringVar(&env, "env", "dev", "Friendly environment name, used for file naming")
+	flag.Var(&stage, "stage", "Stage of deployment, used for file naming, one of local, dev, staging, or prod")
 	flag.StringVar(&pathToFile, "pathToFile", "", "Path to file to be encrypted. Required if no `plaintext` given")
 	flag.StringVar(&gcpProjectId, "gcpProjectId", "", "GCP project ID which has Cloud KMS used for encryption")
 	var pt string
@@ -60,7 +60,7 @@ func init() {
 }
 
 func main() {
-	osEnviron := os.Environ()
+	osEnviron := go_environment.Environ()
 	log.Println("Starting", osEnviron)
 
 	environment, err := go_environment.New("Encrypt")
@@ -71,16 +71,20 @@ func main() {
 	ctx := go_context.StartUp()
 
 	logClient := go_log.NewClient(ctx, go_log.Config{
-		Env: environment,
+		Env:   environment,
+		Fatal: go_log.FatalPolicyExit,
 	})
+	defer logClient.Close(go_context.ShutDown())
+	defer go_log.RedirectStdLog(ctx, logClient, go_log.SeverityInfo)()
+	logClient.Info(ctx, "Generated environment", go_log.FmtAny(environment, "environment"))
 
 	logClient.Info(ctx, "Starting",
 		go_log.FmtString(cloudkmsKey, "cloudkmsKey"),
 		go_log.FmtString(cloudkmsKeyRing, "cloudkmsKeyRing"),
-		go_log.FmtString(env, "env"),
+		go_log.FmtString(string(stage), "stage"),
 		go_log.FmtString(pathToFile, "pathToFile"),
 		go_log.FmtString(gcpProjectId, "gcpProjectId"),
-		go_log.FmtBytes(plaintext, "plaintext"),
+		go_log.FmtSecret(plaintext, "plaintext"),
 		go_log.FmtString(saveAsSecretDomain, "saveAsSecretDomain"),
 		go_log.FmtString(saveAsSecretType, "saveAsSecretType"),
 		go_log.FmtStrings(osEnviron, "osEnviron"),
@@ -93,7 +97,7 @@ func main() {
 	logClient.Info(ctx, "Passed flag check")
 
 	secretsClient, err := go_secrets.NewClient(ctx, go_secrets.Config{
-		Env:             env,
+		Stage:           stage,
 		GcpProjectId:    gcpProjectId,
 		CloudkmsKey:     cloudkmsKey,
 		CloudkmsKeyRing: cloudkmsKeyRing,
@@ -110,8 +114,6 @@ func checkRequiredFlags() error {
 		return go_errors.New("Either `plaintext` or `pathToFile` flag values must be provided, not both")
 	} else if (saveAsSecretDomain != "") != (saveAsSecretType != "") {
 		return go_errors.New("Both or neither `saveAsSecretDomain` and `saveAsSecretType` flag values must be provided")
-	} else if env == "" {
-		return go_errors.New("Missing `env` flag value")
 	} else if gcpProjectId == "" {
 		return go_errors.New("Missing `gcpProjectId` flag value")
 	} else if cloudkmsKey == "" {
@@ -129,10 +131,10 @@ func encrypt(ctx context.Context, logClient go_log.Client, secretsClient go_secr
 			logClient.Fatal(ctx, "Failed reading file", go_log.FmtError(err))
 		}
 		plaintext = buf
-		logClient.Info(ctx, "Loaded from file", go_log.FmtBytes(plaintext, "plaintext"))
+		logClient.Info(ctx, "Loaded from file", go_log.FmtSecret(plaintext, "plaintext"))
 	}
 
-	logClient.Info(ctx, "Encrypting", go_log.FmtBytes(plaintext, "plaintext"))
+	logClient.Info(ctx, "Encrypting", go_log.FmtSecret(plaintext, "plaintext"))
 	secret, err := secretsClient.Encrypt(plaintext)
 	if err != nil {
 		logClient.Fatal(ctx, "Failed encrypting plaintext", go_log.FmtError(err))
@@ -149,7 +151,7 @@ func saveAs(ctx context.Context, logClient go_log.Client, secret go_secrets.Secr
 	if err != nil {
 		logClient.Fatal(ctx, "Failed to get directory of process", go_log.FmtError(err))
 	}
-	path := fmt.Sprintf("%s/%s_%s_cloudkms-%s.json", dir, saveAsSecretDomain, saveAsSecretType, env)
+	path := fmt.Sprintf("%s/%s_%s_cloudkms-%s.json", dir, saveAsSecretDomain, saveAsSecretType, stage)
 	b, err := json.MarshalIndent(secret, "", "\t")
 	if err != nil {
 		logClient.Fatal(ctx, "Failed to marshalling secret", go_log.FmtError(err))
@@ -0,0 +1,338 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+	go_log "github.com/caigwatkin/go/log"
+)
+
+var (
+	color         string
+	compact       bool
+	correlationId string
+	fieldFilters  fieldFlags
+	follow        string
+	group         bool
+	message       string
+	severity      string
+	since         string
+	until         string
+)
+
+func init() {
+	flag.StringVar(&color, "color", "auto", "Colouring of output, one of auto, always, or never")
+	flag.BoolVar(&compact, "compact", false, "Render entries on single lines, with fields as key=value")
+	flag.StringVar(&correlationId, "correlationId", "", "Optional correlation ID which entries must have exactly")
+	flag.Var(&fieldFilters, "field", "Optional `field=value` which entries must have, repeatable, with nested fields by dots, e.g. user.id=1")
+	flag.StringVar(&follow, "follow", "", "Optional correlation ID to follow a request by, including entries with it anywhere in their correlation chain")
+	flag.BoolVar(&group, "group", false, "Group entries by the root of their correlation chain, ordered by time within each group")
+	flag.StringVar(&message, "message", "", "Optional regular expression which messages must match")
+	flag.StringVar(&severity, "severity", "", "Optional min severity of entries, e.g. WARN")
+	flag.StringVar(&since, "since", "", "Optional time from which entries are shown, RFC3339 or a duration before now, e.g. 1h")
+	flag.StringVar(&until, "until", "", "Optional time until which entries are shown, RFC3339 or a duration before now")
+	flag.Usage = func() {
+		log.Println("Usage: logview [flags] [file ...]")
+		log.Println("Reads remote JSON logs, one entry per line, from the files or stdin")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+}
+
+// fieldFlags of field=value filters
+type fieldFlags []fieldFilter
+
+type fieldFilter struct {
+	path  []string
+	value string
+}
+
+func (f *fieldFlags) String() string {
+	values := make([]string, len(*f))
+	for i, v := range *f {
+		values[i] = strings.Join(v.path, ".") + "=" + v.value
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *fieldFlags) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return go_errors.Errorf("Invalid field filter %q, must be field=value", value)
+	}
+	*f = append(*f, fieldFilter{
+		path:  strings.Split(value[:i], "."),
+		value: value[i+1:],
+	})
+	return nil
+}
+
+func main() {
+	// Output is to stdout, so failures are logged to stderr by the stdlib's logger rather than a log client
+	f, err := newFilter(time.Now())
+	if err != nil {
+		flag.Usage()
+		log.Fatal("Failed flag check: ", err)
+	}
+
+	colorMode, err := parseColor(color)
+	if err != nil {
+		flag.Usage()
+		log.Fatal("Failed flag check: ", err)
+	}
+	v := viewer{
+		encoder: go_log.NewConsoleEncoderFor(os.Stdout, go_log.ConsoleConfig{
+			Verbose: !compact,
+			Color:   colorMode,
+		}),
+		filter: f,
+		out:    bufio.NewWriter(os.Stdout),
+	}
+	defer v.out.Flush()
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		if err := v.read(os.Stdin); err != nil {
+			v.out.Flush()
+			log.Fatal("Failed reading stdin: ", err)
+		}
+	}
+	for _, path := range paths {
+		if err := v.readFile(path); err != nil {
+			v.out.Flush()
+			log.Fatalf("Failed reading file %s: %v", path, err)
+		}
+	}
+	v.flush()
+}
+
+func parseColor(s string) (go_log.ColorMode, error) {
+	switch s {
+	case "auto":
+		return go_log.ColorAuto, nil
+	case "always":
+		return go_log.ColorAlways, nil
+	case "never":
+		return go_log.ColorNever, nil
+	}
+	return 0, go_errors.Errorf("Invalid color %q, must be one of auto, always, or never", s)
+}
+
+// filter of entries by the flags
+type filter struct {
+	message  *regexp.Regexp
+	severity go_log.Severity
+	since    time.Time
+	until    time.Time
+	active   bool // If any filter is set, in which case lines which are not entries are not shown
+}
+
+func newFilter(now time.Time) (filter, error) {
+	f := filter{
+		active: severity != "" || message != "" || since != "" || until != "" || correlationId != "" || follow != "" || len(fieldFilters) > 0,
+	}
+	if severity != "" {
+		s, err := go_log.ParseSeverity(severity)
+		if err != nil {
+			return f, err
+		}
+		f.severity = s
+	}
+	if message != "" {
+		r, err := regexp.Compile(message)
+		if err != nil {
+			return f, go_errors.Wrap(err, "Invalid `message` flag value")
+		}
+		f.message = r
+	}
+	var err error
+	if f.since, err = parseTime(since, now); err != nil {
+		return f, go_errors.Wrap(err, "Invalid `since` flag value")
+	}
+	if f.until, err = parseTime(until, now); err != nil {
+		return f, go_errors.Wrap(err, "Invalid `until` flag value")
+	}
+	return f, nil
+}
+
+// parseTime as RFC3339, or a duration before now, zero if empty
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return t, go_errors.Errorf("Invalid time %q, must be RFC3339 or a duration, e.g. 1h", s)
+	}
+	return t, nil
+}
+
+func (f filter) match(e go_log.Entry) bool {
+	switch {
+	case e.Severity < f.severity:
+		return false
+	case f.message != nil && !f.message.MatchString(e.Message):
+		return false
+	case !f.since.IsZero() && e.Time.Before(f.since):
+		return false
+	case !f.until.IsZero() && e.Time.After(f.until):
+		return false
+	case correlationId != "" && e.CorrelationId != correlationId:
+		return false
+	case follow != "" && !inChain(e.CorrelationId, follow):
+		return false
+	}
+	for _, v := range fieldFilters {
+		if !matchField(e.Fields, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// inChain of correlation IDs, each appended to those of the contexts it was created from, see go_context.New
+func inChain(chain, correlationId string) bool {
+	for _, v := range strings.Split(chain, ",") {
+		if v == correlationId {
+			return true
+		}
+	}
+	return false
+}
+
+// root of the correlation chain, the ID of the context all of the chain was created from
+func root(chain string) string {
+	return chain[strings.LastIndex(chain, ",")+1:]
+}
+
+// matchField of the entry, comparing strings unquoted and other values as JSON
+func matchField(fields []go_log.Field, f fieldFilter) bool {
+	for _, v := range fields {
+		if v.Key() != f.path[0] {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(v.Value().(json.RawMessage), &value); err != nil {
+			return false
+		}
+		for _, k := range f.path[1:] {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if value, ok = object[k]; !ok {
+				return false
+			}
+		}
+		if s, ok := value.(string); ok {
+			return s == f.value
+		}
+		blob, err := json.Marshal(value)
+		return err == nil && string(blob) == f.value
+	}
+	return false
+}
+
+// viewer rendering entries read, or holding them to render as groups
+type viewer struct {
+	encoder go_log.Encoder
+	filter  filter
+	groups  map[string][]go_log.Entry
+	order   []string // Of groups, by their first entry read
+	out     *bufio.Writer
+}
+
+func (v *viewer) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed opening file")
+	}
+	defer f.Close()
+	return v.read(f)
+}
+
+func (v *viewer) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 10<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		e, err := go_log.ParseJSONEntry(line)
+		if err != nil {
+			if !v.filter.active && !group {
+				v.out.Write(line)
+				v.out.WriteByte('\n')
+			}
+			continue
+		}
+		if v.filter.match(e) {
+			v.view(e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return go_errors.Wrap(err, "Failed scanning lines")
+	}
+	return nil
+}
+
+func (v *viewer) view(e go_log.Entry) {
+	if !group {
+		v.out.WriteString(v.encoder.Encode(e))
+		v.out.WriteByte('\n')
+		return
+	}
+	if v.groups == nil {
+		v.groups = make(map[string][]go_log.Entry)
+	}
+	r := root(e.CorrelationId)
+	if _, ok := v.groups[r]; !ok {
+		v.order = append(v.order, r)
+	}
+	v.groups[r] = append(v.groups[r], e)
+}
+
+// flush groups, if grouping
+func (v *viewer) flush() {
+	for i, r := range v.order {
+		entries := v.groups[r]
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Time.Before(entries[j].Time)
+		})
+		if i > 0 {
+			v.out.WriteByte('\n')
+		}
+		fmt.Fprintf(v.out, "=== %s\n", r)
+		for _, e := range entries {
+			v.out.WriteString(v.encoder.Encode(e))
+			v.out.WriteByte('\n')
+		}
+	}
+}
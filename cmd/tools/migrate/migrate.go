@@ -0,0 +1,199 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_database "github.com/caigwatkin/go/database"
+	go_migrate "github.com/caigwatkin/go/database/migrate"
+	go_environment "github.com/caigwatkin/go/environment"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_log "github.com/caigwatkin/go/log"
+	_ "github.com/go-sql-driver/mysql" // Registers driver for go_database.SchemeMySQL
+	_ "github.com/lib/pq"              // Registers driver for go_database.SchemePostgres
+)
+
+var (
+	dir    string
+	dryRun bool
+	table  string
+)
+
+func init() {
+	flag.StringVar(&dir, "dir", "migrations", "Directory of migration files")
+	flag.BoolVar(&dryRun, "dryRun", false, "Log the migrations that would run without running them")
+	flag.StringVar(&table, "table", "", "Optional table recording applied versions, defaults to schema_migrations")
+	flag.Usage = func() {
+		log.Println("Usage: migrate [flags] up | down N | status | create NAME")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+}
+
+func main() {
+	environment, err := go_environment.New("Migrate")
+	if err != nil {
+		log.Fatal("Failed generating new environment", err)
+	}
+
+	ctx := go_context.StartUp()
+
+	logClient := go_log.NewClient(ctx, go_log.Config{
+		Env:   environment,
+		Fatal: go_log.FatalPolicyExit,
+	})
+	defer logClient.Close(go_context.ShutDown())
+	defer go_log.RedirectStdLog(ctx, logClient, go_log.SeverityInfo)()
+	logClient.Info(ctx, "Generated environment", go_log.FmtAny(environment, "environment"))
+
+	args := flag.Args()
+	logClient.Info(ctx, "Starting",
+		go_log.FmtString(dir, "dir"),
+		go_log.FmtBool(dryRun, "dryRun"),
+		go_log.FmtString(table, "table"),
+		go_log.FmtStrings(args, "args"),
+	)
+
+	logClient.Info(ctx, "Checking args")
+	if err := checkArgs(args); err != nil {
+		flag.Usage()
+		logClient.Fatal(ctx, "Failed args check", go_log.FmtError(err))
+	}
+	logClient.Info(ctx, "Passed args check")
+
+	if args[0] == "create" {
+		create(ctx, logClient, args[1])
+		return
+	}
+
+	databaseClient, err := go_database.NewClient(ctx, go_database.Config{
+		Env: environment,
+	}, logClient)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed creating database client", go_log.FmtError(err))
+	}
+	logClient.RegisterShutdownHook(func(ctx context.Context) {
+		databaseClient.Close(ctx)
+	})
+	defer databaseClient.Close(go_context.ShutDown())
+
+	migrations, err := go_migrate.Load(os.DirFS(dir))
+	if err != nil {
+		logClient.Fatal(ctx, "Failed loading migrations", go_log.FmtError(err))
+	}
+
+	migrateClient, err := go_migrate.NewClient(ctx, go_migrate.Config{
+		Dialect: databaseClient.Url().Scheme,
+		DryRun:  dryRun,
+		Table:   table,
+	}, logClient, databaseClient.DB(), migrations)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed creating migrate client", go_log.FmtError(err))
+	}
+
+	switch args[0] {
+	case "up":
+		up(ctx, logClient, migrateClient)
+	case "down":
+		n, _ := strconv.Atoi(args[1])
+		down(ctx, logClient, migrateClient, n)
+	case "status":
+		status(ctx, logClient, migrateClient)
+	}
+}
+
+func checkArgs(args []string) error {
+	if len(args) == 0 {
+		return go_errors.New("Missing command")
+	}
+	switch args[0] {
+	case "up", "status":
+		if len(args) != 1 {
+			return go_errors.Errorf("Command %q takes no args", args[0])
+		}
+	case "down":
+		if len(args) != 2 {
+			return go_errors.New("Command \"down\" requires the number of migrations to revert")
+		}
+		if n, err := strconv.Atoi(args[1]); err != nil || n < 1 {
+			return go_errors.Errorf("Invalid number of migrations to revert %q", args[1])
+		}
+	case "create":
+		if len(args) != 2 {
+			return go_errors.New("Command \"create\" requires the migration name")
+		}
+	default:
+		return go_errors.Errorf("Unknown command %q", args[0])
+	}
+	return nil
+}
+
+func create(ctx context.Context, logClient go_log.Client, name string) {
+	up, down, err := go_migrate.Create(dir, name, time.Now())
+	if err != nil {
+		logClient.Fatal(ctx, "Failed creating migration", go_log.FmtError(err))
+	}
+	logClient.Info(ctx, "Created", go_log.FmtString(up, "up"), go_log.FmtString(down, "down"))
+}
+
+func up(ctx context.Context, logClient go_log.Client, migrateClient go_migrate.Client) {
+	ran, err := migrateClient.Up(ctx)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed migrating up", go_log.FmtError(err), go_log.FmtInt(len(ran), "len(ran)"))
+	}
+	logClient.Info(ctx, "Migrated up", go_log.FmtInt(len(ran), "len(ran)"))
+}
+
+func down(ctx context.Context, logClient go_log.Client, migrateClient go_migrate.Client, n int) {
+	ran, err := migrateClient.Down(ctx, n)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed migrating down", go_log.FmtError(err), go_log.FmtInt(len(ran), "len(ran)"))
+	}
+	logClient.Info(ctx, "Migrated down", go_log.FmtInt(len(ran), "len(ran)"))
+}
+
+func status(ctx context.Context, logClient go_log.Client, migrateClient go_migrate.Client) {
+	statuses, err := migrateClient.Status(ctx)
+	if err != nil {
+		logClient.Fatal(ctx, "Failed getting status", go_log.FmtError(err))
+	}
+	for _, s := range statuses {
+		fields := []go_log.Field{
+			go_log.FmtInt64(s.Version, "version"),
+			go_log.FmtString(s.Name, "name"),
+			go_log.FmtBool(s.Applied, "applied"),
+		}
+		if s.Applied {
+			fields = append(fields, go_log.FmtTime(s.AppliedAt, "appliedAt"))
+		}
+		switch {
+		case s.Missing:
+			logClient.Warn(ctx, "Applied migration is missing", fields...)
+		case s.ChecksumMismatch:
+			logClient.Warn(ctx, "Applied migration has changed", fields...)
+		default:
+			logClient.Info(ctx, "Migration", fields...)
+		}
+	}
+}
@@ -45,12 +45,16 @@ func ShutDown() context.Context {
 	return WithCorrelationId(context.Background(), CorrelationIdShutDown)
 }
 
-// New context with correlation ID of ctx with newly appended ctx, test value of ctx, and other defaults
+// New context with correlation ID of ctx with newly appended ctx, actor, baggage, test, trace ID and trace flags values of ctx, and other defaults
 func New(ctx context.Context) context.Context {
 	c := WithCorrelationId(context.Background(), uuid.New().String())
 	if ctx != nil {
 		c = WithCorrelationIdAppend(c, CorrelationId(ctx))
+		c = WithActor(c, Actor(ctx))
+		c = WithBaggage(c, Baggage(ctx))
 		c = WithTest(c, Test(ctx))
+		c = WithTraceId(c, TraceId(ctx))
+		c = WithTraceFlags(c, TraceFlags(ctx))
 	}
 	return c
 }
@@ -60,8 +64,27 @@ type key int
 const (
 	keyCorrelationId key = iota
 	keyTest          key = iota
+	keyTraceId       key = iota
+	keyActor         key = iota
+	keyBaggage       key = iota
+	keyTraceFlags    key = iota
 )
 
+// Actor returns actor value of ctx
+func Actor(ctx context.Context) string {
+	if v, ok := ctx.Value(keyActor).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// WithActor returns a new context with actor value
+//
+// The actor is who is acting, e.g. the authenticated user or service account of a request, recorded by audit logs
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, keyActor, actor)
+}
+
 // CorrelationId returns correlation ID value of ctx
 func CorrelationId(ctx context.Context) string {
 	if v, ok := ctx.Value(keyCorrelationId).(string); ok {
@@ -83,6 +106,21 @@ func WithCorrelationIdAppend(ctx context.Context, correlationId string) context.
 	return WithCorrelationId(ctx, correlationId)
 }
 
+// Baggage returns baggage value of ctx
+func Baggage(ctx context.Context) string {
+	if v, ok := ctx.Value(keyBaggage).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// WithBaggage returns a new context with baggage value
+//
+// The baggage is propagated to other services as is, in the format of the W3C baggage header, e.g. "key1=value1,key2=value2"
+func WithBaggage(ctx context.Context, baggage string) context.Context {
+	return context.WithValue(ctx, keyBaggage, baggage)
+}
+
 // Test returns test value of ctx
 func Test(ctx context.Context) bool {
 	if v, ok := ctx.Value(keyTest).(bool); ok {
@@ -95,3 +133,33 @@ func Test(ctx context.Context) bool {
 func WithTest(ctx context.Context, test bool) context.Context {
 	return context.WithValue(ctx, keyTest, test)
 }
+
+// TraceId returns trace ID value of ctx
+func TraceId(ctx context.Context) string {
+	if v, ok := ctx.Value(keyTraceId).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// WithTraceId returns a new context with trace ID value
+//
+// The trace ID is the hex encoded 16 byte ID shared by all spans of a trace, e.g. from a X-Cloud-Trace-Context or traceparent header
+func WithTraceId(ctx context.Context, traceId string) context.Context {
+	return context.WithValue(ctx, keyTraceId, traceId)
+}
+
+// TraceFlags returns trace flags value of ctx
+func TraceFlags(ctx context.Context) uint8 {
+	if v, ok := ctx.Value(keyTraceFlags).(uint8); ok {
+		return v
+	}
+	return 0
+}
+
+// WithTraceFlags returns a new context with trace flags value
+//
+// The trace flags are those of the W3C traceparent header of the trace ID, e.g. whether it is sampled
+func WithTraceFlags(ctx context.Context, flags uint8) context.Context {
+	return context.WithValue(ctx, keyTraceFlags, flags)
+}
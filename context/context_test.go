@@ -386,3 +386,214 @@ func TestWithTest(t *testing.T) {
 		}
 	}
 }
+
+func TestTraceId(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    context.Context
+		expected string
+	}{
+		{
+			desc:     "set",
+			input:    context.WithValue(context.Background(), keyTraceId, "105445aa7843bc8bf206b12000100000"),
+			expected: "105445aa7843bc8bf206b12000100000",
+		},
+
+		{
+			desc:     "unexpected type",
+			input:    context.WithValue(context.Background(), keyTraceId, 1),
+			expected: "",
+		},
+
+		{
+			desc:     "none",
+			input:    context.Background(),
+			expected: "",
+		},
+	}
+
+	for i, d := range data {
+		result := TraceId(d.input)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestWithTraceId(t *testing.T) {
+	traceId := "105445aa7843bc8bf206b12000100000"
+	result := New(WithTraceId(context.Background(), traceId))
+
+	if TraceId(result) != traceId {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "TraceId(New(result))",
+			Expected:   traceId,
+			Result:     TraceId(result),
+		}))
+	}
+}
+
+func TestTraceFlags(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    context.Context
+		expected uint8
+	}{
+		{
+			desc:     "set",
+			input:    context.WithValue(context.Background(), keyTraceFlags, uint8(1)),
+			expected: 1,
+		},
+
+		{
+			desc:     "unexpected type",
+			input:    context.WithValue(context.Background(), keyTraceFlags, 1),
+			expected: 0,
+		},
+
+		{
+			desc:     "none",
+			input:    context.Background(),
+			expected: 0,
+		},
+	}
+
+	for i, d := range data {
+		result := TraceFlags(d.input)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestWithTraceFlags(t *testing.T) {
+	result := New(WithTraceFlags(context.Background(), 1))
+
+	if TraceFlags(result) != 1 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "TraceFlags(New(result))",
+			Expected:   1,
+			Result:     TraceFlags(result),
+		}))
+	}
+}
+
+func TestActor(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    context.Context
+		expected string
+	}{
+		{
+			desc:     "set",
+			input:    context.WithValue(context.Background(), keyActor, "user@example.com"),
+			expected: "user@example.com",
+		},
+
+		{
+			desc:     "unexpected type",
+			input:    context.WithValue(context.Background(), keyActor, 1),
+			expected: "",
+		},
+
+		{
+			desc:     "none",
+			input:    context.Background(),
+			expected: "",
+		},
+	}
+
+	for i, d := range data {
+		result := Actor(d.input)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestWithActor(t *testing.T) {
+	actor := "user@example.com"
+	result := New(WithActor(context.Background(), actor))
+
+	if Actor(result) != actor {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "Actor(New(result))",
+			Expected:   actor,
+			Result:     Actor(result),
+		}))
+	}
+}
+
+func TestBaggage(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    context.Context
+		expected string
+	}{
+		{
+			desc:     "set",
+			input:    context.WithValue(context.Background(), keyBaggage, "tenant=1"),
+			expected: "tenant=1",
+		},
+
+		{
+			desc:     "unexpected type",
+			input:    context.WithValue(context.Background(), keyBaggage, 1),
+			expected: "",
+		},
+
+		{
+			desc:     "none",
+			input:    context.Background(),
+			expected: "",
+		},
+	}
+
+	for i, d := range data {
+		result := Baggage(d.input)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestWithBaggage(t *testing.T) {
+	baggage := "tenant=1,region=nz"
+	result := New(WithBaggage(context.Background(), baggage))
+
+	if Baggage(result) != baggage {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "Baggage(New(result))",
+			Expected:   baggage,
+			Result:     Baggage(result),
+		}))
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// Class of a database error
+type Class int
+
+// Class enums
+const (
+	ClassUnknown Class = iota
+	ClassNotFound
+	ClassUniqueViolation
+	ClassForeignKeyViolation
+	ClassSerializationFailure // Safe to retry the transaction
+)
+
+// Classification of a database error
+type Classification struct {
+	Class      Class
+	Constraint string // Name of the violated constraint, if known
+}
+
+// Classifier of database errors, pluggable so that services can handle driver specific errors
+type Classifier func(err error) Classification
+
+// SQLSTATE codes
+const (
+	sqlStateUniqueViolation      = "23505"
+	sqlStateForeignKeyViolation  = "23503"
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// MySQL error numbers, as found in error messages like "Error 1062: Duplicate entry..."
+var (
+	mysqlErrorRegexp        = regexp.MustCompile(`^Error (\d+)`)
+	mysqlClassByErrorNumber = map[string]Class{
+		"1062": ClassUniqueViolation,
+		"1451": ClassForeignKeyViolation,
+		"1452": ClassForeignKeyViolation,
+		"1213": ClassSerializationFailure,
+	}
+)
+
+// Constraint names in Postgres and MySQL error messages
+var constraintRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`constraint "([^"]+)"`),
+	regexp.MustCompile("CONSTRAINT `([^`]+)`"),
+	regexp.MustCompile(`for key '([^']+)'`),
+}
+
+// DefaultClassifier for sql.ErrNoRows, and Postgres and MySQL driver errors
+//
+// Postgres errors are classified by SQLSTATE for drivers whose errors have an SQLState method, e.g. lib/pq and pgx
+// MySQL errors are classified by the error number in the message, as go-sql-driver errors have no methods for it
+func DefaultClassifier(err error) Classification {
+	if err == nil {
+		return Classification{}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return Classification{Class: ClassNotFound}
+	}
+
+	var class Class
+	var withSQLState interface{ SQLState() string }
+	if errors.As(err, &withSQLState) {
+		switch withSQLState.SQLState() {
+		case sqlStateUniqueViolation:
+			class = ClassUniqueViolation
+		case sqlStateForeignKeyViolation:
+			class = ClassForeignKeyViolation
+		case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+			class = ClassSerializationFailure
+		}
+	} else if match := mysqlErrorRegexp.FindStringSubmatch(rootMessage(err)); match != nil {
+		class = mysqlClassByErrorNumber[match[1]]
+	}
+	if class == ClassUnknown {
+		return Classification{}
+	}
+	return Classification{
+		Class:      class,
+		Constraint: constraint(err),
+	}
+}
+
+func rootMessage(err error) string {
+	for {
+		unwrapped := errors.Unwrap(err)
+		if unwrapped == nil {
+			return err.Error()
+		}
+		err = unwrapped
+	}
+}
+
+func constraint(err error) string {
+	var withConstraintName interface{ ConstraintName() string }
+	if errors.As(err, &withConstraintName) {
+		return withConstraintName.ConstraintName()
+	}
+	message := rootMessage(err)
+	for _, r := range constraintRegexps {
+		if match := r.FindStringSubmatch(message); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// StatusFromError converts a classified database error into a go_errors.Status
+//
+// Not found errors are 404, unique violations 409, and foreign key violations 422, with items naming the constraint
+// Errors which are already a Status, or are not classified, are returned as is
+func StatusFromError(err error, classifier Classifier) error {
+	if err == nil || go_errors.IsStatus(err) {
+		return err
+	}
+	if classifier == nil {
+		classifier = DefaultClassifier
+	}
+	c := classifier(err)
+	var s go_errors.Status
+	switch c.Class {
+	case ClassNotFound:
+		return go_errors.NewStatusWithCause(err, http.StatusNotFound, "")
+	case ClassUniqueViolation:
+		s = go_errors.NewStatusWithItems(http.StatusConflict, "Unique constraint violated", constraintItems(c.Constraint, "MUST_BE_UNIQUE"))
+	case ClassForeignKeyViolation:
+		s = go_errors.NewStatusWithItems(http.StatusUnprocessableEntity, "Foreign key constraint violated", constraintItems(c.Constraint, "MUST_REFERENCE_EXISTING"))
+	default:
+		return err
+	}
+	s.Cause = err
+	return s
+}
+
+func constraintItems(constraint, message string) []go_errors.Item {
+	return []go_errors.Item{
+		{
+			Field:   strings.TrimSpace(constraint),
+			Message: message,
+		},
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	go_environment "github.com/caigwatkin/go/environment"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_log "github.com/caigwatkin/go/log"
+)
+
+// Client interface for a database/sql handle with query logging
+type Client interface {
+	DB() *sql.DB
+	Url() Url
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Close(ctx context.Context) error
+}
+
+// Config for the database
+//
+// The database URL is taken from Env.DatabaseUrl
+// Pool options in the database URL query string take precedence over Pool
+type Config struct {
+	Env                go_environment.Environment
+	Drivers            map[string]string // Registered database/sql driver names by URL scheme, defaults to the scheme
+	Pool               PoolOptions
+	PingAttempts       int           // Attempts to ping on start up, defaults to 5
+	PingBackoff        time.Duration // Wait after the first failed ping, doubled after each failure, defaults to 1 second
+	SlowQueryThreshold time.Duration // Queries taking at least this long are logged at warn level, zero to disable
+}
+
+const (
+	pingAttemptsDefault = 5
+	pingBackoffDefault  = time.Second
+)
+
+// NewClient opens the database with the driver registered for the URL scheme and pings it until it is ready
+//
+// The driver must be registered with database/sql, e.g. by blank importing the driver package in main
+func NewClient(ctx context.Context, config Config, logClient go_log.Client) (Client, error) {
+	logClient = logClient.Named("database")
+	u, err := ParseUrl(config.Env.DatabaseUrl)
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed parsing database URL")
+	}
+	logClient.Info(ctx, "Initializing",
+		go_log.FmtString(u.String(), "url"),
+		go_log.FmtAny(config.Pool, "config.Pool"),
+		go_log.FmtDuration(config.SlowQueryThreshold, "config.SlowQueryThreshold"),
+	)
+
+	driverName := u.Scheme
+	if v, ok := config.Drivers[u.Scheme]; ok {
+		driverName = v
+	}
+	db, err := sql.Open(driverName, u.DSN())
+	if err != nil {
+		return nil, go_errors.Wrapf(err, "Failed opening database with driver %q", driverName)
+	}
+	applyPoolOptions(db, mergePoolOptions(u.Pool, config.Pool))
+
+	if err := ping(ctx, logClient, db, config.PingAttempts, config.PingBackoff); err != nil {
+		db.Close()
+		return nil, go_errors.Wrap(err, "Failed pinging database")
+	}
+
+	logClient.Info(ctx, "Initialized")
+	return client{
+		db:                 db,
+		logClient:          logClient,
+		slowQueryThreshold: config.SlowQueryThreshold,
+		url:                u,
+	}, nil
+}
+
+func mergePoolOptions(preferred, fallback PoolOptions) PoolOptions {
+	if preferred.MaxOpenConns == 0 {
+		preferred.MaxOpenConns = fallback.MaxOpenConns
+	}
+	if preferred.MaxIdleConns == 0 {
+		preferred.MaxIdleConns = fallback.MaxIdleConns
+	}
+	if preferred.ConnMaxLifetime == 0 {
+		preferred.ConnMaxLifetime = fallback.ConnMaxLifetime
+	}
+	if preferred.ConnMaxIdleTime == 0 {
+		preferred.ConnMaxIdleTime = fallback.ConnMaxIdleTime
+	}
+	return preferred
+}
+
+func applyPoolOptions(db *sql.DB, pool PoolOptions) {
+	if pool.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+}
+
+// ping the database, retrying with backoff
+func ping(ctx context.Context, logClient go_log.Client, db *sql.DB, attempts int, backoff time.Duration) error {
+	if attempts <= 0 {
+		attempts = pingAttemptsDefault
+	}
+	if backoff <= 0 {
+		backoff = pingBackoffDefault
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = db.PingContext(ctx); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		logClient.Warn(ctx, "Failed pinging database, will retry",
+			go_log.FmtInt(attempt, "attempt"),
+			go_log.FmtDuration(backoff, "backoff"),
+			go_log.FmtError(err),
+		)
+		select {
+		case <-ctx.Done():
+			return go_errors.Wrap(ctx.Err(), "Context done while waiting to retry ping")
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return go_errors.Wrapf(err, "Failed pinging database after %d attempts", attempts)
+}
+
+type client struct {
+	db                 *sql.DB
+	logClient          go_log.Client
+	slowQueryThreshold time.Duration
+	url                Url
+}
+
+// DB handle, queries made on it directly are not logged
+func (c client) DB() *sql.DB {
+	return c.db
+}
+
+// Url of the database
+func (c client) Url() Url {
+	return c.url
+}
+
+// ExecContext executes a query without returning rows
+func (c client) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := c.db.ExecContext(ctx, query, args...)
+	c.logQuery(ctx, query, args, time.Since(start), err)
+	return result, err
+}
+
+// QueryContext executes a query returning rows
+func (c client) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	c.logQuery(ctx, query, args, time.Since(start), err)
+	return rows, err
+}
+
+// QueryRowContext executes a query returning at most one row
+//
+// Errors are deferred until Scan is called on the row, so are not logged
+func (c client) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := c.db.QueryRowContext(ctx, query, args...)
+	c.logQuery(ctx, query, args, time.Since(start), nil)
+	return row
+}
+
+// Close the database, use on shut down
+func (c client) Close(ctx context.Context) error {
+	c.logClient.Info(ctx, "Closing")
+	if err := c.db.Close(); err != nil {
+		return go_errors.Wrap(err, "Failed closing database")
+	}
+	c.logClient.Info(ctx, "Closed")
+	return nil
+}
+
+// logQuery at debug level, or warn level if failed or slow
+//
+// Args are not logged as they may contain personal data
+func (c client) logQuery(ctx context.Context, query string, args []interface{}, duration time.Duration, err error) {
+	fields := []go_log.Field{
+		go_log.FmtString(query, "query"),
+		go_log.FmtInt(len(args), "len(args)"),
+		go_log.FmtDuration(duration, "duration"),
+	}
+	if err != nil {
+		c.logClient.Warn(ctx, "Failed query", append(fields, go_log.FmtError(err))...)
+		return
+	}
+	if c.slowQueryThreshold > 0 && duration >= c.slowQueryThreshold {
+		c.logClient.Warn(ctx, "Slow query", fields...)
+		return
+	}
+	c.logClient.Debug(ctx, "Query", fields...)
+}
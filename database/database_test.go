@@ -0,0 +1,247 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	go_database_mock "github.com/caigwatkin/go/database/mock"
+	go_environment "github.com/caigwatkin/go/environment"
+	go_log "github.com/caigwatkin/go/log"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestNewClient(t *testing.T) {
+	type expected struct {
+		Pings int
+		Err   bool
+	}
+	var data = []struct {
+		desc     string
+		input    int
+		expected expected
+	}{
+		{
+			desc:  "ping succeeds",
+			input: 0,
+			expected: expected{
+				Pings: 1,
+			},
+		},
+
+		{
+			desc:  "ping succeeds after retries",
+			input: 2,
+			expected: expected{
+				Pings: 3,
+			},
+		},
+
+		{
+			desc:  "ping fails",
+			input: 3,
+			expected: expected{
+				Pings: 3,
+				Err:   true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		db := go_database_mock.NewDatabase("TestNewClient")
+		var pings int
+		failures := d.input
+		db.Ping = func() error {
+			pings++
+			if pings <= failures {
+				return errors.New("not ready")
+			}
+			return nil
+		}
+
+		c, err := NewClient(context.Background(), Config{
+			Env: go_environment.Environment{
+				DatabaseUrl: go_database_mock.Url("TestNewClient"),
+			},
+			PingAttempts: 3,
+			PingBackoff:  time.Millisecond,
+		}, go_log_mock.Client)
+
+		if (err != nil) != d.expected.Err {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected.Err,
+				Result:     err,
+			}))
+		}
+		if pings != d.expected.Pings {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "pings",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected.Pings,
+				Result:     pings,
+			}))
+		}
+		if c != nil {
+			c.Close(context.Background())
+		}
+	}
+}
+
+func TestQueries(t *testing.T) {
+	db := go_database_mock.NewDatabase("TestQueries")
+	db.Query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return go_database_mock.NewRows([]string{"name"}, []driver.Value{"a"}, []driver.Value{"b"}), nil
+	}
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, Config{
+		Env: go_environment.Environment{
+			DatabaseUrl: go_database_mock.Url("TestQueries") + "?max_open_conns=2",
+		},
+		SlowQueryThreshold: time.Nanosecond,
+	}, go_log_mock.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	if v := c.DB().Stats().MaxOpenConnections; v != 2 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "c.DB().Stats().MaxOpenConnections",
+			Expected:   2,
+			Result:     v,
+		}))
+	}
+
+	if _, err := c.ExecContext(ctx, "UPDATE things SET name = $1", "x"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := c.QueryContext(ctx, "SELECT name FROM things")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(names, expected) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "names",
+			Expected:   expected,
+			Result:     names,
+		}))
+	}
+	expected := []go_database_mock.Statement{
+		{Query: "UPDATE things SET name = $1", Args: []interface{}{"x"}},
+		{Query: "SELECT name FROM things"},
+	}
+	if result := db.Recorded(); !reflect.DeepEqual(result, expected) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "db.Recorded()",
+			Expected:   expected,
+			Result:     result,
+		}))
+	}
+}
+
+func TestLogQuery(t *testing.T) {
+	type expected struct {
+		Message  string
+		Severity go_log.Severity
+	}
+	var data = []struct {
+		desc     string
+		input    error
+		expected expected
+	}{
+		{
+			desc:  "succeeded",
+			input: nil,
+			expected: expected{
+				Message:  "Query",
+				Severity: go_log.SeverityDebug,
+			},
+		},
+
+		{
+			desc:  "failed",
+			input: errors.New("relation does not exist"),
+			expected: expected{
+				Message:  "Failed query",
+				Severity: go_log.SeverityWarn,
+			},
+		},
+	}
+
+	for i, d := range data {
+		db := go_database_mock.NewDatabase("TestLogQuery")
+		failure := d.input
+		db.Exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+			return driver.RowsAffected(1), failure
+		}
+		ctx := context.Background()
+		logClient := go_log_mock.NewRecorder(t)
+		c, err := NewClient(ctx, Config{
+			Env: go_environment.Environment{
+				DatabaseUrl: go_database_mock.Url("TestLogQuery"),
+			},
+		}, logClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logClient.Reset()
+
+		c.ExecContext(ctx, "DELETE FROM things")
+		c.Close(ctx)
+
+		var result expected
+		if entries := logClient.Entries(go_log.SeverityDebug); len(entries) > 0 {
+			result = expected{
+				Message:  entries[0].Message,
+				Severity: entries[0].Severity,
+			}
+		}
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -0,0 +1,408 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"time"
+
+	go_database "github.com/caigwatkin/go/database"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_log "github.com/caigwatkin/go/log"
+)
+
+// Client interface for migrations
+type Client interface {
+	Up(ctx context.Context) ([]Migration, error)
+	Down(ctx context.Context, n int) ([]Migration, error)
+	Status(ctx context.Context) ([]Status, error)
+}
+
+// Config for migrations
+type Config struct {
+	Dialect string // Scheme of the database URL, one of go_database.SchemePostgres or go_database.SchemeMySQL
+	Table   string // Table recording applied versions, defaults to "schema_migrations"
+	DryRun  bool   // Log the migrations that would run without running them
+}
+
+// Status of a migration
+type Status struct {
+	Migration
+	Applied          bool
+	AppliedAt        time.Time
+	ChecksumMismatch bool // Applied with an up file which has since changed
+	Missing          bool // Applied but no longer loaded
+}
+
+const tableDefault = "schema_migrations"
+
+const unlockTimeout = 10 * time.Second
+
+var tableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// dialect specific SQL
+type dialect struct {
+	placeholder func(n int) string
+	lock        string
+	lockResult  bool // The lock query returns 1 if the lock is acquired, otherwise 0 or NULL
+	unlock      string
+	lockKey     func(table string) interface{}
+}
+
+var dialects = map[string]dialect{
+	go_database.SchemePostgres: {
+		placeholder: func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		},
+		lock:   "SELECT pg_advisory_lock($1)",
+		unlock: "SELECT pg_advisory_unlock($1)",
+		lockKey: func(table string) interface{} {
+			h := fnv.New64a()
+			h.Write([]byte(table))
+			return int64(h.Sum64())
+		},
+	},
+	go_database.SchemeMySQL: {
+		placeholder: func(int) string {
+			return "?"
+		},
+		lock:       "SELECT GET_LOCK(?, -1)",
+		lockResult: true,
+		unlock:     "SELECT RELEASE_LOCK(?)",
+		lockKey: func(table string) interface{} {
+			return table
+		},
+	},
+}
+
+// NewClient for running migrations against db
+//
+// Migrations are run in version order, each in its own transaction, though MySQL commits DDL statements implicitly,
+// so a failed MySQL migration may be partially applied
+// Runs hold a database lock so that concurrent instances of a service do not migrate at the same time
+func NewClient(ctx context.Context, config Config, logClient go_log.Client, db *sql.DB, migrations []Migration) (Client, error) {
+	logClient = logClient.Named("migrate")
+	logClient.Info(ctx, "Initializing", go_log.FmtAny(config, "config"), go_log.FmtInt(len(migrations), "len(migrations)"))
+
+	d, ok := dialects[config.Dialect]
+	if !ok {
+		return nil, go_errors.Errorf("Unsupported dialect %q", config.Dialect)
+	}
+	if config.Table == "" {
+		config.Table = tableDefault
+	}
+	if !tableRegexp.MatchString(config.Table) {
+		return nil, go_errors.Errorf("Invalid table name %q", config.Table)
+	}
+
+	logClient.Info(ctx, "Initialized")
+	return client{
+		config:     config,
+		db:         db,
+		dialect:    d,
+		logClient:  logClient,
+		migrations: migrations,
+	}, nil
+}
+
+type client struct {
+	config     Config
+	db         *sql.DB
+	dialect    dialect
+	logClient  go_log.Client
+	migrations []Migration
+}
+
+type applied struct {
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Up runs all pending migrations, returning those run
+//
+// Fails without running any migrations if an applied migration's checksum has changed, or a pending migration is older than the latest applied
+func (c client) Up(ctx context.Context) (ran []Migration, err error) {
+	err = c.locked(ctx, func(conn *sql.Conn) error {
+		appliedByVersion, err := c.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		var latest int64
+		for version := range appliedByVersion {
+			if version > latest {
+				latest = version
+			}
+		}
+		var pending []Migration
+		for _, m := range c.migrations {
+			a, ok := appliedByVersion[m.Version]
+			if !ok {
+				if m.Version < latest {
+					return go_errors.Errorf("Pending migration %d_%s is older than latest applied version %d", m.Version, m.Name, latest)
+				}
+				pending = append(pending, m)
+				continue
+			}
+			if a.Checksum != m.Checksum {
+				return go_errors.Errorf("Checksum of applied migration %d_%s has changed", m.Version, m.Name)
+			}
+		}
+		for _, m := range pending {
+			if err := c.run(ctx, conn, m, true); err != nil {
+				return err
+			}
+			ran = append(ran, m)
+		}
+		return nil
+	})
+	return
+}
+
+// Down reverts the latest n applied migrations, returning those reverted
+//
+// Fails without reverting any migrations if one to revert has no file, no down file, or its checksum has changed
+func (c client) Down(ctx context.Context, n int) (ran []Migration, err error) {
+	if n < 1 {
+		return nil, go_errors.Errorf("Invalid number of migrations to revert %d", n)
+	}
+	err = c.locked(ctx, func(conn *sql.Conn) error {
+		appliedByVersion, err := c.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(appliedByVersion))
+		for version := range appliedByVersion {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+		if len(versions) > n {
+			versions = versions[:n]
+		}
+		migrationsByVersion := make(map[int64]Migration, len(c.migrations))
+		for _, m := range c.migrations {
+			migrationsByVersion[m.Version] = m
+		}
+		var revert []Migration
+		for _, version := range versions {
+			m, ok := migrationsByVersion[version]
+			if !ok {
+				return go_errors.Errorf("Applied migration %d has no file", version)
+			}
+			if appliedByVersion[version].Checksum != m.Checksum {
+				return go_errors.Errorf("Checksum of applied migration %d_%s has changed", m.Version, m.Name)
+			}
+			if m.Down == "" {
+				return go_errors.Errorf("Migration %d_%s has no down file", m.Version, m.Name)
+			}
+			revert = append(revert, m)
+		}
+		for _, m := range revert {
+			if err := c.run(ctx, conn, m, false); err != nil {
+				return err
+			}
+			ran = append(ran, m)
+		}
+		if len(ran) < n {
+			c.logClient.Warn(ctx, "Fewer migrations applied than requested to revert", go_log.FmtInt(n, "n"), go_log.FmtInt(len(ran), "len(ran)"))
+		}
+		return nil
+	})
+	return
+}
+
+// Status of loaded and applied migrations, ordered by version with applied migrations which are no longer loaded last
+func (c client) Status(ctx context.Context) ([]Status, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed getting connection")
+	}
+	defer conn.Close()
+
+	if err := c.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	appliedByVersion, err := c.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, m := range c.migrations {
+		s := Status{Migration: m}
+		if a, ok := appliedByVersion[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+			s.ChecksumMismatch = a.Checksum != m.Checksum
+			delete(appliedByVersion, m.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	var missing []Status
+	for version, a := range appliedByVersion {
+		missing = append(missing, Status{
+			Migration: Migration{
+				Version:  version,
+				Checksum: a.Checksum,
+			},
+			Applied:   true,
+			AppliedAt: a.AppliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Version < missing[j].Version
+	})
+	return append(statuses, missing...), nil
+}
+
+// locked runs fn on a single connection holding the migration lock, after creating the table if needed
+func (c client) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed getting connection")
+	}
+	defer conn.Close()
+
+	key := c.dialect.lockKey(c.config.Table)
+	c.logClient.Info(ctx, "Acquiring lock")
+	if err := c.lock(ctx, conn, key); err != nil {
+		return err
+	}
+	defer func() {
+		// Released even if ctx is done, as the lock is held until the connection is closed, which may be never if pooled
+		unlockCtx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+		if _, err := conn.ExecContext(unlockCtx, c.dialect.unlock, key); err != nil {
+			c.logClient.Error(ctx, "Failed releasing lock", go_log.FmtError(err))
+		}
+	}()
+	c.logClient.Info(ctx, "Acquired lock")
+
+	if err := c.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (c client) lock(ctx context.Context, conn *sql.Conn, key interface{}) error {
+	if !c.dialect.lockResult {
+		if _, err := conn.ExecContext(ctx, c.dialect.lock, key); err != nil {
+			return go_errors.Wrap(err, "Failed acquiring lock")
+		}
+		return nil
+	}
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, c.dialect.lock, key).Scan(&acquired); err != nil {
+		return go_errors.Wrap(err, "Failed acquiring lock")
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return go_errors.New("Failed acquiring lock, the lock query did not return 1")
+	}
+	return nil
+}
+
+func (c client) createTable(ctx context.Context, conn *sql.Conn) error {
+	if c.config.DryRun {
+		return nil
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`, c.config.Table)); err != nil {
+		return go_errors.Wrapf(err, "Failed creating table %q", c.config.Table)
+	}
+	return nil
+}
+
+func (c client) applied(ctx context.Context, conn *sql.Conn) (map[int64]applied, error) {
+	appliedByVersion := make(map[int64]applied)
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, checksum, applied_at FROM %s ORDER BY version", c.config.Table))
+	if err != nil {
+		if c.config.DryRun {
+			c.logClient.Warn(ctx, "Dry run, failed querying applied migrations so assuming none, the table may not exist yet", go_log.FmtError(err))
+			return appliedByVersion, nil
+		}
+		return nil, go_errors.Wrap(err, "Failed querying applied migrations")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var a applied
+		if err := rows.Scan(&version, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, go_errors.Wrap(err, "Failed scanning applied migration")
+		}
+		appliedByVersion[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, go_errors.Wrap(err, "Failed iterating applied migrations")
+	}
+	return appliedByVersion, nil
+}
+
+// run the up or down SQL of m and record it in a transaction
+func (c client) run(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	direction, query := "down", m.Down
+	if up {
+		direction, query = "up", m.Up
+	}
+	fields := []go_log.Field{
+		go_log.FmtInt64(m.Version, "version"),
+		go_log.FmtString(m.Name, "name"),
+		go_log.FmtString(direction, "direction"),
+	}
+	if c.config.DryRun {
+		c.logClient.Info(ctx, "Dry run, not migrating", append(fields, go_log.FmtString(query, "query"))...)
+		return nil
+	}
+	c.logClient.Info(ctx, "Migrating", fields...)
+
+	start := time.Now()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed beginning transaction")
+	}
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		tx.Rollback()
+		return go_errors.Wrapf(err, "Failed migrating %s %d_%s", direction, m.Version, m.Name)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (%s, %s, %s, %s)", c.config.Table, c.dialect.placeholder(1), c.dialect.placeholder(2), c.dialect.placeholder(3), c.dialect.placeholder(4)),
+			m.Version, m.Name, m.Checksum, time.Now().UTC(),
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", c.config.Table, c.dialect.placeholder(1)), m.Version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return go_errors.Wrapf(err, "Failed recording migration %s %d_%s", direction, m.Version, m.Name)
+	}
+	if err := tx.Commit(); err != nil {
+		return go_errors.Wrapf(err, "Failed committing migration %s %d_%s", direction, m.Version, m.Name)
+	}
+
+	c.logClient.Info(ctx, "Migrated", append(fields, go_log.FmtDuration(time.Since(start), "duration"))...)
+	return nil
+}
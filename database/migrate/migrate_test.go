@@ -0,0 +1,456 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	go_database "github.com/caigwatkin/go/database"
+	go_database_mock "github.com/caigwatkin/go/database/mock"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestLoad(t *testing.T) {
+	type expected struct {
+		Versions []int64
+		Err      bool
+	}
+	var data = []struct {
+		desc     string
+		input    fstest.MapFS
+		expected expected
+	}{
+		{
+			desc: "ordered with other files ignored",
+			input: fstest.MapFS{
+				"2_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+				"1_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+				"1_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+				"README.md":         {Data: []byte("# migrations")},
+				"nested/3_x.up.sql": {Data: []byte("")},
+			},
+			expected: expected{
+				Versions: []int64{1, 2},
+			},
+		},
+
+		{
+			desc: "missing up file",
+			input: fstest.MapFS{
+				"1_first.down.sql": {Data: []byte("DROP TABLE a;")},
+			},
+			expected: expected{
+				Err: true,
+			},
+		},
+
+		{
+			desc: "mismatched names",
+			input: fstest.MapFS{
+				"1_first.up.sql":   {Data: []byte("CREATE TABLE a ();")},
+				"1_other.down.sql": {Data: []byte("DROP TABLE a;")},
+			},
+			expected: expected{
+				Err: true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		result, err := Load(d.input)
+
+		var versions []int64
+		for _, m := range result {
+			versions = append(versions, m.Version)
+		}
+		if !reflect.DeepEqual(versions, d.expected.Versions) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "versions",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.Versions,
+				Result:     versions,
+			}))
+		}
+		if (err != nil) != d.expected.Err {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected.Err,
+				Result:     err,
+			}))
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	up, down, err := Create(dir, "Create Things", time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, "20210901120000_create_things.up.sql"); up != expected {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "up",
+			Expected:   expected,
+			Result:     up,
+		}))
+	}
+	if expected := filepath.Join(dir, "20210901120000_create_things.down.sql"); down != expected {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "down",
+			Expected:   expected,
+			Result:     down,
+		}))
+	}
+	if _, _, err := Create(dir, "create things", time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("Expected error creating existing migration")
+	}
+	if _, _, err := Create(dir, "drop-things", time.Now()); err == nil {
+		t.Error("Expected error creating migration with invalid name")
+	}
+}
+
+// table of applied migrations backed by a mock database
+type table struct {
+	rows map[int64][]driver.Value
+	lock driver.Value // Result of GET_LOCK
+}
+
+func newTable(t *testing.T, name string) (*go_database_mock.Database, *table, *sql.DB) {
+	tbl := &table{
+		rows: make(map[int64][]driver.Value),
+		lock: int64(1),
+	}
+	db := go_database_mock.NewDatabase(name)
+	db.Exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		switch {
+		case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+			tbl.rows[args[0].Value.(int64)] = []driver.Value{args[0].Value, args[2].Value, args[3].Value}
+		case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+			delete(tbl.rows, args[0].Value.(int64))
+		case strings.Contains(query, "fail"):
+			return nil, errors.New("syntax error")
+		}
+		return driver.RowsAffected(1), nil
+	}
+	db.Query = func(query string, _ []driver.NamedValue) (driver.Rows, error) {
+		if strings.HasPrefix(query, "SELECT GET_LOCK") {
+			return go_database_mock.NewRows([]string{"lock"}, []driver.Value{tbl.lock}), nil
+		}
+		var versions []int64
+		for v := range tbl.rows {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] < versions[j]
+		})
+		var values [][]driver.Value
+		for _, v := range versions {
+			values = append(values, tbl.rows[v])
+		}
+		return go_database_mock.NewRows([]string{"version", "checksum", "applied_at"}, values...), nil
+	}
+	sqlDB, err := sql.Open(go_database_mock.DriverName, go_database_mock.Url(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB.Close()
+	})
+	return db, tbl, sqlDB
+}
+
+func migrations(ups ...string) []Migration {
+	var m []Migration
+	for i, up := range ups {
+		m = append(m, Migration{
+			Version:  int64(i + 1),
+			Name:     "m",
+			Up:       up,
+			Down:     "DROP",
+			Checksum: checksum([]byte(up)),
+		})
+	}
+	return m
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db, tbl, sqlDB := newTable(t, "TestUpAndDown")
+
+	c, err := NewClient(ctx, Config{Dialect: go_database.SchemePostgres}, go_log_mock.Client, sqlDB, migrations("CREATE a", "CREATE b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran, err := c.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || len(tbl.rows) != 2 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "len(ran), len(tbl.rows)",
+			Expected:   []int{2, 2},
+			Result:     []int{len(ran), len(tbl.rows)},
+		}))
+	}
+	if begins, commits, _ := db.Counts(); begins != 2 || commits != 2 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "begins, commits",
+			Expected:   []int{2, 2},
+			Result:     []int{begins, commits},
+		}))
+	}
+	recorded := db.Recorded()
+	if recorded[0].Query != "SELECT pg_advisory_lock($1)" || recorded[len(recorded)-1].Query != "SELECT pg_advisory_unlock($1)" {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "lock statements",
+			Expected:   []string{"SELECT pg_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"},
+			Result:     []string{recorded[0].Query, recorded[len(recorded)-1].Query},
+		}))
+	}
+
+	ran, err = c.Up(ctx)
+	if err != nil || len(ran) != 0 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "second up",
+			Expected:   0,
+			Result:     []interface{}{len(ran), err},
+		}))
+	}
+
+	ran, err = c.Down(ctx, 1)
+	if err != nil || len(ran) != 1 || ran[0].Version != 2 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "down",
+			Expected:   2,
+			Result:     []interface{}{ran, err},
+		}))
+	}
+
+	statuses, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied []bool
+	for _, s := range statuses {
+		applied = append(applied, s.Applied)
+	}
+	if expected := []bool{true, false}; !reflect.DeepEqual(applied, expected) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "applied",
+			Expected:   expected,
+			Result:     applied,
+		}))
+	}
+}
+
+func TestUpVerifiesChecksums(t *testing.T) {
+	ctx := context.Background()
+	_, tbl, sqlDB := newTable(t, "TestUpVerifiesChecksums")
+
+	c, err := NewClient(ctx, Config{Dialect: go_database.SchemePostgres}, go_log_mock.Client, sqlDB, migrations("CREATE a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewClient(ctx, Config{Dialect: go_database.SchemePostgres}, go_log_mock.Client, sqlDB, migrations("CREATE a changed", "CREATE b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Up(ctx); err == nil {
+		t.Error("Expected error for changed checksum")
+	}
+	if len(tbl.rows) != 1 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "len(tbl.rows)",
+			Expected:   1,
+			Result:     len(tbl.rows),
+		}))
+	}
+	statuses, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].ChecksumMismatch {
+		t.Error("Expected checksum mismatch in status")
+	}
+}
+
+func TestDownVerifiesMigrations(t *testing.T) {
+	var data = []struct {
+		desc  string
+		input []Migration
+	}{
+		{
+			desc:  "latest has no file",
+			input: migrations("CREATE a"),
+		},
+
+		{
+			desc:  "latest checksum changed",
+			input: migrations("CREATE a", "CREATE b changed"),
+		},
+	}
+
+	for i, d := range data {
+		ctx := context.Background()
+		_, tbl, sqlDB := newTable(t, "TestDownVerifiesMigrations")
+
+		c, err := NewClient(ctx, Config{Dialect: go_database.SchemePostgres}, go_log_mock.Client, sqlDB, migrations("CREATE a", "CREATE b"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err = NewClient(ctx, Config{Dialect: go_database.SchemePostgres}, go_log_mock.Client, sqlDB, d.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ran, err := c.Down(ctx, 1)
+		if err == nil || len(ran) != 0 || len(tbl.rows) != 2 {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err, len(ran), len(tbl.rows)",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   []interface{}{"error", 0, 2},
+				Result:     []interface{}{err, len(ran), len(tbl.rows)},
+			}))
+		}
+	}
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	ctx := context.Background()
+	db, tbl, sqlDB := newTable(t, "TestUpRollsBackFailedMigration")
+
+	c, err := NewClient(ctx, Config{Dialect: go_database.SchemePostgres}, go_log_mock.Client, sqlDB, migrations("CREATE a", "fail"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran, err := c.Up(ctx)
+	if err == nil {
+		t.Error("Expected error for failed migration")
+	}
+	if len(ran) != 1 || len(tbl.rows) != 1 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "len(ran), len(tbl.rows)",
+			Expected:   []int{1, 1},
+			Result:     []int{len(ran), len(tbl.rows)},
+		}))
+	}
+	if _, commits, rollbacks := db.Counts(); commits != 1 || rollbacks != 1 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "commits, rollbacks",
+			Expected:   []int{1, 1},
+			Result:     []int{commits, rollbacks},
+		}))
+	}
+}
+
+func TestUpDryRun(t *testing.T) {
+	ctx := context.Background()
+	db, tbl, sqlDB := newTable(t, "TestUpDryRun")
+
+	c, err := NewClient(ctx, Config{Dialect: go_database.SchemeMySQL, DryRun: true}, go_log_mock.Client, sqlDB, migrations("CREATE a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran, err := c.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || len(tbl.rows) != 0 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "len(ran), len(tbl.rows)",
+			Expected:   []int{1, 0},
+			Result:     []int{len(ran), len(tbl.rows)},
+		}))
+	}
+	if begins, _, _ := db.Counts(); begins != 0 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "begins",
+			Expected:   0,
+			Result:     begins,
+		}))
+	}
+}
+
+func TestLockResult(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    driver.Value
+		expected bool
+	}{
+		{
+			desc:     "acquired",
+			input:    int64(1),
+			expected: true,
+		},
+
+		{
+			desc:  "timed out",
+			input: int64(0),
+		},
+
+		{
+			desc:  "error",
+			input: nil,
+		},
+	}
+
+	ctx := context.Background()
+	for i, d := range data {
+		_, tbl, sqlDB := newTable(t, fmt.Sprintf("TestLockResult%d", i))
+		tbl.lock = d.input
+		c, err := NewClient(ctx, Config{Dialect: go_database.SchemeMySQL}, go_log_mock.Client, sqlDB, migrations("CREATE a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.Up(ctx)
+		result := err == nil && len(tbl.rows) == 1
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+	}
+}
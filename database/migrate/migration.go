@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// Migration data model, loaded from a pair of up and down SQL files
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up, hex encoded
+}
+
+// fileNameRegexp matches migration file names like "20210901120000_create_things.up.sql"
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+const versionFormat = "20060102150405"
+
+// Load migrations from the root of fsys, ordered by version
+//
+// Use os.DirFS for a directory, or fs.Sub for a directory within an embed.FS
+// Files must be named "<version>_<name>.up.sql" and "<version>_<name>.down.sql", down files are optional
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed reading migrations directory")
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, go_errors.Wrapf(err, "Failed parsing version of file %q", entry.Name())
+		}
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, go_errors.Wrapf(err, "Failed reading file %q", entry.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, go_errors.Errorf("Version %d has files with different names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+			m.Checksum = checksum(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, go_errors.Errorf("Version %d is missing an up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Create empty up and down files in dir for a new migration, versioned by now in UTC
+//
+// Returns the paths of the created files
+func Create(dir, name string, now time.Time) (up, down string, err error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	version := now.UTC().Format(versionFormat)
+	if !fileNameRegexp.MatchString(fmt.Sprintf("%s_%s.up.sql", version, name)) {
+		err = go_errors.Errorf("Invalid migration name %q, must be lower case letters, digits, and underscores", name)
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		err = go_errors.Wrapf(err, "Failed making directory %q", dir)
+		return
+	}
+	up = filepath.Join(dir, fmt.Sprintf("%s_%s.up.sql", version, name))
+	down = filepath.Join(dir, fmt.Sprintf("%s_%s.down.sql", version, name))
+	for _, path := range []string{up, down} {
+		if _, err = os.Stat(path); err == nil {
+			err = go_errors.Errorf("File %q already exists", path)
+			return
+		}
+		if err = ioutil.WriteFile(path, []byte(fmt.Sprintf("-- %s\n", filepath.Base(path))), 0644); err != nil {
+			err = go_errors.Wrapf(err, "Failed writing file %q", path)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+)
+
+// DriverName the mock driver is registered with in database/sql
+//
+// Use a database URL like "mock://name" with the name of a database created with NewDatabase
+const DriverName = "mock"
+
+func init() {
+	sql.Register(DriverName, drv{})
+}
+
+var (
+	databases      = make(map[string]*Database)
+	databasesMutex sync.Mutex
+)
+
+// Database which records statements and responds with scripted handlers
+//
+// Handlers are called with the lock held, so must not call back into the database
+type Database struct {
+	mutex sync.Mutex
+
+	Exec  func(query string, args []driver.NamedValue) (driver.Result, error)
+	Query func(query string, args []driver.NamedValue) (driver.Rows, error)
+	Ping  func() error
+
+	Statements []Statement
+	Begins     int
+	Commits    int
+	Rollbacks  int
+}
+
+// Statement recorded by the database
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// NewDatabase registered by name, replacing any existing database with the name
+func NewDatabase(name string) *Database {
+	databasesMutex.Lock()
+	defer databasesMutex.Unlock()
+
+	d := &Database{}
+	databases[name] = d
+	return d
+}
+
+// Url for the database, for use as go_environment.Environment.DatabaseUrl
+func Url(name string) string {
+	return fmt.Sprintf("%s://%s", DriverName, name)
+}
+
+// Recorded statements, copied so that they are safe to read while the database is in use
+func (d *Database) Recorded() []Statement {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return append([]Statement(nil), d.Statements...)
+}
+
+// Counts of transactions begun, committed, and rolled back
+func (d *Database) Counts() (begins, commits, rollbacks int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.Begins, d.Commits, d.Rollbacks
+}
+
+func (d *Database) record(query string, args []driver.NamedValue) {
+	s := Statement{Query: query}
+	for _, a := range args {
+		s.Args = append(s.Args, a.Value)
+	}
+	d.Statements = append(d.Statements, s)
+}
+
+func (d *Database) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.record(query, args)
+	if d.Exec == nil {
+		return driver.RowsAffected(0), nil
+	}
+	return d.Exec(query, args)
+}
+
+func (d *Database) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.record(query, args)
+	if d.Query == nil {
+		return NewRows(nil), nil
+	}
+	return d.Query(query, args)
+}
+
+func (d *Database) ping() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.Ping == nil {
+		return nil
+	}
+	return d.Ping()
+}
+
+type drv struct{}
+
+func (drv) Open(dsn string) (driver.Conn, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	databasesMutex.Lock()
+	defer databasesMutex.Unlock()
+
+	d, ok := databases[u.Hostname()]
+	if !ok {
+		return nil, fmt.Errorf("mock database %q not found", u.Hostname())
+	}
+	return &conn{database: d}, nil
+}
+
+type conn struct {
+	database *Database
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(_ context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	c.database.mutex.Lock()
+	defer c.database.mutex.Unlock()
+
+	c.database.Begins++
+	return tx{database: c.database}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.database.exec(query, args)
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.database.query(query, args)
+}
+
+func (c *conn) Ping(_ context.Context) error {
+	return c.database.ping()
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s stmt) Close() error {
+	return nil
+}
+
+func (s stmt) NumInput() int {
+	return -1
+}
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.database.exec(s.query, named(args))
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.database.query(s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	n := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		n[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return n
+}
+
+type tx struct {
+	database *Database
+}
+
+func (t tx) Commit() error {
+	t.database.mutex.Lock()
+	defer t.database.mutex.Unlock()
+
+	t.database.Commits++
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.database.mutex.Lock()
+	defer t.database.mutex.Unlock()
+
+	t.database.Rollbacks++
+	return nil
+}
+
+// NewRows with columns and values, for use in Query handlers
+func NewRows(columns []string, values ...[]driver.Value) driver.Rows {
+	return &rows{columns: columns, values: values}
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	i       int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.i >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.i])
+	r.i++
+	return nil
+}
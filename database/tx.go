@@ -0,0 +1,151 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// TxOptions for InTx
+type TxOptions struct {
+	Sql        *sql.TxOptions // Isolation level and read only, nil for driver defaults
+	MaxRetries int            // Retries on serialization failure, defaults to 3, negative to disable
+	Backoff    time.Duration  // Wait before the first retry, doubled before each retry, defaults to 10 milliseconds
+	Classifier Classifier     // Classifies errors for retries and statuses, defaults to DefaultClassifier
+}
+
+const (
+	maxRetriesDefault = 3
+	backoffDefault    = time.Millisecond * 10
+)
+
+type keyTx int
+
+const (
+	keyTxValue keyTx = iota
+)
+
+type txValue struct {
+	tx    *sql.Tx
+	depth int
+}
+
+// TxFromContext returns the transaction of the InTx call ctx is in, if any
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	if v, ok := ctx.Value(keyTxValue).(txValue); ok {
+		return v.tx, true
+	}
+	return nil, false
+}
+
+// InTx runs fn in a transaction, committing if fn returns nil and rolling back otherwise
+//
+// The transaction is rolled back before re-panicking if fn panics
+// If ctx is from an outer InTx call, fn runs in a savepoint of the outer transaction and opts other than Classifier are ignored
+// The whole transaction is retried with backoff on serialization failure, so fn must be safe to retry
+// Errors are converted by StatusFromError, e.g. a unique violation is returned as a 409 go_errors.Status
+func InTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	classifier := opts.Classifier
+	if classifier == nil {
+		classifier = DefaultClassifier
+	}
+
+	if v, ok := ctx.Value(keyTxValue).(txValue); ok {
+		return StatusFromError(inSavepoint(ctx, v, fn), classifier)
+	}
+
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = maxRetriesDefault
+	}
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = backoffDefault
+	}
+	for attempt := 0; ; attempt++ {
+		err := inTx(ctx, db, opts.Sql, fn)
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxRetries || classifier(err).Class != ClassSerializationFailure {
+			return StatusFromError(err, classifier)
+		}
+		select {
+		case <-ctx.Done():
+			return go_errors.Wrap(ctx.Err(), "Context done while waiting to retry transaction")
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func inTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed beginning transaction")
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, keyTxValue, txValue{tx: tx}), tx); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			return go_errors.Wrapf(err, "Failed rolling back transaction with error %q", errRollback)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return go_errors.Wrap(err, "Failed committing transaction")
+	}
+	return nil
+}
+
+func inSavepoint(ctx context.Context, outer txValue, fn func(ctx context.Context, tx *sql.Tx) error) (err error) {
+	inner := txValue{tx: outer.tx, depth: outer.depth + 1}
+	savepoint := fmt.Sprintf("sp_%d", inner.depth)
+	if _, err := inner.tx.ExecContext(ctx, fmt.Sprintf("SAVEPOINT %s", savepoint)); err != nil {
+		return go_errors.Wrapf(err, "Failed creating savepoint %q", savepoint)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			inner.tx.ExecContext(ctx, fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", savepoint))
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, keyTxValue, inner), inner.tx); err != nil {
+		if _, errRollback := inner.tx.ExecContext(ctx, fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", savepoint)); errRollback != nil {
+			return go_errors.Wrapf(err, "Failed rolling back to savepoint %q with error %q", savepoint, errRollback)
+		}
+		return err
+	}
+	if _, err := inner.tx.ExecContext(ctx, fmt.Sprintf("RELEASE SAVEPOINT %s", savepoint)); err != nil {
+		return go_errors.Wrapf(err, "Failed releasing savepoint %q", savepoint)
+	}
+	return nil
+}
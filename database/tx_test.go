@@ -0,0 +1,303 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	go_database_mock "github.com/caigwatkin/go/database/mock"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+type sqlStateError struct {
+	code       string
+	constraint string
+}
+
+func (e sqlStateError) Error() string {
+	return fmt.Sprintf("SQLSTATE %s on constraint %q", e.code, e.constraint)
+}
+
+func (e sqlStateError) SQLState() string {
+	return e.code
+}
+
+func (e sqlStateError) ConstraintName() string {
+	return e.constraint
+}
+
+func TestStatusFromError(t *testing.T) {
+	type expected struct {
+		Code  int
+		Items []go_errors.Item
+	}
+	var data = []struct {
+		desc     string
+		input    error
+		expected expected
+	}{
+		{
+			desc:  "no rows",
+			input: go_errors.Wrap(sql.ErrNoRows, "Failed scanning"),
+			expected: expected{
+				Code: http.StatusNotFound,
+			},
+		},
+
+		{
+			desc:  "postgres unique violation",
+			input: sqlStateError{code: "23505", constraint: "things_name_key"},
+			expected: expected{
+				Code: http.StatusConflict,
+				Items: []go_errors.Item{
+					{Field: "things_name_key", Message: "MUST_BE_UNIQUE"},
+				},
+			},
+		},
+
+		{
+			desc:  "postgres foreign key violation",
+			input: go_errors.Wrap(sqlStateError{code: "23503", constraint: "things_owner_id_fkey"}, "Failed inserting"),
+			expected: expected{
+				Code: http.StatusUnprocessableEntity,
+				Items: []go_errors.Item{
+					{Field: "things_owner_id_fkey", Message: "MUST_REFERENCE_EXISTING"},
+				},
+			},
+		},
+
+		{
+			desc:  "mysql unique violation",
+			input: errors.New("Error 1062: Duplicate entry 'a' for key 'things.name'"),
+			expected: expected{
+				Code: http.StatusConflict,
+				Items: []go_errors.Item{
+					{Field: "things.name", Message: "MUST_BE_UNIQUE"},
+				},
+			},
+		},
+
+		{
+			desc:  "mysql foreign key violation",
+			input: errors.New("Error 1452: Cannot add or update a child row: a foreign key constraint fails (`db`.`things`, CONSTRAINT `things_ibfk_1` FOREIGN KEY (`owner_id`) REFERENCES `owners` (`id`))"),
+			expected: expected{
+				Code: http.StatusUnprocessableEntity,
+				Items: []go_errors.Item{
+					{Field: "things_ibfk_1", Message: "MUST_REFERENCE_EXISTING"},
+				},
+			},
+		},
+
+		{
+			desc:  "unclassified",
+			input: errors.New("connection reset"),
+			expected: expected{
+				Code: 0,
+			},
+		},
+	}
+
+	for i, d := range data {
+		result := StatusFromError(d.input, nil)
+
+		if go_errors.StatusCode(result) != d.expected.Code {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "go_errors.StatusCode(result)",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input.Error(),
+				Expected:   d.expected.Code,
+				Result:     go_errors.StatusCode(result),
+			}))
+		}
+		if s, ok := result.(go_errors.Status); ok && !reflect.DeepEqual(s.Items, d.expected.Items) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result.Items",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input.Error(),
+				Expected:   d.expected.Items,
+				Result:     s.Items,
+			}))
+		}
+	}
+}
+
+func newMockDB(t *testing.T, name string) (*go_database_mock.Database, *sql.DB) {
+	mock := go_database_mock.NewDatabase(name)
+	db, err := sql.Open(go_database_mock.DriverName, go_database_mock.Url(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return mock, db
+}
+
+func TestInTx(t *testing.T) {
+	type expected struct {
+		Code      int
+		Attempts  int
+		Commits   int
+		Rollbacks int
+	}
+	var data = []struct {
+		desc     string
+		input    []error
+		expected expected
+	}{
+		{
+			desc:  "commit",
+			input: []error{nil},
+			expected: expected{
+				Attempts: 1,
+				Commits:  1,
+			},
+		},
+
+		{
+			desc:  "rollback with status",
+			input: []error{sqlStateError{code: "23505", constraint: "things_name_key"}},
+			expected: expected{
+				Code:      http.StatusConflict,
+				Attempts:  1,
+				Rollbacks: 1,
+			},
+		},
+
+		{
+			desc:  "retry serialization failure",
+			input: []error{sqlStateError{code: "40001"}, sqlStateError{code: "40P01"}, nil},
+			expected: expected{
+				Attempts:  3,
+				Commits:   1,
+				Rollbacks: 2,
+			},
+		},
+	}
+
+	for i, d := range data {
+		mock, db := newMockDB(t, fmt.Sprintf("TestInTx%d", i))
+		var attempts int
+		err := InTx(context.Background(), db, &TxOptions{Backoff: time.Millisecond}, func(ctx context.Context, tx *sql.Tx) error {
+			attempts++
+			return d.input[attempts-1]
+		})
+		_, commits, rollbacks := mock.Counts()
+		result := expected{
+			Code:      go_errors.StatusCode(err),
+			Attempts:  attempts,
+			Commits:   commits,
+			Rollbacks: rollbacks,
+		}
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestInTxNested(t *testing.T) {
+	mock, db := newMockDB(t, "TestInTxNested")
+	errInner := errors.New("inner")
+	err := InTx(context.Background(), db, nil, func(ctx context.Context, tx *sql.Tx) error {
+		if err := InTx(ctx, db, nil, func(ctx context.Context, inner *sql.Tx) error {
+			if inner != tx {
+				t.Error("Expected nested transaction to be the outer transaction")
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := InTx(ctx, db, nil, func(ctx context.Context, _ *sql.Tx) error {
+			return errInner
+		}); err != errInner {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Expected:   errInner.Error(),
+				Result:     err,
+			}))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var queries []string
+	for _, s := range mock.Recorded() {
+		queries = append(queries, s.Query)
+	}
+	expected := []string{
+		"SAVEPOINT sp_1",
+		"RELEASE SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"ROLLBACK TO SAVEPOINT sp_1",
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "queries",
+			Expected:   expected,
+			Result:     queries,
+		}))
+	}
+	if begins, commits, _ := mock.Counts(); begins != 1 || commits != 1 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "begins, commits",
+			Expected:   []int{1, 1},
+			Result:     []int{begins, commits},
+		}))
+	}
+}
+
+func TestInTxPanic(t *testing.T) {
+	mock, db := newMockDB(t, "TestInTxPanic")
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "recover()",
+				Expected:   "boom",
+				Result:     p,
+			}))
+		}
+		if _, commits, rollbacks := mock.Counts(); commits != 0 || rollbacks != 1 {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "commits, rollbacks",
+				Expected:   []int{0, 1},
+				Result:     []int{commits, rollbacks},
+			}))
+		}
+	}()
+	InTx(context.Background(), db, nil, func(ctx context.Context, _ *sql.Tx) error {
+		panic("boom")
+	})
+}
@@ -1,32 +1,52 @@
 package environment
 
 import (
-	"log"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	go_errors "github.com/caigwatkin/go/errors"
 )
 
 type Environment struct {
-	App              string
-	DatabaseUrl      string
-	Debug            bool
-	Remote           bool
-	Port             int64
-	WorkingDirectory string
+	App               string
+	DatabaseUrl       string `log:"redact"` // May have a password
+	Debug             bool
+	DebugProdOverride bool
+	Remote            bool
+	Port              int64
+	Stage             Stage
+	WorkingDirectory  string
 }
 
-// TODO: test
-func New(app string) (env Environment, err error) {
-	log.Println("Generating environment", app)
+// secretVariables of the environment, which are redacted by Environ
+var secretVariables = []string{
+	"DATABASE_URL",
+}
 
+// New environment from environment variables
+//
+// STAGE defaults to local, or to prod with a warning when remote, so existing remote deployments keep the prod guard rails until STAGE is set
+func New(app string) (env Environment, err error) {
 	databaseUrl := os.Getenv("DATABASE_URL")
 
 	remote := os.Getenv("REMOTE") != "" ||
 		os.Getenv("DYNO") != ""
 
-	debug := !remote
+	stage := StageLocal
+	if osStage := os.Getenv("STAGE"); osStage != "" {
+		stage, err = ParseStage(osStage)
+		if err != nil {
+			err = go_errors.Wrap(err, "Failed to parse environment variable STAGE")
+			return
+		}
+	} else if remote {
+		stage = StageProd
+		fmt.Fprintln(os.Stderr, "Missing environment variable STAGE when remote, defaulting to", stage)
+	}
+
+	debug := !remote && !stage.IsProd()
 	if osDebug := os.Getenv("DEBUG"); osDebug != "" {
 		debug, err = strconv.ParseBool(osDebug)
 		if err != nil {
@@ -35,6 +55,15 @@ func New(app string) (env Environment, err error) {
 		}
 	}
 
+	var debugProdOverride bool
+	if osDebugProdOverride := os.Getenv("DEBUG_PROD_OVERRIDE"); osDebugProdOverride != "" {
+		debugProdOverride, err = strconv.ParseBool(osDebugProdOverride)
+		if err != nil {
+			err = go_errors.Wrap(err, "Failed to parse environment variable DEBUG_PROD_OVERRIDE")
+			return
+		}
+	}
+
 	port := int64(8080)
 	if osPort := os.Getenv("PORT"); osPort != "" {
 		port, err = strconv.ParseInt(osPort, 10, 0)
@@ -51,14 +80,57 @@ func New(app string) (env Environment, err error) {
 	}
 
 	env = Environment{
-		App:              app,
-		DatabaseUrl:      databaseUrl,
-		Debug:            debug,
-		Remote:           remote,
-		Port:             port,
-		WorkingDirectory: workingDirectory,
+		App:               app,
+		DatabaseUrl:       databaseUrl,
+		Debug:             debug,
+		DebugProdOverride: debugProdOverride,
+		Remote:            remote,
+		Port:              port,
+		Stage:             stage,
+		WorkingDirectory:  workingDirectory,
+	}
+	if err = env.Validate(); err != nil {
+		err = go_errors.Wrap(err, "Failed to validate environment")
+		return
 	}
 
-	log.Println("Generated environment", env)
 	return
 }
+
+// Validate the environment against the guard rails for its stage
+//
+// Debug is forbidden in prod unless explicitly overridden, as debug logging may include request and response bodies
+func (e Environment) Validate() error {
+	if err := e.Stage.Validate(); err != nil {
+		return err
+	}
+	if e.Stage.IsProd() && e.Debug && !e.DebugProdOverride {
+		return go_errors.New("Debug is forbidden in prod unless DEBUG_PROD_OVERRIDE is set")
+	}
+	return nil
+}
+
+// DebugEnabled returns true if debug is on and allowed for the stage
+//
+// Use this rather than Debug directly so that the prod guard rail holds for environments not generated with New
+func (e Environment) DebugEnabled() bool {
+	return e.Debug && e.DebugAllowed()
+}
+
+// DebugAllowed returns true if debug may be turned on for the stage, at boot or at runtime
+func (e Environment) DebugAllowed() bool {
+	return !e.Stage.IsProd() || e.DebugProdOverride
+}
+
+// Environ of the process, as by os.Environ, with the values of variables which may have secrets redacted, for logging
+func Environ() []string {
+	environ := os.Environ()
+	for i, v := range environ {
+		for _, s := range secretVariables {
+			if strings.HasPrefix(v, s+"=") {
+				environ[i] = s + "=[REDACTED]"
+			}
+		}
+	}
+	return environ
+}
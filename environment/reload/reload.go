@@ -0,0 +1,415 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_log "github.com/caigwatkin/go/log"
+)
+
+// Client interface for reloadable configuration values
+//
+// Only values registered with the client are reloadable, all other keys in the sources stay fixed after boot
+// Registering a key again returns its value if registered as the same kind, and panics otherwise
+type Client interface {
+	Bool(key string, fallback bool) *Bool
+	Duration(key string, fallback time.Duration) *Duration
+	Int64(key string, fallback int64) *Int64
+	String(key string, fallback string) *String
+	Secret(key string, fallback string) *String
+	Reload(ctx context.Context) error
+	Close() error
+}
+
+// Config for reloading
+//
+// Sources are the file and the endpoint, values from the endpoint take precedence over values from the file
+// Triggers are the file changing, a SIGHUP, and the endpoint poll interval
+type Config struct {
+	File                 string        // Path to a file of KEY=VALUE lines, or a JSON object of values if the extension is .json
+	FilePollInterval     time.Duration // Interval to check the file for changes, defaults to five seconds if a file is given
+	Endpoint             string        // URL responding with a JSON object of values
+	EndpointPollInterval time.Duration // Interval to poll the endpoint, zero to only load the endpoint on other triggers
+	Sighup               bool          // Reload on SIGHUP
+}
+
+const (
+	filePollIntervalDefault = time.Second * 5
+
+	redacted = "REDACTED"
+)
+
+// NewClient loads the sources and starts watching for changes
+//
+// Close the client to stop watching
+func NewClient(ctx context.Context, config Config, logClient go_log.Client) (Client, error) {
+	logClient = logClient.Named("reload")
+	logClient.Info(ctx, "Initializing", go_log.FmtAny(config, "config"))
+
+	if config.File != "" && config.FilePollInterval <= 0 {
+		config.FilePollInterval = filePollIntervalDefault
+	}
+
+	ctxWatch, cancel := context.WithCancel(go_context.Background())
+	c := &client{
+		cancel:     cancel,
+		config:     config,
+		httpClient: &http.Client{Timeout: time.Second * 10},
+		ignored:    make(map[string]string),
+		logClient:  logClient,
+		values:     make(map[string]*value),
+	}
+
+	raw, err := c.load(ctx)
+	if err != nil {
+		cancel()
+		return nil, go_errors.Wrap(err, "Failed loading sources")
+	}
+	c.raw = raw
+	c.boot = raw
+	if config.File != "" {
+		c.fileStat, _ = os.Stat(config.File)
+	}
+
+	c.watch(ctxWatch)
+
+	logClient.Info(ctx, "Initialized", go_log.FmtInt(len(raw), "len(raw)"))
+	return c, nil
+}
+
+type client struct {
+	boot       map[string]string
+	cancel     context.CancelFunc
+	config     Config
+	fileStat   os.FileInfo
+	httpClient *http.Client
+	ignored    map[string]string // Changes to values which are not reloadable, which are warned of once
+	logClient  go_log.Client
+	mutex      sync.Mutex
+	raw        map[string]string
+	reloading  sync.Mutex // Held while loading and applying sources, so a slower reload does not apply older sources
+	values     map[string]*value
+	wg         sync.WaitGroup
+}
+
+// Bool registers a reloadable bool value
+func (c *client) Bool(key string, fallback bool) *Bool {
+	return &Bool{c.register(key, "bool", fallback, false, parseBool)}
+}
+
+// Duration registers a reloadable duration value, parsed with time.ParseDuration
+func (c *client) Duration(key string, fallback time.Duration) *Duration {
+	return &Duration{c.register(key, "duration", fallback, false, parseDuration)}
+}
+
+// Int64 registers a reloadable int64 value
+func (c *client) Int64(key string, fallback int64) *Int64 {
+	return &Int64{c.register(key, "int64", fallback, false, parseInt64)}
+}
+
+// String registers a reloadable string value
+func (c *client) String(key string, fallback string) *String {
+	return &String{c.register(key, "string", fallback, false, parseString)}
+}
+
+// Secret registers a reloadable string value which is redacted when logged
+func (c *client) Secret(key string, fallback string) *String {
+	return &String{c.register(key, "secret", fallback, true, parseString)}
+}
+
+// register a value of the kind, returning the existing value if the key is already registered as the kind
+//
+// Registering a key as another kind panics, as its value could not be loaded as both
+// If the current sources have a value for the key which fails to parse, the fallback is used
+func (c *client) register(key, kind string, fallback interface{}, redact bool, parse func(string) (interface{}, error)) *value {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if v, ok := c.values[key]; ok {
+		if v.kind != kind {
+			panic(go_errors.Errorf("Key %q is registered as a %s value, so cannot be registered as a %s value", key, v.kind, kind))
+		}
+		return v
+	}
+	v := newValue(key, kind, fallback, redact, parse)
+	if s, ok := c.raw[key]; ok {
+		parsed, err := parse(s)
+		if err != nil {
+			c.logClient.Warn(go_context.StartUp(), "Failed parsing value, using fallback",
+				go_log.FmtString(key, "key"),
+				go_log.FmtError(err),
+			)
+		} else {
+			v.store(parsed)
+		}
+	}
+	c.values[key] = v
+	return v
+}
+
+// Reload values from the sources
+//
+// Registered values which have changed are swapped and their watchers notified, changes to other keys are ignored
+// Reloads are serialized, so concurrent triggers apply the sources in the order they are loaded
+func (c *client) Reload(ctx context.Context) error {
+	changes, err := c.apply(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Notified after unlocking, so watchers may register, load and reload values
+	for _, v := range changes {
+		v.value.notify(v.old, v.new)
+	}
+	return nil
+}
+
+// apply the sources, returning the changes to registered values
+func (c *client) apply(ctx context.Context) ([]change, error) {
+	c.reloading.Lock()
+	defer c.reloading.Unlock()
+	raw, err := c.load(ctx)
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed loading sources")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var changes []change
+	for key, s := range raw {
+		if _, ok := c.values[key]; ok {
+			continue
+		}
+		if boot, ok := c.boot[key]; (!ok || boot != s) && c.ignored[key] != s {
+			c.logClient.Warn(ctx, "Ignoring change to value which is not reloadable", go_log.FmtString(key, "key"))
+			c.ignored[key] = s
+		}
+	}
+	for key, v := range c.values {
+		s, ok := raw[key]
+		if !ok || s == c.raw[key] {
+			continue
+		}
+		parsed, err := v.parse(s)
+		if err != nil {
+			c.logClient.Warn(ctx, "Failed parsing reloaded value, keeping old value",
+				go_log.FmtString(key, "key"),
+				go_log.FmtError(err),
+			)
+			continue
+		}
+		old := v.swap(parsed)
+		if old == parsed {
+			continue
+		}
+		c.logClient.Info(ctx, "Reloaded value",
+			go_log.FmtString(key, "key"),
+			go_log.FmtString(v.fmt(old), "old"),
+			go_log.FmtString(v.fmt(parsed), "new"),
+		)
+		changes = append(changes, change{v, old, parsed})
+	}
+	c.raw = raw
+	return changes, nil
+}
+
+// change to a value, for notifying its watchers
+type change struct {
+	value *value
+	old   interface{}
+	new   interface{}
+}
+
+// Close stops watching for changes
+func (c *client) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	return nil
+}
+
+func (c *client) load(ctx context.Context) (map[string]string, error) {
+	raw := make(map[string]string)
+	if c.config.File != "" {
+		b, err := ioutil.ReadFile(c.config.File)
+		if err != nil {
+			return nil, go_errors.Wrapf(err, "Failed reading file %q", c.config.File)
+		}
+		var values map[string]string
+		if strings.EqualFold(filepath.Ext(c.config.File), ".json") {
+			values, err = parseJSON(b)
+		} else {
+			values, err = parseLines(b)
+		}
+		if err != nil {
+			return nil, go_errors.Wrapf(err, "Failed parsing file %q", c.config.File)
+		}
+		for k, v := range values {
+			raw[k] = v
+		}
+	}
+	if c.config.Endpoint != "" {
+		values, err := c.loadEndpoint(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range values {
+			raw[k] = v
+		}
+	}
+	return raw, nil
+}
+
+func (c *client) loadEndpoint(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.Endpoint, nil)
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed creating endpoint request")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, go_errors.Wrapf(err, "Failed requesting endpoint %q", c.config.Endpoint)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, go_errors.Errorf("Unexpected status code %d from endpoint %q", resp.StatusCode, c.config.Endpoint)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed reading endpoint response body")
+	}
+	values, err := parseJSON(b)
+	if err != nil {
+		return nil, go_errors.Wrapf(err, "Failed parsing endpoint %q response body", c.config.Endpoint)
+	}
+	return values, nil
+}
+
+// watch for triggers until ctx is done
+func (c *client) watch(ctx context.Context) {
+	if c.config.File != "" {
+		c.every(ctx, c.config.FilePollInterval, func() bool {
+			stat, err := os.Stat(c.config.File)
+			if err != nil {
+				c.logClient.Error(ctx, "Failed checking file for changes", go_log.FmtError(err))
+				return false
+			}
+			changed := c.fileStat == nil || !stat.ModTime().Equal(c.fileStat.ModTime()) || stat.Size() != c.fileStat.Size()
+			c.fileStat = stat
+			return changed
+		})
+	}
+	if c.config.Endpoint != "" && c.config.EndpointPollInterval > 0 {
+		c.every(ctx, c.config.EndpointPollInterval, func() bool {
+			return true
+		})
+	}
+	if c.config.Sighup {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer signal.Stop(ch)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ch:
+					c.logClient.Info(ctx, "Received SIGHUP, reloading")
+					c.reload(ctx)
+				}
+			}
+		}()
+	}
+}
+
+// every interval, reload if triggered
+func (c *client) every(ctx context.Context, interval time.Duration, triggered func() bool) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if triggered() {
+					c.reload(ctx)
+				}
+			}
+		}
+	}()
+}
+
+func (c *client) reload(ctx context.Context) {
+	if err := c.Reload(go_context.New(ctx)); err != nil {
+		c.logClient.Error(ctx, "Failed reloading", go_log.FmtError(err))
+	}
+}
+
+func parseLines(b []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, go_errors.Errorf("Line %d is not a KEY=VALUE pair", n)
+		}
+		values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, go_errors.Wrap(err, "Failed scanning lines")
+	}
+	return values, nil
+}
+
+func parseJSON(b []byte) (map[string]string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(b, &object); err != nil {
+		return nil, go_errors.Wrap(err, "Failed unmarshalling JSON object")
+	}
+	values := make(map[string]string, len(object))
+	for k, v := range object {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			values[k] = s
+			continue
+		}
+		values[k] = string(v)
+	}
+	return values, nil
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reload
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	go_log "github.com/caigwatkin/go/log"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestReloadFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.env")
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# comment\nLOG_LEVEL=INFO\nTOGGLE=false\nTIMEOUT=1s\nFIXED=boot\n")
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, Config{File: file, FilePollInterval: time.Hour}, go_log_mock.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	logLevel := c.String("LOG_LEVEL", "DEBUG")
+	toggle := c.Bool("TOGGLE", true)
+	timeout := c.Duration("TIMEOUT", 0)
+	missing := c.Int64("MISSING", 7)
+
+	var changes []string
+	cancel := toggle.Watch(func(old, new bool) {
+		changes = append(changes, fmt.Sprintf("%t->%t", old, new))
+	})
+	defer cancel()
+
+	type values struct {
+		LogLevel string
+		Toggle   bool
+		Timeout  time.Duration
+		Missing  int64
+	}
+	var data = []struct {
+		desc     string
+		input    string
+		expected values
+	}{
+		{
+			desc:  "boot",
+			input: "",
+			expected: values{
+				LogLevel: "INFO",
+				Toggle:   false,
+				Timeout:  time.Second,
+				Missing:  7,
+			},
+		},
+
+		{
+			desc:  "changed",
+			input: "LOG_LEVEL=WARN\nTOGGLE=true\nTIMEOUT=2s\nFIXED=changed\n",
+			expected: values{
+				LogLevel: "WARN",
+				Toggle:   true,
+				Timeout:  time.Second * 2,
+				Missing:  7,
+			},
+		},
+
+		{
+			desc:  "invalid value keeps old value",
+			input: "LOG_LEVEL=WARN\nTOGGLE=true\nTIMEOUT=forever\n",
+			expected: values{
+				LogLevel: "WARN",
+				Toggle:   true,
+				Timeout:  time.Second * 2,
+				Missing:  7,
+			},
+		},
+
+		{
+			desc:  "removed key keeps old value",
+			input: "TOGGLE=false\nMISSING=8\n",
+			expected: values{
+				LogLevel: "WARN",
+				Toggle:   false,
+				Timeout:  time.Second * 2,
+				Missing:  8,
+			},
+		},
+	}
+
+	for i, d := range data {
+		if d.input != "" {
+			write(d.input)
+			if err := c.Reload(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		result := values{
+			LogLevel: logLevel.Load(),
+			Toggle:   toggle.Load(),
+			Timeout:  timeout.Load(),
+			Missing:  missing.Load(),
+		}
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+
+	expectedChanges := []string{"false->true", "true->false"}
+	if !reflect.DeepEqual(changes, expectedChanges) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "changes",
+			Expected:   expectedChanges,
+			Result:     changes,
+		}))
+	}
+}
+
+func TestReloadWatcherReentrant(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.env")
+	if err := ioutil.WriteFile(file, []byte("TOGGLE=false\nNAME=a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, Config{File: file, FilePollInterval: time.Hour}, go_log_mock.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var result []string
+	toggle := c.Bool("TOGGLE", false)
+	cancel := toggle.Watch(func(old, new bool) {
+		if err := c.Reload(ctx); err != nil {
+			t.Error(err)
+		}
+		result = append(result, c.String("NAME", "").Load())
+	})
+	defer cancel()
+
+	if err := ioutil.WriteFile(file, []byte("TOGGLE=true\nNAME=b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- c.Reload(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Reload deadlocked with a watcher which reloads and registers values")
+	}
+
+	expected := []string{"b"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result",
+			Expected:   expected,
+			Result:     result,
+		}))
+	}
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	var mutex sync.Mutex
+	body := `{"FEATURE": true, "LIMIT": 10, "NAME": "a"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, Config{Endpoint: server.URL, EndpointPollInterval: time.Millisecond * 10}, go_log_mock.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	feature := c.Bool("FEATURE", false)
+	limit := c.Int64("LIMIT", 0)
+	name := c.Secret("NAME", "")
+	if !feature.Load() || limit.Load() != 10 || name.Load() != "a" {
+		t.Fatal(go_testing.Errorf(go_testing.Error{
+			Unexpected: "boot values",
+			Expected:   []interface{}{true, 10, "a"},
+			Result:     []interface{}{feature.Load(), limit.Load(), name.Load()},
+		}))
+	}
+
+	changed := make(chan int64, 1)
+	limit.Watch(func(_, new int64) {
+		changed <- new
+	})
+	mutex.Lock()
+	body = `{"FEATURE": true, "LIMIT": 20, "NAME": "b"}`
+	mutex.Unlock()
+
+	select {
+	case v := <-changed:
+		if v != 20 {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "watched value",
+				Expected:   20,
+				Result:     v,
+			}))
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for polled endpoint change")
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	type expected struct {
+		Values map[string]string
+		Err    bool
+	}
+	var data = []struct {
+		desc     string
+		input    string
+		expected expected
+	}{
+		{
+			desc:  "pairs, comments, and blank lines",
+			input: "A=1\n\n# comment\n B = two words \nC=x=y\n",
+			expected: expected{
+				Values: map[string]string{
+					"A": "1",
+					"B": "two words",
+					"C": "x=y",
+				},
+			},
+		},
+
+		{
+			desc:  "not a pair",
+			input: "A\n",
+			expected: expected{
+				Err: true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		result, err := parseLines([]byte(d.input))
+
+		if !reflect.DeepEqual(result, d.expected.Values) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected.Values,
+				Result:     result,
+			}))
+		}
+		if (err != nil) != d.expected.Err {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected.Err,
+				Result:     err,
+			}))
+		}
+	}
+}
+
+func TestReloadSerialized(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var mutex sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests++
+		n := requests
+		mutex.Unlock()
+		switch n {
+		case 1:
+			fmt.Fprint(w, `{"NAME": "boot"}`)
+		case 2:
+			close(started)
+			<-release
+			fmt.Fprint(w, `{"NAME": "older"}`)
+		default:
+			fmt.Fprint(w, `{"NAME": "newer"}`)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, Config{Endpoint: server.URL}, go_log_mock.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	name := c.String("NAME", "")
+
+	var wg sync.WaitGroup
+	reload := func() {
+		defer wg.Done()
+		if err := c.Reload(ctx); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(2)
+	go reload()
+	<-started
+	go reload()
+	time.Sleep(time.Millisecond * 50) // For the second reload to load, if not serialized
+	close(release)
+	wg.Wait()
+
+	if result := name.Load(); result != "newer" {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result",
+			Expected:   "newer",
+			Result:     result,
+		}))
+	}
+}
+
+func TestReloadWarnsOfIgnoredChangeOnce(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.env")
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("FIXED=boot\n")
+
+	ctx := context.Background()
+	logClient := go_log_mock.NewRecorder(t)
+	c, err := NewClient(ctx, Config{File: file, FilePollInterval: time.Hour}, logClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var result []int
+	for _, v := range []string{"changed", "changed", "changed again", "changed again"} {
+		write("FIXED=" + v + "\n")
+		if err := c.Reload(ctx); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, len(logClient.Entries(go_log.SeverityWarn)))
+	}
+
+	expected := []int{1, 1, 2, 2}
+	if !reflect.DeepEqual(result, expected) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result",
+			Expected:   expected,
+			Result:     result,
+		}))
+	}
+}
+
+func TestRegisterOtherKind(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient(ctx, Config{}, go_log_mock.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.String("KEY", "a").v != c.String("KEY", "b").v {
+		t.Error("Expected the value registered for the key")
+	}
+
+	defer func() {
+		r := recover()
+		if err, ok := r.(error); !ok || !strings.Contains(err.Error(), `Key "KEY" is registered as a string value, so cannot be registered as a bool value`) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "recover()",
+				Expected:   "panic registering the key as another kind",
+				Result:     r,
+			}))
+		}
+	}()
+	c.Bool("KEY", false)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reload
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// value which is swapped atomically, so is safe for concurrent readers
+type value struct {
+	current  atomic.Value
+	key      string
+	kind     string // Registered as, e.g. "bool"
+	mutex    sync.Mutex
+	nextId   int
+	parse    func(string) (interface{}, error)
+	redact   bool
+	watchers map[int]func(old, new interface{})
+}
+
+// box so that atomic.Value always stores the same concrete type
+type box struct {
+	v interface{}
+}
+
+func newValue(key, kind string, fallback interface{}, redact bool, parse func(string) (interface{}, error)) *value {
+	v := &value{
+		key:      key,
+		kind:     kind,
+		parse:    parse,
+		redact:   redact,
+		watchers: make(map[int]func(old, new interface{})),
+	}
+	v.store(fallback)
+	return v
+}
+
+func (v *value) load() interface{} {
+	return v.current.Load().(box).v
+}
+
+func (v *value) store(new interface{}) {
+	v.current.Store(box{new})
+}
+
+func (v *value) swap(new interface{}) interface{} {
+	old := v.load()
+	v.store(new)
+	return old
+}
+
+func (v *value) fmt(x interface{}) string {
+	if v.redact {
+		return redacted
+	}
+	return fmt.Sprint(x)
+}
+
+func (v *value) watch(fn func(old, new interface{})) func() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	id := v.nextId
+	v.nextId++
+	v.watchers[id] = fn
+	return func() {
+		v.mutex.Lock()
+		defer v.mutex.Unlock()
+
+		delete(v.watchers, id)
+	}
+}
+
+func (v *value) notify(old, new interface{}) {
+	v.mutex.Lock()
+	watchers := make([]func(old, new interface{}), 0, len(v.watchers))
+	for _, fn := range v.watchers {
+		watchers = append(watchers, fn)
+	}
+	v.mutex.Unlock()
+
+	for _, fn := range watchers {
+		fn(old, new)
+	}
+}
+
+// Bool value which may be reloaded
+type Bool struct {
+	v *value
+}
+
+// Load the current value
+func (b *Bool) Load() bool {
+	return b.v.load().(bool)
+}
+
+// Watch for changes to the value, returning a func to stop watching
+//
+// Watchers are called synchronously after the value is swapped
+func (b *Bool) Watch(fn func(old, new bool)) func() {
+	return b.v.watch(func(old, new interface{}) {
+		fn(old.(bool), new.(bool))
+	})
+}
+
+// Duration value which may be reloaded
+type Duration struct {
+	v *value
+}
+
+// Load the current value
+func (d *Duration) Load() time.Duration {
+	return d.v.load().(time.Duration)
+}
+
+// Watch for changes to the value, returning a func to stop watching
+//
+// Watchers are called synchronously after the value is swapped
+func (d *Duration) Watch(fn func(old, new time.Duration)) func() {
+	return d.v.watch(func(old, new interface{}) {
+		fn(old.(time.Duration), new.(time.Duration))
+	})
+}
+
+// Int64 value which may be reloaded
+type Int64 struct {
+	v *value
+}
+
+// Load the current value
+func (i *Int64) Load() int64 {
+	return i.v.load().(int64)
+}
+
+// Watch for changes to the value, returning a func to stop watching
+//
+// Watchers are called synchronously after the value is swapped
+func (i *Int64) Watch(fn func(old, new int64)) func() {
+	return i.v.watch(func(old, new interface{}) {
+		fn(old.(int64), new.(int64))
+	})
+}
+
+// String value which may be reloaded
+type String struct {
+	v *value
+}
+
+// Load the current value
+func (s *String) Load() string {
+	return s.v.load().(string)
+}
+
+// Watch for changes to the value, returning a func to stop watching
+//
+// Watchers are called synchronously after the value is swapped
+func (s *String) Watch(fn func(old, new string)) func() {
+	return s.v.watch(func(old, new interface{}) {
+		fn(old.(string), new.(string))
+	})
+}
+
+func parseBool(s string) (interface{}, error) {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, go_errors.Wrapf(err, "Failed parsing %q as bool", s)
+	}
+	return b, nil
+}
+
+func parseDuration(s string) (interface{}, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, go_errors.Wrapf(err, "Failed parsing %q as duration", s)
+	}
+	return d, nil
+}
+
+func parseInt64(s string) (interface{}, error) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, go_errors.Wrapf(err, "Failed parsing %q as int64", s)
+	}
+	return i, nil
+}
+
+func parseString(s string) (interface{}, error) {
+	return s, nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package environment
+
+import (
+	"strings"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// Stage of deployment
+//
+// The string value is the friendly name of the stage, used for file naming
+type Stage string
+
+// Stage enums
+const (
+	StageLocal   Stage = "local"
+	StageDev     Stage = "dev"
+	StageStaging Stage = "staging"
+	StageProd    Stage = "prod"
+)
+
+// Stages in order of deployment
+var Stages = []Stage{
+	StageLocal,
+	StageDev,
+	StageStaging,
+	StageProd,
+}
+
+// ParseStage from its friendly name, case insensitive
+func ParseStage(s string) (Stage, error) {
+	stage := Stage(strings.ToLower(strings.TrimSpace(s)))
+	if err := stage.Validate(); err != nil {
+		return "", err
+	}
+	return stage, nil
+}
+
+// Validate that the stage is one of the stage enums
+func (s Stage) Validate() error {
+	for _, v := range Stages {
+		if s == v {
+			return nil
+		}
+	}
+	return go_errors.Errorf("Invalid stage %q, must be one of %q", string(s), Stages)
+}
+
+// IsProd returns true if the stage is prod
+func (s Stage) IsProd() bool {
+	return s == StageProd
+}
+
+// TestModeAllowed returns true if requests may run in test mode for the stage
+func (s Stage) TestModeAllowed() bool {
+	return !s.IsProd()
+}
+
+// String so that Stage implements fmt.Stringer
+func (s Stage) String() string {
+	return string(s)
+}
+
+// Set so that Stage implements flag.Value
+func (s *Stage) Set(value string) error {
+	stage, err := ParseStage(value)
+	if err != nil {
+		return err
+	}
+	*s = stage
+	return nil
+}
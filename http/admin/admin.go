@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+	go_headers "github.com/caigwatkin/go/http/headers"
+	go_render "github.com/caigwatkin/go/http/render"
+	go_log "github.com/caigwatkin/go/log"
+	"github.com/go-chi/chi/v5"
+)
+
+// LogLevelPath at which the log level handlers are mounted
+const LogLevelPath = "/admin/log/level"
+
+// MountLogLevel handlers on the router for getting and putting the log level
+//
+// The router should restrict access, e.g. with authentication middleware, as the handlers are not protected
+//
+// A PUT body may contain any of:
+//   - "min", the min severity, e.g. "INFO"
+//   - "overrides", replacing all overrides, e.g. {"github.com/caigwatkin/go/database": "DEBUG"}
+//   - "debugFor", a duration for which everything is logged, e.g. "10m", or "0s" to end it
+//
+// Updates enabling debug are forbidden if the level forbids debug, which the log client does in prod, see go_log.Level.ForbidDebug
+//
+// PUTs are audited with the actor of the request context, see go_context.WithActor, and updates are not applied unless
+// audited
+func MountLogLevel(router chi.Router, headersClient go_headers.Client, logClient go_log.Client, auditLogger go_log.AuditLogger, level *go_log.Level) {
+	router.Get(LogLevelPath, getLogLevel(headersClient, logClient, level))
+	router.Put(LogLevelPath, putLogLevel(headersClient, logClient, auditLogger, level))
+}
+
+// auditActionLogLevel of PUTs of the log level
+const auditActionLogLevel = "log.level.update"
+
+type logLevel struct {
+	Min        go_log.Severity            `json:"min"`
+	Overrides  map[string]go_log.Severity `json:"overrides"`
+	DebugUntil *time.Time                 `json:"debugUntil,omitempty"`
+}
+
+type logLevelUpdate struct {
+	Min       *go_log.Severity           `json:"min"`
+	Overrides map[string]go_log.Severity `json:"overrides"`
+	DebugFor  *string                    `json:"debugFor"`
+}
+
+func getLogLevel(headersClient go_headers.Client, logClient go_log.Client, level *go_log.Level) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderLogLevel(headersClient, logClient, level, w, r)
+	}
+}
+
+func putLogLevel(headersClient go_headers.Client, logClient go_log.Client, auditLogger go_log.AuditLogger, level *go_log.Level) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// fail the request, rendering the status, once the failure is audited
+		fail := func(outcome go_log.AuditOutcome, s go_errors.Status, details ...go_log.Field) {
+			if err := auditLogger.Audit(ctx, auditActionLogLevel, LogLevelPath, outcome, append(details, go_log.FmtString(s.Message, "message"))...); err != nil {
+				go_render.ErrorOrStatus(ctx, headersClient, logClient, w, go_errors.Wrap(err, "Failed auditing log level update"))
+				return
+			}
+			go_render.Status(ctx, headersClient, logClient, w, s)
+		}
+		var update logLevelUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			fail(go_log.AuditOutcomeFailure, go_errors.NewStatusWithCause(err, http.StatusBadRequest, "Malformed body"))
+			return
+		}
+		details := go_log.FmtAny(update, "update")
+		var debugFor time.Duration
+		if update.DebugFor != nil {
+			d, err := time.ParseDuration(*update.DebugFor)
+			if err != nil || d < 0 {
+				fail(go_log.AuditOutcomeFailure, go_errors.NewStatus(http.StatusBadRequest, "Invalid debugFor, must be a non-negative duration, e.g. \"10m\""), details)
+				return
+			}
+			debugFor = d
+		}
+		if level.DebugForbidden() && enablesDebug(update, debugFor) {
+			fail(go_log.AuditOutcomeDenied, go_errors.NewStatus(http.StatusForbidden, "Debug is forbidden for the stage"), details)
+			return
+		}
+		if err := auditLogger.Audit(ctx, auditActionLogLevel, LogLevelPath, go_log.AuditOutcomeSuccess, details); err != nil {
+			go_render.ErrorOrStatus(ctx, headersClient, logClient, w, go_errors.Wrap(err, "Failed auditing log level update"))
+			return
+		}
+
+		if update.Min != nil {
+			level.SetMin(*update.Min)
+		}
+		if update.Overrides != nil {
+			level.SetOverrides(update.Overrides)
+		}
+		if update.DebugFor != nil {
+			level.DebugFor(debugFor)
+		}
+		logClient.Notice(ctx, "Updated log level",
+			go_log.FmtString(level.Min().String(), "min"),
+			go_log.FmtAny(level.Overrides(), "overrides"),
+			go_log.FmtTime(level.DebugUntil(), "debugUntil"),
+		)
+		renderLogLevel(headersClient, logClient, level, w, r)
+	}
+}
+
+// enablesDebug if the update sets the min severity or an override to debug, or starts timed debug
+func enablesDebug(update logLevelUpdate, debugFor time.Duration) bool {
+	if update.Min != nil && *update.Min == go_log.SeverityDebug {
+		return true
+	}
+	for _, v := range update.Overrides {
+		if v == go_log.SeverityDebug {
+			return true
+		}
+	}
+	return debugFor > 0
+}
+
+func renderLogLevel(headersClient go_headers.Client, logClient go_log.Client, level *go_log.Level, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logLevel{
+		Min:       level.Min(),
+		Overrides: level.Overrides(),
+	}
+	if until := level.DebugUntil(); !until.IsZero() {
+		l.DebugUntil = &until
+	}
+	body, err := json.Marshal(l)
+	if err != nil {
+		go_render.ErrorOrStatus(ctx, headersClient, logClient, w, go_errors.Wrap(err, "Failed marshalling log level"))
+		return
+	}
+	go_render.ContentJSON(ctx, headersClient, logClient, w, body)
+}
+
+// LogMetricsPath at which the log metrics handler is mounted
+const LogMetricsPath = "/admin/log/metrics"
+
+// MountLogMetrics handler on the router for getting log metrics, e.g. for scraping by Prometheus
+//
+// The format is negotiated from the Accept header:
+//   - "application/json", the snapshot
+//   - "application/openmetrics-text", OpenMetrics with the latest correlation ID of each counter as an exemplar
+//   - otherwise the Prometheus text format
+func MountLogMetrics(router chi.Router, headersClient go_headers.Client, logClient go_log.Client, metrics *go_log.Metrics) {
+	router.Get(LogMetricsPath, getLogMetrics(headersClient, logClient, metrics))
+}
+
+func getLogMetrics(headersClient go_headers.Client, logClient go_log.Client, metrics *go_log.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		accept := r.Header.Get("Accept")
+		if strings.Contains(accept, "application/json") {
+			body, err := json.Marshal(metrics.Snapshot())
+			if err != nil {
+				go_render.ErrorOrStatus(ctx, headersClient, logClient, w, go_errors.Wrap(err, "Failed marshalling log metrics"))
+				return
+			}
+			go_render.ContentJSON(ctx, headersClient, logClient, w, body)
+			return
+		}
+		var body bytes.Buffer
+		contentType := "text/plain; version=0.0.4; charset=utf-8"
+		write := metrics.WritePrometheus
+		if strings.Contains(accept, "application/openmetrics-text") {
+			contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+			write = metrics.WriteOpenMetrics
+		}
+		if err := write(&body); err != nil {
+			go_render.ErrorOrStatus(ctx, headersClient, logClient, w, err)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(body.Bytes()); err != nil {
+			logClient.Warn(ctx, "Failed writing log metrics", go_log.FmtError(err))
+		}
+	}
+}
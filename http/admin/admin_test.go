@@ -0,0 +1,334 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	go_headers "github.com/caigwatkin/go/http/headers"
+	go_log "github.com/caigwatkin/go/log"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMountLogLevel(t *testing.T) {
+	type input struct {
+		Method string
+		Body   string
+	}
+	type expected struct {
+		Code    int
+		Body    string
+		Outcome go_log.AuditOutcome // Of the audit record written, if any
+	}
+	var data = []struct {
+		desc     string
+		input    input
+		expected expected
+	}{
+		{
+			desc: "get",
+			input: input{
+				Method: http.MethodGet,
+			},
+			expected: expected{
+				Code: http.StatusOK,
+				Body: `{"min":"INFO","overrides":{}}`,
+			},
+		},
+
+		{
+			desc: "put min and overrides",
+			input: input{
+				Method: http.MethodPut,
+				Body:   `{"min":"warn","overrides":{"github.com/caigwatkin/go/database":"DEBUG"}}`,
+			},
+			expected: expected{
+				Code:    http.StatusOK,
+				Body:    `{"min":"WARN","overrides":{"github.com/caigwatkin/go/database":"DEBUG"}}`,
+				Outcome: go_log.AuditOutcomeSuccess,
+			},
+		},
+
+		{
+			desc: "put debug for",
+			input: input{
+				Method: http.MethodPut,
+				Body:   `{"debugFor":"10m"}`,
+			},
+			expected: expected{
+				Code:    http.StatusOK,
+				Body:    `{"min":"WARN","overrides":{"github.com/caigwatkin/go/database":"DEBUG"},"debugUntil":`,
+				Outcome: go_log.AuditOutcomeSuccess,
+			},
+		},
+
+		{
+			desc: "put invalid severity",
+			input: input{
+				Method: http.MethodPut,
+				Body:   `{"min":"verbose"}`,
+			},
+			expected: expected{
+				Code:    http.StatusBadRequest,
+				Outcome: go_log.AuditOutcomeFailure,
+			},
+		},
+
+		{
+			desc: "put invalid debug for",
+			input: input{
+				Method: http.MethodPut,
+				Body:   `{"debugFor":"-1m"}`,
+			},
+			expected: expected{
+				Code:    http.StatusBadRequest,
+				Outcome: go_log.AuditOutcomeFailure,
+			},
+		},
+	}
+
+	ctx := context.Background()
+	level := go_log.NewLevel(go_log.SeverityInfo)
+	router := chi.NewRouter()
+	var audit bytes.Buffer
+	MountLogLevel(router, go_headers.NewClient(ctx, go_log_mock.Client, ""), go_log_mock.Client, newAuditLogger(t, &audit), level)
+
+	for i, d := range data {
+		w := httptest.NewRecorder()
+		audit.Reset()
+		router.ServeHTTP(w, httptest.NewRequest(d.input.Method, LogLevelPath, strings.NewReader(d.input.Body)))
+
+		if w.Code != d.expected.Code {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "w.Code",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected.Code,
+				Result:     w.Code,
+			}))
+		}
+		if !strings.HasPrefix(w.Body.String(), d.expected.Body) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "w.Body",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected.Body,
+				Result:     w.Body.String(),
+			}))
+		}
+		if (d.expected.Outcome == "" && audit.Len() > 0) || (d.expected.Outcome != "" && !strings.Contains(audit.String(), `"outcome":"`+string(d.expected.Outcome)+`"`)) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "audit",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected.Outcome,
+				Result:     audit.String(),
+			}))
+		}
+	}
+}
+
+func TestMountLogLevelDebugForbidden(t *testing.T) {
+	type expected struct {
+		Code int
+		Body string
+	}
+	var data = []struct {
+		desc     string
+		input    string
+		expected expected
+	}{
+		{
+			desc:  "put min",
+			input: `{"min":"DEBUG"}`,
+			expected: expected{
+				Code: http.StatusForbidden,
+			},
+		},
+
+		{
+			desc:  "put overrides",
+			input: `{"overrides":{"github.com/caigwatkin/go/database":"DEBUG"}}`,
+			expected: expected{
+				Code: http.StatusForbidden,
+			},
+		},
+
+		{
+			desc:  "put debug for",
+			input: `{"debugFor":"10m"}`,
+			expected: expected{
+				Code: http.StatusForbidden,
+			},
+		},
+
+		{
+			desc:  "put end debug for and min",
+			input: `{"debugFor":"0s","min":"WARN"}`,
+			expected: expected{
+				Code: http.StatusOK,
+				Body: `{"min":"WARN","overrides":{}}`,
+			},
+		},
+	}
+
+	ctx := context.Background()
+	level := go_log.NewLevel(go_log.SeverityInfo)
+	level.ForbidDebug()
+	router := chi.NewRouter()
+	var audit bytes.Buffer
+	MountLogLevel(router, go_headers.NewClient(ctx, go_log_mock.Client, ""), go_log_mock.Client, newAuditLogger(t, &audit), level)
+
+	for i, d := range data {
+		w := httptest.NewRecorder()
+		audit.Reset()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, LogLevelPath, strings.NewReader(d.input)))
+		outcome := go_log.AuditOutcomeSuccess
+		if d.expected.Code == http.StatusForbidden {
+			outcome = go_log.AuditOutcomeDenied
+		}
+
+		if w.Code != d.expected.Code || !strings.HasPrefix(w.Body.String(), d.expected.Body) || !strings.Contains(audit.String(), `"outcome":"`+string(outcome)+`"`) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "w.Code, w.Body",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     []interface{}{w.Code, w.Body.String(), audit.String()},
+			}))
+		}
+	}
+	if level.Enabled(go_log.SeverityDebug, "") {
+		t.Error("Expected debug to be disabled")
+	}
+}
+
+func TestMountLogLevelAuditFailure(t *testing.T) {
+	ctx := context.Background()
+	level := go_log.NewLevel(go_log.SeverityInfo)
+	router := chi.NewRouter()
+	MountLogLevel(router, go_headers.NewClient(ctx, go_log_mock.Client, ""), go_log_mock.Client, newAuditLogger(t, failingWriter{}), level)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, LogLevelPath, strings.NewReader(`{"min":"WARN"}`)))
+
+	if w.Code != http.StatusInternalServerError || level.Min() != go_log.SeverityInfo {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "w.Code, level.Min()",
+			Expected:   "internal server error, with the update not applied",
+			Result:     []interface{}{w.Code, level.Min()},
+		}))
+	}
+}
+
+func newAuditLogger(t *testing.T, w io.Writer) go_log.AuditLogger {
+	auditLogger, err := go_log.NewAuditLogger(go_log.AuditConfig{
+		Key:    []byte("key"),
+		Writer: w,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auditLogger
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestMountLogMetrics(t *testing.T) {
+	type expected struct {
+		ContentType string
+		Body        string
+	}
+	var data = []struct {
+		desc     string
+		input    string
+		expected expected
+	}{
+		{
+			desc:  "prometheus",
+			input: "text/plain",
+			expected: expected{
+				ContentType: "text/plain; version=0.0.4; charset=utf-8",
+				Body:        "# HELP log_entries_total",
+			},
+		},
+
+		{
+			desc:  "openmetrics",
+			input: "application/openmetrics-text; version=1.0.0",
+			expected: expected{
+				ContentType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+				Body:        "# HELP log_entries ",
+			},
+		},
+
+		{
+			desc:  "json",
+			input: "application/json",
+			expected: expected{
+				ContentType: "application/json",
+				Body:        `{"counters":[{"severity":"INFO","logger":"","message":"Initialized","count":1,`,
+			},
+		},
+	}
+	ctx := context.Background()
+	metrics := go_log.NewMetrics(0)
+	go_log.NewClient(ctx, go_log.Config{
+		Sinks: []go_log.Sink{
+			go_log.NewWriterSink(io.Discard, go_log.SeverityInfo, nil),
+		},
+		Metrics: metrics,
+	})
+	router := chi.NewRouter()
+	MountLogMetrics(router, go_headers.NewClient(ctx, go_log_mock.Client, ""), go_log_mock.Client, metrics)
+	for i, d := range data {
+		r := httptest.NewRequest(http.MethodGet, LogMetricsPath, nil)
+		r.Header.Set("Accept", d.input)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		result := expected{
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        w.Body.String(),
+		}
+
+		if w.Code != http.StatusOK || result.ContentType != d.expected.ContentType || !strings.HasPrefix(result.Body, d.expected.Body) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "response",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
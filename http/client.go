@@ -20,6 +20,7 @@ import (
 	"context"
 	"net/http"
 
+	go_environment "github.com/caigwatkin/go/environment"
 	go_headers "github.com/caigwatkin/go/http/headers"
 	go_middleware "github.com/caigwatkin/go/http/middleware"
 	go_render "github.com/caigwatkin/go/http/render"
@@ -39,47 +40,56 @@ type Client interface {
 type client struct {
 	headersClient go_headers.Client
 	logClient     go_log.Client
+	stage         go_environment.Stage
 }
 
 // NewClient for http
 //
 // Service name should be in canonical case as it is used for custom response headers
 // Use an empty string to use default keys
-func NewClient(ctx context.Context, logClient go_log.Client, serviceNameForHeaders string) Client {
-	logClient.Info(ctx, "Initializing", go_log.FmtString(serviceNameForHeaders, "serviceNameForHeaders"))
+//
+// Stage is used by middleware for guard rails
+func NewClient(ctx context.Context, logClient go_log.Client, stage go_environment.Stage, serviceNameForHeaders string) Client {
+	logClient.Info(ctx, "Initializing", go_log.FmtString(string(stage), "stage"), go_log.FmtString(serviceNameForHeaders, "serviceNameForHeaders"))
 	logClient.Info(ctx, "Initialized")
 	return client{
 		headersClient: go_headers.NewClient(ctx, logClient, serviceNameForHeaders),
 		logClient:     logClient,
+		stage:         stage,
 	}
 }
 
 // RenderContentJSON in response
 func (c client) RenderContentJSON(ctx context.Context, w http.ResponseWriter, body []byte) {
+	go_log.Helper()
 	go_render.ContentJSON(ctx, c.headersClient, c.logClient, w, body)
 }
 
 // RenderCreated with location in header
 func (c client) RenderCreated(ctx context.Context, w http.ResponseWriter, location string) {
+	go_log.Helper()
 	go_render.Created(ctx, c.headersClient, c.logClient, w, location)
 }
 
 // RenderErrorOrStatus in response
 func (c client) RenderErrorOrStatus(ctx context.Context, w http.ResponseWriter, err error) {
+	go_log.Helper()
 	go_render.ErrorOrStatus(ctx, c.headersClient, c.logClient, w, err)
 }
 
 // RenderHealth in response
 func (c client) RenderHealth(ctx context.Context, w http.ResponseWriter, serviceName string) {
+	go_log.Helper()
 	go_render.Health(ctx, c.headersClient, c.logClient, w, serviceName)
 }
 
 // RenderNoContent in response
 func (c client) RenderNoContent(ctx context.Context, w http.ResponseWriter) {
+	go_log.Helper()
 	go_render.NoContent(ctx, c.headersClient, c.logClient, w)
 }
 
 // MiddlewareDefaults for request handling
 func (c client) MiddlewareDefaults(r *chi.Mux, excludePathsForLogInfoRequests []string) {
-	go_middleware.Defaults(r, c.headersClient, c.logClient, excludePathsForLogInfoRequests)
+	go_middleware.Defaults(r, c.headersClient, c.logClient, c.stage, excludePathsForLogInfoRequests)
 }
@@ -19,6 +19,10 @@ package headers
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	go_log "github.com/caigwatkin/go/log"
 )
@@ -48,6 +52,7 @@ const (
 // Service name should be in canonical case
 // Use an empty string to use default keys
 func NewClient(ctx context.Context, logClient go_log.Client, serviceName string) Client {
+	logClient = logClient.Named("headers")
 	logClient.Info(ctx, "Initializing", go_log.FmtString(serviceName, "serviceName"))
 
 	var c client
@@ -83,3 +88,50 @@ func (c *client) setTestKey(serviceName string) {
 	}
 	c.testKey = fmt.Sprintf(testKeyFormat, serviceName)
 }
+
+// Trace header keys, not specific to a service so are not part of the client
+const (
+	TraceKeyCloud = "X-Cloud-Trace-Context" // Format "TRACE_ID/SPAN_ID;o=TRACE_TRUE"
+	TraceKeyW3C   = "Traceparent"           // Format "VERSION-TRACE_ID-PARENT_ID-FLAGS"
+)
+
+// TraceFlagSampled of the W3C trace flags, set if the caller may have sampled the trace
+const TraceFlagSampled uint8 = 0x01
+
+// BaggageKey of the W3C baggage header, format "KEY=VALUE,KEY=VALUE"
+const BaggageKey = "Baggage"
+
+var traceIdRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// TraceId from the trace headers, preferring the W3C header, or an empty string if neither has a valid trace ID
+func TraceId(h http.Header) string {
+	traceId, _ := trace(h)
+	return traceId
+}
+
+// TraceFlags from the trace header of the trace ID, see TraceId, or zero if there is none
+//
+// The flags of the cloud header are TraceFlagSampled if it has "o=1"
+func TraceFlags(h http.Header) uint8 {
+	_, flags := trace(h)
+	return flags
+}
+
+func trace(h http.Header) (traceId string, flags uint8) {
+	if v := h.Get(TraceKeyW3C); v != "" {
+		if parts := strings.Split(v, "-"); len(parts) == 4 && traceIdRegexp.MatchString(parts[1]) {
+			f, _ := strconv.ParseUint(parts[3], 16, 8)
+			return parts[1], uint8(f)
+		}
+	}
+	if v := h.Get(TraceKeyCloud); v != "" {
+		parts := strings.SplitN(v, "/", 2)
+		if traceId := strings.ToLower(parts[0]); traceIdRegexp.MatchString(traceId) {
+			if len(parts) == 2 && strings.HasSuffix(parts[1], ";o=1") {
+				flags = TraceFlagSampled
+			}
+			return traceId, flags
+		}
+	}
+	return "", 0
+}
@@ -18,6 +18,7 @@ package headers
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	go_log_mock "github.com/caigwatkin/go/log/mock"
@@ -224,3 +225,121 @@ func TestSetTestKey(t *testing.T) {
 		}
 	}
 }
+
+func TestTraceId(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    http.Header
+		expected string
+	}{
+		{
+			desc: "cloud",
+			input: http.Header{
+				TraceKeyCloud: []string{"105445AA7843BC8BF206B12000100000/1;o=1"},
+			},
+			expected: "105445aa7843bc8bf206b12000100000",
+		},
+
+		{
+			desc: "w3c preferred",
+			input: http.Header{
+				TraceKeyCloud: []string{"105445aa7843bc8bf206b12000100000/1;o=1"},
+				TraceKeyW3C:   []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			},
+			expected: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+
+		{
+			desc: "invalid",
+			input: http.Header{
+				TraceKeyCloud: []string{"not-a-trace"},
+			},
+			expected: "",
+		},
+
+		{
+			desc:     "none",
+			input:    http.Header{},
+			expected: "",
+		},
+	}
+
+	for i, d := range data {
+		result := TraceId(d.input)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestTraceFlags(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    http.Header
+		expected uint8
+	}{
+		{
+			desc: "cloud sampled",
+			input: http.Header{
+				TraceKeyCloud: []string{"105445aa7843bc8bf206b12000100000/1;o=1"},
+			},
+			expected: TraceFlagSampled,
+		},
+
+		{
+			desc: "cloud not sampled",
+			input: http.Header{
+				TraceKeyCloud: []string{"105445aa7843bc8bf206b12000100000/1"},
+			},
+			expected: 0,
+		},
+
+		{
+			desc: "w3c sampled",
+			input: http.Header{
+				TraceKeyW3C: []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			},
+			expected: TraceFlagSampled,
+		},
+
+		{
+			desc: "w3c preferred",
+			input: http.Header{
+				TraceKeyCloud: []string{"105445aa7843bc8bf206b12000100000/1;o=1"},
+				TraceKeyW3C:   []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+			},
+			expected: 0,
+		},
+
+		{
+			desc: "invalid trace ID",
+			input: http.Header{
+				TraceKeyW3C: []string{"00-invalid-00f067aa0ba902b7-01"},
+			},
+			expected: 0,
+		},
+	}
+
+	for i, d := range data {
+		result := TraceFlags(d.input)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
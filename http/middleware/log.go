@@ -0,0 +1,75 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	go_log "github.com/caigwatkin/go/log"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// NewLogFormatter for chi's request logger, logging completed and panicked requests through the log client
+//
+// Use after the context is populated, so entries have its correlation and trace IDs
+func NewLogFormatter(logClient go_log.Client) middleware.LogFormatter {
+	return logFormatter{
+		logClient: logClient,
+	}
+}
+
+type logFormatter struct {
+	logClient go_log.Client
+}
+
+func (f logFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	return logEntry{
+		ctx:       r.Context(),
+		logClient: f.logClient,
+		method:    r.Method,
+		url:       r.URL.String(),
+	}
+}
+
+type logEntry struct {
+	ctx       context.Context
+	logClient go_log.Client
+	method    string
+	url       string
+}
+
+func (e logEntry) Write(status, bytes int, _ http.Header, elapsed time.Duration, _ interface{}) {
+	e.logClient.Info(e.ctx, "Request completed",
+		go_log.FmtString(e.url, "r.URL.String()"),
+		go_log.FmtString(e.method, "r.Method"),
+		go_log.FmtInt(status, "status"),
+		go_log.FmtInt(bytes, "bytes"),
+		go_log.FmtDuration(elapsed, "elapsed"),
+	)
+}
+
+func (e logEntry) Panic(v interface{}, stack []byte) {
+	e.logClient.Error(e.ctx, "Request panicked",
+		go_log.FmtString(e.url, "r.URL.String()"),
+		go_log.FmtString(e.method, "r.Method"),
+		go_log.FmtString(fmt.Sprint(v), "panic"),
+		go_log.FmtBytes(stack, "stack"),
+	)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	go_environment "github.com/caigwatkin/go/environment"
+	go_headers "github.com/caigwatkin/go/http/headers"
+	go_log "github.com/caigwatkin/go/log"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDefaultsLogRequests(t *testing.T) {
+	type expected struct {
+		Message  string
+		Severity go_log.Severity
+		Status   int
+		Panic    bool
+	}
+	var data = []struct {
+		desc     string
+		input    string
+		expected expected
+	}{
+		{
+			desc:  "completed",
+			input: "/ok",
+			expected: expected{
+				Message:  "Request completed",
+				Severity: go_log.SeverityInfo,
+				Status:   http.StatusOK,
+			},
+		},
+
+		{
+			desc:  "panicked",
+			input: "/panic",
+			expected: expected{
+				Message:  "Request panicked",
+				Severity: go_log.SeverityError,
+				Status:   http.StatusInternalServerError,
+				Panic:    true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		logClient := go_log_mock.NewRecorder(t)
+		router := chi.NewRouter()
+		Defaults(router, go_headers.NewClient(context.Background(), go_log_mock.Client, ""), logClient, go_environment.StageLocal, nil)
+		router.Get("/ok", func(w http.ResponseWriter, r *http.Request) {})
+		router.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("handler")
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", d.input, nil))
+
+		e, _ := logClient.FindMessage(d.expected.Message)
+		result := expected{
+			Message:  e.Message,
+			Severity: e.Severity,
+			Status:   w.Code,
+			Panic:    d.expected.Panic && logClient.RequireField("Request panicked", "panic") == "handler",
+		}
+		if e.CorrelationId == "" || result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -22,7 +22,10 @@ import (
 	"time"
 
 	go_context "github.com/caigwatkin/go/context"
+	go_environment "github.com/caigwatkin/go/environment"
+	go_errors "github.com/caigwatkin/go/errors"
 	go_headers "github.com/caigwatkin/go/http/headers"
+	go_render "github.com/caigwatkin/go/http/render"
 	go_log "github.com/caigwatkin/go/log"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -31,25 +34,46 @@ import (
 )
 
 // Defaults adds middleware defaults to the router
-func Defaults(router *chi.Mux, headersClient go_headers.Client, logClient go_log.Client, excludePathsForLogInfoRequests []string) {
+//
+// Stage is used for guard rails, e.g. requests in test mode are refused in prod
+//
+// Completed and panicked requests are logged through the log client, after the context is populated, and requests
+// refused while populating it are logged when refused
+func Defaults(router *chi.Mux, headersClient go_headers.Client, logClient go_log.Client, stage go_environment.Stage, excludePathsForLogInfoRequests []string) {
 	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
+	router.Use(populateContext(headersClient, logClient, stage))
+	router.Use(middleware.RequestLogger(NewLogFormatter(logClient)))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.Timeout(time.Second * 30))
 	router.Use(middleware.URLFormat)
-	router.Use(populateContext(headersClient))
 	router.Use(logInfoRequests(logClient, excludePathsForLogInfoRequests))
 	router.Use(NewCors().Handler)
 	router.Use(middleware.Compress(5, "application/json"))
 }
 
-func populateContext(headersClient go_headers.Client) func(next http.Handler) http.Handler {
+func populateContext(headersClient go_headers.Client, logClient go_log.Client, stage go_environment.Stage) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := go_context.WithCorrelationId(r.Context(), uuid.New().String())
 			if v, ok := r.Header[headersClient.CorrelationIdKey()]; ok {
 				ctx = go_context.WithCorrelationIdAppend(ctx, strings.Join(v, ","))
 			}
+			if traceId := go_headers.TraceId(r.Header); traceId != "" {
+				ctx = go_context.WithTraceId(ctx, traceId)
+				ctx = go_context.WithTraceFlags(ctx, go_headers.TraceFlags(r.Header))
+			}
+			if v, ok := r.Header[go_headers.BaggageKey]; ok {
+				ctx = go_context.WithBaggage(ctx, strings.Join(v, ","))
+			}
+			if _, ok := r.Header[headersClient.TestKey()]; ok && !stage.TestModeAllowed() {
+				logClient.Warn(ctx, "Request refused, test mode is not available for the stage",
+					go_log.FmtString(r.URL.String(), "r.URL.String()"),
+					go_log.FmtString(r.Method, "r.Method"),
+					go_log.FmtString(stage.String(), "stage"),
+				)
+				go_render.Status(ctx, headersClient, logClient, w, go_errors.NewStatus(http.StatusForbidden, "Test mode is not available in prod"))
+				return
+			}
 			var t bool
 			if v, ok := r.Header[headersClient.TestKey()]; ok {
 				t = strings.Join(v, ",") == go_headers.TestValDefault
@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_environment "github.com/caigwatkin/go/environment"
+	go_headers "github.com/caigwatkin/go/http/headers"
+	go_log "github.com/caigwatkin/go/log"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDefaultsTestMode(t *testing.T) {
+	type input struct {
+		Stage go_environment.Stage
+		Test  bool
+	}
+	type expected struct {
+		Status  int
+		Handled bool
+		Test    bool
+		Refused bool
+	}
+	var data = []struct {
+		desc     string
+		input    input
+		expected expected
+	}{
+		{
+			desc: "dev",
+			input: input{
+				Stage: go_environment.StageDev,
+			},
+			expected: expected{
+				Status:  http.StatusOK,
+				Handled: true,
+			},
+		},
+
+		{
+			desc: "dev test mode",
+			input: input{
+				Stage: go_environment.StageDev,
+				Test:  true,
+			},
+			expected: expected{
+				Status:  http.StatusOK,
+				Handled: true,
+				Test:    true,
+			},
+		},
+
+		{
+			desc: "prod",
+			input: input{
+				Stage: go_environment.StageProd,
+			},
+			expected: expected{
+				Status:  http.StatusOK,
+				Handled: true,
+			},
+		},
+
+		{
+			desc: "prod test mode",
+			input: input{
+				Stage: go_environment.StageProd,
+				Test:  true,
+			},
+			expected: expected{
+				Status:  http.StatusForbidden,
+				Refused: true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		headersClient := go_headers.NewClient(context.Background(), go_log_mock.Client, "")
+		logClient := go_log_mock.NewRecorder(t)
+		router := chi.NewRouter()
+		Defaults(router, headersClient, logClient, d.input.Stage, nil)
+		var result expected
+		router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			result.Handled = true
+			result.Test = go_context.Test(r.Context())
+		})
+		r := httptest.NewRequest("GET", "/", nil)
+		if d.input.Test {
+			r.Header.Set(headersClient.TestKey(), go_headers.TestValDefault)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		result.Status = w.Code
+		e, ok := logClient.FindMessage("Request refused, test mode is not available for the stage")
+		result.Refused = ok && e.Severity == go_log.SeverityWarn && e.CorrelationId != ""
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
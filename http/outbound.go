@@ -0,0 +1,298 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_headers "github.com/caigwatkin/go/http/headers"
+	go_log "github.com/caigwatkin/go/log"
+)
+
+// OutboundClient for requests to other services, propagating the context of each request in its headers
+type OutboundClient interface {
+	Do(ctx context.Context, req *http.Request) (*http.Response, error)
+	DoJSON(ctx context.Context, method, url string, body, result interface{}) error
+	GetJSON(ctx context.Context, url string, result interface{}) error
+	PostJSON(ctx context.Context, url string, body, result interface{}) error
+}
+
+type OutboundConfig struct {
+	Transport http.RoundTripper // Wrapped with NewRoundTripper, defaults to http.DefaultTransport
+	Timeout   time.Duration     // Of requests with contexts without deadlines, defaults to 30s
+	MaxBody   int64             // Bytes of response bodies read by the JSON helpers, defaults to 10MB
+}
+
+type outboundClient struct {
+	config OutboundConfig
+	http   *http.Client
+}
+
+// NewOutboundClient with the headers and log clients, which name the headers propagated and log requests
+func NewOutboundClient(ctx context.Context, headersClient go_headers.Client, logClient go_log.Client, config OutboundConfig) OutboundClient {
+	logClient.Info(ctx, "Initializing outbound client", go_log.FmtDuration(config.Timeout, "timeout"), go_log.FmtInt64(config.MaxBody, "maxBody"))
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.MaxBody == 0 {
+		config.MaxBody = 10 << 20
+	}
+	logClient.Info(ctx, "Initialized outbound client")
+	return outboundClient{
+		config: config,
+		http: &http.Client{
+			Transport: NewRoundTripper(headersClient, logClient, config.Transport),
+		},
+	}
+}
+
+// Do the request with the context, which cancels it, or the timeout if it has no deadline
+//
+// The response body must be closed by the caller
+func (c outboundClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	go_log.Helper()
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok {
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+	}
+	res, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, go_errors.Wrap(err, "Failed doing request")
+	}
+	res.Body = cancelOnClose{
+		ReadCloser: res.Body,
+		cancel:     cancel,
+	}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// DoJSON request with the body marshalled as JSON, if not nil, decoding a successful response into the result, if not nil
+//
+// Error responses are returned as a go_errors.Status of Bad Gateway or Service Unavailable, see StatusFromResponse
+func (c outboundClient) DoJSON(ctx context.Context, method, url string, body, result interface{}) error {
+	go_log.Helper()
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return go_errors.Wrap(err, "Failed marshalling request body")
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed creating request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := StatusFromResponse(res); err != nil {
+		return err
+	}
+	if result == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, c.config.MaxBody)).Decode(result); err != nil {
+		return go_errors.Wrap(err, "Failed decoding response body")
+	}
+	return nil
+}
+
+// GetJSON decoding the response into the result
+func (c outboundClient) GetJSON(ctx context.Context, url string, result interface{}) error {
+	go_log.Helper()
+	return c.DoJSON(ctx, http.MethodGet, url, nil, result)
+}
+
+// PostJSON with the body, decoding the response into the result
+func (c outboundClient) PostJSON(ctx context.Context, url string, body, result interface{}) error {
+	go_log.Helper()
+	return c.DoJSON(ctx, http.MethodPost, url, body, result)
+}
+
+// StatusFromResponse as a go_errors.Status if it is an error response, nil otherwise
+//
+// The code is Service Unavailable if the upstream is unavailable or rate limiting, otherwise Bad Gateway, so rendering
+// the status does not pass the upstream's code and body through to the client. The cause is the upstream's status,
+// with items rendered as its body, as by go_render.Status, decoded, otherwise the start of the body as its message
+func StatusFromResponse(res *http.Response) error {
+	if res.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+	code := http.StatusBadGateway
+	if res.StatusCode == http.StatusServiceUnavailable || res.StatusCode == http.StatusTooManyRequests {
+		code = http.StatusServiceUnavailable
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return go_errors.NewStatusWithCause(err, code, "Failed reading error response body")
+	}
+	return go_errors.NewStatusWithCause(upstreamStatus(res.StatusCode, body), code, "")
+}
+
+// upstreamStatus of the error response with the body
+func upstreamStatus(code int, body []byte) go_errors.Status {
+	var items []go_errors.Item
+	if err := json.Unmarshal(body, &items); err == nil && len(items) > 0 {
+		return go_errors.NewStatusWithItems(code, "", items)
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 1024 {
+		body = append(body[:1024:1024], "…"...)
+	}
+	return go_errors.NewStatus(code, string(body))
+}
+
+// NewRoundTripper propagating the context of each request in its headers, and logging requests and responses
+//
+// Correlation ID and test mode headers are named by the headers client, and trace and baggage headers are W3C's, with
+// the trace also in Cloud Trace's header. Headers and URLs are logged as fields, so are redacted by the log client
+func NewRoundTripper(headersClient go_headers.Client, logClient go_log.Client, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripper{
+		headersClient: headersClient,
+		logClient:     logClient.Named("outbound"),
+		next:          next,
+	}
+}
+
+type roundTripper struct {
+	headersClient go_headers.Client
+	logClient     go_log.Client
+	next          http.RoundTripper
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	req = req.Clone(ctx) // Round trippers must not change the request
+	rt.setHeaders(ctx, req.Header)
+	logClient := rt.logClient.WithCallerSkip(callerSkip())
+	logClient.Debug(ctx, "Outbound request",
+		go_log.FmtString(req.Method, "method"),
+		go_log.FmtURL(req.URL, "url"),
+		go_log.FmtAny(req.Header, "headers"),
+	)
+	start := time.Now()
+	res, err := rt.next.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		logClient.Warn(ctx, "Outbound request failed",
+			go_log.FmtString(req.Method, "method"),
+			go_log.FmtURL(req.URL, "url"),
+			go_log.FmtDuration(elapsed, "elapsed"),
+			go_log.FmtError(err),
+		)
+		return nil, err
+	}
+	log := logClient.Info
+	if res.StatusCode >= http.StatusInternalServerError {
+		log = logClient.Warn
+	}
+	log(ctx, "Outbound response",
+		go_log.FmtString(req.Method, "method"),
+		go_log.FmtURL(req.URL, "url"),
+		go_log.FmtInt(res.StatusCode, "status"),
+		go_log.FmtDuration(elapsed, "elapsed"),
+		go_log.FmtAny(res.Header, "headers"),
+	)
+	return res, nil
+}
+
+// callerSkip of the frames above the caller to the caller of the http.Client calling the round tripper, for the log client
+//
+// Entries are attributed to the caller of the http.Client, or to its first caller which is not a log helper, e.g. the
+// caller of outboundClient.Do
+func callerSkip() int {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	skip := 1
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "net/http.") || !more {
+			return skip
+		}
+		skip++
+	}
+}
+
+// setHeaders of the context, without replacing those set by the caller
+func (rt roundTripper) setHeaders(ctx context.Context, h http.Header) {
+	setDefault := func(key, value string) {
+		if value != "" && h.Get(key) == "" {
+			h.Set(key, value)
+		}
+	}
+	setDefault(rt.headersClient.CorrelationIdKey(), go_context.CorrelationId(ctx))
+	if go_context.Test(ctx) {
+		setDefault(rt.headersClient.TestKey(), go_headers.TestValDefault)
+	}
+	if traceId := go_context.TraceId(ctx); traceId != "" && h.Get(go_headers.TraceKeyW3C) == "" && h.Get(go_headers.TraceKeyCloud) == "" {
+		spanId := newSpanId()
+		flags := go_context.TraceFlags(ctx)
+		h.Set(go_headers.TraceKeyW3C, fmt.Sprintf("00-%s-%016x-%02x", traceId, spanId, flags))
+		h.Set(go_headers.TraceKeyCloud, fmt.Sprintf("%s/%d;o=%d", traceId, spanId, flags&go_headers.TraceFlagSampled))
+	}
+	setDefault(go_headers.BaggageKey, go_context.Baggage(ctx))
+}
+
+// newSpanId for the outbound request, non-zero as required of span IDs
+func newSpanId() uint64 {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return uint64(time.Now().UnixNano())
+		}
+		if id := binary.BigEndian.Uint64(b[:]); id != 0 {
+			return id
+		}
+	}
+}
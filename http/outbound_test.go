@@ -0,0 +1,293 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_headers "github.com/caigwatkin/go/http/headers"
+	go_log "github.com/caigwatkin/go/log"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestOutboundClientPropagates(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	headersClient := go_headers.NewClient(ctx, go_log_mock.Client, "Service")
+	outboundClient := NewOutboundClient(ctx, headersClient, go_log_mock.Client, OutboundConfig{})
+	ctx = go_context.WithCorrelationId(ctx, "correlationId")
+	ctx = go_context.WithTest(ctx, true)
+	ctx = go_context.WithTraceId(ctx, "105445aa7843bc8bf206b12000100000")
+	ctx = go_context.WithTraceFlags(ctx, go_headers.TraceFlagSampled)
+	ctx = go_context.WithBaggage(ctx, "tenant=1")
+
+	var result struct {
+		Ok bool `json:"ok"`
+	}
+	if err := outboundClient.GetJSON(ctx, server.URL, &result); err != nil || !result.Ok {
+		t.Fatal(go_testing.Errorf(go_testing.Error{
+			Unexpected: "GetJSON",
+			Expected:   "decoded result",
+			Result:     []interface{}{result, err},
+		}))
+	}
+	for k, v := range map[string]string{
+		"X-Service-Correlation-Id": "correlationId",
+		"X-Service-Test":           go_headers.TestValDefault,
+		"Baggage":                  "tenant=1",
+		"Accept":                   "application/json",
+	} {
+		if received.Get(k) != v {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "received.Get(k)",
+				Input:      k,
+				Expected:   v,
+				Result:     received.Get(k),
+			}))
+		}
+	}
+	if traceId := go_headers.TraceId(received); traceId != "105445aa7843bc8bf206b12000100000" || !strings.HasPrefix(received.Get(go_headers.TraceKeyCloud), traceId+"/") ||
+		!strings.HasSuffix(received.Get(go_headers.TraceKeyW3C), "-01") || !strings.HasSuffix(received.Get(go_headers.TraceKeyCloud), ";o=1") {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "trace headers",
+			Expected:   "trace ID and sampled flag of the context",
+			Result:     received,
+		}))
+	}
+}
+
+func TestOutboundCaller(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ctx := context.Background()
+	headersClient := go_headers.NewClient(ctx, go_log_mock.Client, "")
+	logClient := go_log_mock.NewRecorder(t)
+	outboundClient := NewOutboundClient(ctx, headersClient, logClient, OutboundConfig{})
+	client := &http.Client{
+		Transport: NewRoundTripper(headersClient, logClient, nil),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logClient.Reset()
+	if err := outboundClient.GetJSON(ctx, server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	const expected = "github.com/caigwatkin/go/http.TestOutboundCaller"
+
+	entries := logClient.Entries(go_log.SeverityDebug)
+	if len(entries) != 4 {
+		t.Fatal(go_testing.Errorf(go_testing.Error{
+			Unexpected: "len(entries)",
+			Expected:   4,
+			Result:     entries,
+		}))
+	}
+	for i, v := range entries {
+		if v.Function != expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "v.Function",
+				At:         i,
+				Input:      v.Message,
+				Expected:   expected,
+				Result:     v.Function,
+			}))
+		}
+	}
+}
+
+func TestRoundTripperDoesNotChangeRequest(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer server.Close()
+	ctx := go_context.WithCorrelationId(context.Background(), "correlationId")
+	headersClient := go_headers.NewClient(ctx, go_log_mock.Client, "")
+	client := &http.Client{
+		Transport: NewRoundTripper(headersClient, go_log_mock.Client, nil),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(go_headers.BaggageKey, "set=caller")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if len(req.Header) != 1 || received.Get(headersClient.CorrelationIdKey()) != "correlationId" || received.Get(go_headers.BaggageKey) != "set=caller" {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "headers",
+			Expected:   "request unchanged, with headers set by the caller kept and the correlation ID added",
+			Result:     []http.Header{req.Header, received},
+		}))
+	}
+}
+
+func TestOutboundClientErrors(t *testing.T) {
+	type status struct {
+		Code    int
+		Message string
+		Items   []go_errors.Item
+	}
+	type expected struct {
+		Code     int
+		Message  string
+		Upstream status
+	}
+	var data = []struct {
+		desc     string
+		input    http.HandlerFunc
+		expected expected
+	}{
+		{
+			desc: "items",
+			input: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `[{"field":"name","message":"Missing"}]`)
+			},
+			expected: expected{
+				Code:    http.StatusBadGateway,
+				Message: "Bad Gateway",
+				Upstream: status{
+					Code:    http.StatusBadRequest,
+					Message: "Bad Request",
+					Items: []go_errors.Item{
+						{
+							Field:   "name",
+							Message: "Missing",
+						},
+					},
+				},
+			},
+		},
+
+		{
+			desc: "text",
+			input: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, "internal details\n")
+			},
+			expected: expected{
+				Code:    http.StatusBadGateway,
+				Message: "Bad Gateway",
+				Upstream: status{
+					Code:    http.StatusInternalServerError,
+					Message: "Internal Server Error: internal details",
+				},
+			},
+		},
+
+		{
+			desc: "unavailable",
+			input: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			expected: expected{
+				Code:    http.StatusServiceUnavailable,
+				Message: "Service Unavailable",
+				Upstream: status{
+					Code:    http.StatusServiceUnavailable,
+					Message: "Service Unavailable",
+				},
+			},
+		},
+
+		{
+			desc: "rate limited",
+			input: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			expected: expected{
+				Code:    http.StatusServiceUnavailable,
+				Message: "Service Unavailable",
+				Upstream: status{
+					Code:    http.StatusTooManyRequests,
+					Message: "Too Many Requests",
+				},
+			},
+		},
+
+		{
+			desc: "timeout",
+			input: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(200 * time.Millisecond):
+				}
+			},
+			expected: expected{},
+		},
+	}
+
+	ctx := context.Background()
+	outboundClient := NewOutboundClient(ctx, go_headers.NewClient(ctx, go_log_mock.Client, ""), go_log_mock.Client, OutboundConfig{
+		Timeout: 50 * time.Millisecond,
+	})
+	for i, d := range data {
+		server := httptest.NewServer(d.input)
+		err := outboundClient.PostJSON(ctx, server.URL, map[string]string{"name": ""}, nil)
+		server.Close()
+		var result expected
+		if s, ok := err.(go_errors.Status); ok {
+			result = expected{
+				Code:    s.Code,
+				Message: s.Message,
+			}
+			if u, ok := s.Cause.(go_errors.Status); ok {
+				result.Upstream = status{
+					Code:    u.Code,
+					Message: u.Message,
+					Items:   u.Items,
+				}
+			}
+		}
+
+		if err == nil || fmt.Sprint(result) != fmt.Sprint(d.expected) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+	}
+}
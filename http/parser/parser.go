@@ -30,6 +30,7 @@ type Client interface {
 }
 
 func NewClient(ctx context.Context, logClient go_log.Client) Client {
+	logClient = logClient.Named("parser")
 	logClient.Info(ctx, "Initializing")
 	logClient.Info(ctx, "Initialized")
 	return client{
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestReadRequestBody(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    io.Reader
+		expected string
+	}{
+		{
+			desc:     "body",
+			input:    bytes.NewBufferString(`{"key":"value"}`),
+			expected: `{"key":"value"}`,
+		},
+
+		{
+			desc:     "empty",
+			input:    nil,
+			expected: "",
+		},
+	}
+
+	for i, d := range data {
+		logClient := go_log_mock.NewRecorder(t)
+		parserClient := NewClient(context.Background(), logClient)
+		r := httptest.NewRequest("POST", "/", d.input)
+
+		body, err := parserClient.ReadRequestBody(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logged, _ := logClient.RequireField("Read", "body").([]byte)
+
+		if string(body) != d.expected || string(logged) != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     []string{string(body), string(logged)},
+			}))
+		}
+		if e, _ := logClient.FindMessage("Read"); e.Logger != "parser" {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "e.Logger",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   "parser",
+				Result:     e.Logger,
+			}))
+		}
+	}
+}
@@ -25,12 +25,14 @@ import (
 )
 
 func logError(ctx context.Context, logClient go_log.Client, err error) {
+	go_log.Helper()
 	logClient.Error(ctx, "Error to be rendered",
 		go_log.FmtError(err),
 	)
 }
 
 func logErrorMarshallingJSONBody(ctx context.Context, logClient go_log.Client, code int, headers map[string]string) {
+	go_log.Helper()
 	logClient.Error(ctx, "Failed marshalling JSON for response body",
 		go_log.FmtInt(code, "status code"),
 		go_log.FmtString(http.StatusText(code), "status text"),
@@ -39,6 +41,7 @@ func logErrorMarshallingJSONBody(ctx context.Context, logClient go_log.Client, c
 }
 
 func logErrorWritingBody(ctx context.Context, logClient go_log.Client, code int, headers map[string]string, body []byte) {
+	go_log.Helper()
 	logClient.Error(ctx, "Failed writing body to response",
 		go_log.FmtInt(code, "status code"),
 		go_log.FmtString(http.StatusText(code), "status text"),
@@ -48,6 +51,7 @@ func logErrorWritingBody(ctx context.Context, logClient go_log.Client, code int,
 }
 
 func logInfoResponse(ctx context.Context, logClient go_log.Client, code int, headers map[string]string, lenBody int, body []byte) {
+	go_log.Helper()
 	logClient.Info(ctx, "HTTP Response",
 		go_log.FmtInt(code, "status code"),
 		go_log.FmtString(http.StatusText(code), "status text"),
@@ -58,6 +62,7 @@ func logInfoResponse(ctx context.Context, logClient go_log.Client, code int, hea
 }
 
 func logStatus(ctx context.Context, logClient go_log.Client, status go_errors.Status) {
+	go_log.Helper()
 	logClient.Info(ctx, "Status to be rendered",
 		go_log.FmtAny(status, "status"),
 	)
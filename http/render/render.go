@@ -29,6 +29,7 @@ import (
 
 // ContentJSON writes JSON bytes to the response writer with status code OK
 func ContentJSON(ctx context.Context, headersClient go_headers.Client, logClient go_log.Client, w http.ResponseWriter, body []byte) {
+	go_log.Helper()
 	headers := setHeadersInclDefaults(ctx, headersClient, w, map[string]string{
 		"Content-Type": "application/json",
 	})
@@ -45,6 +46,7 @@ func ContentJSON(ctx context.Context, headersClient go_headers.Client, logClient
 
 // Created writes location header to response writer with status code Created
 func Created(ctx context.Context, headersClient go_headers.Client, logClient go_log.Client, w http.ResponseWriter, location string) {
+	go_log.Helper()
 	headers := setHeadersInclDefaults(ctx, headersClient, w, map[string]string{
 		"Location": location,
 	})
@@ -57,6 +59,7 @@ func Created(ctx context.Context, headersClient go_headers.Client, logClient go_
 //
 // Used for health check endpoints to ensure API is serving
 func Health(ctx context.Context, headersClient go_headers.Client, logClient go_log.Client, w http.ResponseWriter, serviceName string) {
+	go_log.Helper()
 	headers := setHeadersInclDefaults(ctx, headersClient, w, map[string]string{
 		"Content-Type": "application/json",
 	})
@@ -81,6 +84,7 @@ func Health(ctx context.Context, headersClient go_headers.Client, logClient go_l
 
 // ErrorOrStatus wraps Status if error is a Status, otherwise writes status code Internal Server Error
 func ErrorOrStatus(ctx context.Context, headersClient go_headers.Client, logClient go_log.Client, w http.ResponseWriter, err error) {
+	go_log.Helper()
 	if v, ok := err.(go_errors.Status); ok {
 		Status(ctx, headersClient, logClient, w, v)
 		return
@@ -94,6 +98,7 @@ func ErrorOrStatus(ctx context.Context, headersClient go_headers.Client, logClie
 
 // NoContent writes status code No Content
 func NoContent(ctx context.Context, headersClient go_headers.Client, logClient go_log.Client, w http.ResponseWriter) {
+	go_log.Helper()
 	headers := setHeadersInclDefaults(ctx, headersClient, w, nil)
 	code := http.StatusNoContent
 	w.WriteHeader(code)
@@ -102,6 +107,7 @@ func NoContent(ctx context.Context, headersClient go_headers.Client, logClient g
 
 // Status writes a go_errors.Status as JSON to the response writer with status code Status.Code
 func Status(ctx context.Context, headersClient go_headers.Client, logClient go_log.Client, w http.ResponseWriter, s go_errors.Status) {
+	go_log.Helper()
 	h := setHeadersInclDefaults(ctx, headersClient, w, map[string]string{
 		"Content-Type": "application/json",
 	})
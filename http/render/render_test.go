@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_errors "github.com/caigwatkin/go/errors"
+	go_headers "github.com/caigwatkin/go/http/headers"
+	go_log_mock "github.com/caigwatkin/go/log/mock"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestErrorOrStatus(t *testing.T) {
+	type expected struct {
+		Code          int
+		ErrorLogged   bool
+		StatusLogged  bool
+		ResponseCode  int
+		CorrelationId string
+	}
+	var data = []struct {
+		desc     string
+		input    error
+		expected expected
+	}{
+		{
+			desc:  "error",
+			input: go_errors.New("error"),
+			expected: expected{
+				Code:          http.StatusInternalServerError,
+				ErrorLogged:   true,
+				ResponseCode:  http.StatusInternalServerError,
+				CorrelationId: "correlationId",
+			},
+		},
+
+		{
+			desc:  "status",
+			input: go_errors.NewStatus(http.StatusNotFound, "Not found"),
+			expected: expected{
+				Code:          http.StatusNotFound,
+				StatusLogged:  true,
+				ResponseCode:  http.StatusNotFound,
+				CorrelationId: "correlationId",
+			},
+		},
+	}
+
+	ctx := go_context.WithCorrelationId(context.Background(), "correlationId")
+	for i, d := range data {
+		logClient := go_log_mock.NewRecorder(t)
+		headersClient := go_headers.NewClient(ctx, go_log_mock.Client, "")
+		w := httptest.NewRecorder()
+		ErrorOrStatus(ctx, headersClient, logClient, w, d.input)
+
+		_, errorLogged := logClient.FindMessage("Error to be rendered")
+		_, statusLogged := logClient.FindMessage("Status to be rendered")
+		response, _ := logClient.FindMessage("HTTP Response")
+		result := expected{
+			Code:          w.Code,
+			ErrorLogged:   errorLogged,
+			StatusLogged:  statusLogged,
+			ResponseCode:  logClient.RequireField("HTTP Response", "status code").(int),
+			CorrelationId: response.CorrelationId,
+		}
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+		if e, _ := logClient.FindMessage("HTTP Response"); e.Function != "github.com/caigwatkin/go/http/render.TestErrorOrStatus" {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "e.Function",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   "github.com/caigwatkin/go/http/render.TestErrorOrStatus",
+				Result:     e.Function,
+			}))
+		}
+		if errorLogged && logClient.RequireField("Error to be rendered", "error") != d.input {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "error field",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.input,
+				Result:     logClient.RequireField("Error to be rendered", "error"),
+			}))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"context"
+	"io"
+	std_log "log"
+	"strings"
+)
+
+// NewWriter logging each write through the client at the severity, for libraries which write to an io.Writer
+//
+// Each write is one entry, with trailing newlines trimmed and the correlation and trace IDs of the context
+func NewWriter(ctx context.Context, client Client, severity Severity) io.Writer {
+	return writer{
+		client:   client,
+		ctx:      ctx,
+		severity: severity,
+	}
+}
+
+type writer struct {
+	client   Client
+	ctx      context.Context
+	severity Severity
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	Helper()
+	message := strings.TrimRight(string(p), "\r\n")
+	switch w.severity {
+	case SeverityDebug:
+		w.client.Debug(w.ctx, message)
+	case SeverityInfo:
+		w.client.Info(w.ctx, message)
+	case SeverityNotice:
+		w.client.Notice(w.ctx, message)
+	case SeverityWarn:
+		w.client.Warn(w.ctx, message)
+	case SeverityFatal:
+		w.client.Fatal(w.ctx, message)
+	default:
+		w.client.Error(w.ctx, message)
+	}
+	return len(p), nil
+}
+
+// NewStdLogger writing through the client at the severity, e.g. for http.Server.ErrorLog
+func NewStdLogger(ctx context.Context, client Client, severity Severity) *std_log.Logger {
+	return std_log.New(NewWriter(ctx, client, severity), "", 0)
+}
+
+// RedirectStdLog output of the stdlib's standard logger through the client at the severity
+//
+// Returns a func restoring the standard logger's previous output, prefix and flags
+func RedirectStdLog(ctx context.Context, client Client, severity Severity) func() {
+	flags, prefix, output := std_log.Flags(), std_log.Prefix(), std_log.Writer()
+	std_log.SetFlags(0)
+	std_log.SetPrefix("")
+	std_log.SetOutput(NewWriter(ctx, client, severity))
+	return func() {
+		std_log.SetFlags(flags)
+		std_log.SetPrefix(prefix)
+		std_log.SetOutput(output)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	std_log "log"
+	"strings"
+	"testing"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestNewWriter(t *testing.T) {
+	type expected struct {
+		Severity string
+		Message  string
+	}
+	var data = []struct {
+		desc     string
+		input    Severity
+		expected expected
+	}{
+		{
+			desc:  "info",
+			input: SeverityInfo,
+			expected: expected{
+				Severity: `"severity":"INFO"`,
+				Message:  `"message":"http: TLS handshake error"`,
+			},
+		},
+
+		{
+			desc:  "error",
+			input: SeverityError,
+			expected: expected{
+				Severity: `"severity":"ERROR"`,
+				Message:  `"message":"http: TLS handshake error"`,
+			},
+		},
+	}
+
+	ctx := go_context.WithCorrelationId(context.Background(), "correlationId")
+	for i, d := range data {
+		var buf bytes.Buffer
+		logClient := NewClient(ctx, Config{
+			Sinks: []Sink{
+				NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+			},
+		})
+		buf.Reset()
+		NewStdLogger(ctx, logClient, d.input).Println("http: TLS handshake error")
+
+		result := buf.String()
+		if !strings.Contains(result, d.expected.Severity) || !strings.Contains(result, d.expected.Message) || !strings.Contains(result, `"correlationId":"correlationId"`) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	var buf bytes.Buffer
+	logClient := NewClient(context.Background(), Config{
+		Sinks: []Sink{
+			NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+		},
+	})
+	buf.Reset()
+	flags := std_log.Flags()
+	restore := RedirectStdLog(context.Background(), logClient, SeverityWarn)
+	std_log.Println("redirected")
+	restore()
+
+	result := buf.String()
+	if !strings.Contains(result, `"severity":"WARNING","time":`) || !strings.Contains(result, `"message":"redirected"`) || std_log.Flags() != flags {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result",
+			Expected:   "redirected entry at warn, with the standard logger restored",
+			Result:     result,
+		}))
+	}
+}
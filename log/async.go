@@ -0,0 +1,216 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// Flusher of buffered output
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Overflow policy of an async writer when its buffer is full
+type Overflow int
+
+const (
+	OverflowBlock      Overflow = iota // Block the caller until there is space
+	OverflowDropOldest                 // Drop the oldest buffered write to make space, counting it as dropped
+	OverflowDrop                       // Drop the write, counting it as dropped
+)
+
+type AsyncConfig struct {
+	Size     int // Writes buffered, defaults to 1024
+	Overflow Overflow
+}
+
+// AsyncWriter buffers writes in a bounded ring buffer which is written by a background goroutine
+//
+// Entries are encoded by the caller before being buffered, so values logged are not read after the log call returns
+type AsyncWriter struct {
+	dropped  uint64 // Atomic, first for 64-bit alignment
+	buffer   []asyncWrite
+	config   AsyncConfig
+	finished chan struct{}
+	w        io.Writer
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	head     int
+	count    int
+	closed   bool
+	enqueued uint64        // Sequence of the last buffered write
+	inFlight uint64        // Sequence of the write being written, 0 if none
+	progress chan struct{} // Closed and replaced when a buffered write is written or dropped
+	err      error         // First error writing since the last flush
+}
+
+// NewAsyncWriter writing to the writer in a background goroutine, which runs until closed
+func NewAsyncWriter(w io.Writer, config AsyncConfig) *AsyncWriter {
+	if config.Size <= 0 {
+		config.Size = 1024
+	}
+	a := &AsyncWriter{
+		buffer:   make([]asyncWrite, config.Size),
+		config:   config,
+		finished: make(chan struct{}),
+		progress: make(chan struct{}),
+		w:        w,
+	}
+	a.notEmpty = sync.NewCond(&a.mu)
+	a.notFull = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+// Write a copy of p to the buffer, applying the overflow policy if it is full
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for a.count == len(a.buffer) && !a.closed {
+		switch a.config.Overflow {
+		case OverflowDropOldest:
+			a.buffer[a.head] = asyncWrite{}
+			a.head = (a.head + 1) % len(a.buffer)
+			a.count--
+			a.notifyProgress()
+			atomic.AddUint64(&a.dropped, 1)
+		case OverflowDrop:
+			atomic.AddUint64(&a.dropped, 1)
+			return len(p), nil
+		default:
+			a.notFull.Wait()
+		}
+	}
+	if a.closed {
+		return 0, go_errors.New("Async writer is closed")
+	}
+	a.enqueued++
+	a.buffer[(a.head+a.count)%len(a.buffer)] = asyncWrite{
+		seq: a.enqueued,
+		b:   b,
+	}
+	a.count++
+	a.notEmpty.Signal()
+	return len(p), nil
+}
+
+// Dropped writes due to the overflow policy
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Flush waits until writes buffered before the call are written, returning the first error writing since the last flush
+func (a *AsyncWriter) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	target := a.enqueued
+	for a.pending(target) {
+		progress := a.progress
+		a.mu.Unlock()
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return go_errors.Wrap(ctx.Err(), "Failed flushing async writer")
+		}
+		a.mu.Lock()
+	}
+	err := a.err
+	a.err = nil
+	a.mu.Unlock()
+	return err
+}
+
+// Close after writing everything buffered
+//
+// The underlying writer is not closed
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		a.notEmpty.Broadcast()
+		a.notFull.Broadcast()
+	}
+	a.mu.Unlock()
+	<-a.finished
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.err
+	a.err = nil
+	return err
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.finished)
+	for {
+		a.mu.Lock()
+		for a.count == 0 && !a.closed {
+			a.notEmpty.Wait()
+		}
+		if a.count == 0 {
+			a.mu.Unlock()
+			return
+		}
+		write := a.buffer[a.head]
+		a.buffer[a.head] = asyncWrite{}
+		a.inFlight = write.seq
+		a.head = (a.head + 1) % len(a.buffer)
+		a.count--
+		a.notFull.Signal()
+		a.mu.Unlock()
+
+		_, err := a.w.Write(write.b)
+
+		a.mu.Lock()
+		if err != nil && a.err == nil {
+			a.err = go_errors.Wrap(err, "Failed writing from async writer")
+		}
+		a.inFlight = 0
+		a.notifyProgress()
+		a.mu.Unlock()
+	}
+}
+
+type asyncWrite struct {
+	seq uint64
+	b   []byte
+}
+
+// pending writes with sequences up to the target, with the lock held
+//
+// Writes are taken from the buffer in order, so only the write in flight and the oldest buffered write need checking
+func (a *AsyncWriter) pending(target uint64) bool {
+	if a.inFlight != 0 && a.inFlight <= target {
+		return true
+	}
+	return a.count > 0 && a.buffer[a.head].seq <= target
+}
+
+// notifyProgress to flushes waiting, with the lock held
+func (a *AsyncWriter) notifyProgress() {
+	close(a.progress)
+	a.progress = make(chan struct{})
+}
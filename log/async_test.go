@@ -0,0 +1,309 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+// blockingWriter blocks writes until unblocked, recording what is written
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{
+		started: make(chan struct{}, 1),
+		unblock: make(chan struct{}),
+	}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.unblock
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestAsyncWriterConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	w := NewAsyncWriter(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	}), AsyncConfig{
+		Size: 8,
+	})
+
+	const writers, writes = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				fmt.Fprintf(w, "%d %d\n", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	mu.Unlock()
+	if len(lines) != writers*writes {
+		t.Fatal(go_testing.Errorf(go_testing.Error{
+			Unexpected: "len(lines)",
+			Expected:   writers * writes,
+			Result:     len(lines),
+		}))
+	}
+	next := make([]int, writers)
+	for _, v := range lines {
+		var i, j int
+		if _, err := fmt.Sscanf(v, "%d %d", &i, &j); err != nil {
+			t.Fatal(err)
+		}
+		if j != next[i] {
+			t.Fatal(go_testing.Errorf(go_testing.Error{
+				Unexpected: "order",
+				Input:      i,
+				Expected:   next[i],
+				Result:     j,
+			}))
+		}
+		next[i]++
+	}
+	if w.Dropped() != 0 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "w.Dropped()",
+			Expected:   0,
+			Result:     w.Dropped(),
+		}))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncWriterOverflow(t *testing.T) {
+	type expected struct {
+		Written string
+		Dropped uint64
+	}
+	var data = []struct {
+		desc     string
+		input    Overflow
+		expected expected
+	}{
+		{
+			desc:  "drop oldest",
+			input: OverflowDropOldest,
+			expected: expected{
+				Written: "0\n3\n4\n",
+				Dropped: 2,
+			},
+		},
+
+		{
+			desc:  "drop",
+			input: OverflowDrop,
+			expected: expected{
+				Written: "0\n1\n2\n",
+				Dropped: 2,
+			},
+		},
+
+		{
+			desc:  "block",
+			input: OverflowBlock,
+			expected: expected{
+				Written: "0\n1\n2\n3\n4\n",
+				Dropped: 0,
+			},
+		},
+	}
+
+	for i, d := range data {
+		bw := newBlockingWriter()
+		w := NewAsyncWriter(bw, AsyncConfig{
+			Size:     2,
+			Overflow: d.input,
+		})
+		fmt.Fprintln(w, 0)
+		<-bw.started // 0 is in flight, so the buffer is empty
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for j := 1; j <= 4; j++ {
+				fmt.Fprintln(w, j)
+			}
+		}()
+		if d.input != OverflowBlock {
+			<-done
+		}
+		close(bw.unblock)
+		<-done
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		result := expected{
+			Written: bw.String(),
+			Dropped: w.Dropped(),
+		}
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriter(bw, AsyncConfig{})
+	fmt.Fprintln(w, "message")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.Flush(ctx); err == nil {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "err",
+			Expected:   "context deadline exceeded while write is blocked",
+			Result:     err,
+		}))
+	}
+
+	close(bw.unblock)
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bw.String() != "message\n" {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "bw.String()",
+			Expected:   "message\n",
+			Result:     bw.String(),
+		}))
+	}
+	w.Close()
+	if _, err := fmt.Fprintln(w, "closed"); err == nil {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "err",
+			Expected:   "error writing after close",
+			Result:     err,
+		}))
+	}
+}
+
+func TestAsyncWriterDroppedMetrics(t *testing.T) {
+	metrics := NewMetrics(0)
+	bw := newBlockingWriter()
+	w := NewAsyncWriter(bw, AsyncConfig{
+		Size:     2,
+		Overflow: OverflowDrop,
+	})
+	metrics.CountDropped(w)
+	fmt.Fprintln(w, 0)
+	<-bw.started // 0 is in flight, so the buffer is empty
+	for j := 1; j <= 4; j++ {
+		fmt.Fprintln(w, j)
+	}
+	close(bw.unblock)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := metrics.Snapshot().Dropped; result != 2 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "metrics.Snapshot().Dropped",
+			Expected:   2,
+			Result:     result,
+		}))
+	}
+}
+
+func TestClientFlushOnNotice(t *testing.T) {
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	w := NewAsyncWriter(writerFunc(func(p []byte) (int, error) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	}), AsyncConfig{})
+	defer w.Close()
+	logClient := NewClient(context.Background(), Config{
+		Sinks: []Sink{
+			NewWriterSink(w, SeverityInfo, NewJSONEncoder("", nil)),
+		},
+	})
+
+	for i := 0; i < 10; i++ {
+		logClient.Info(context.Background(), "info")
+	}
+	logClient.Notice(context.Background(), "notice")
+
+	mu.Lock()
+	result := strings.Count(buf.String(), "\n")
+	mu.Unlock()
+	if result != 12 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result",
+			Expected:   12,
+			Result:     result,
+		}))
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
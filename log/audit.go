@@ -0,0 +1,256 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// AuditOutcome of an audited action
+type AuditOutcome string
+
+const (
+	AuditOutcomeSuccess AuditOutcome = "SUCCESS"
+	AuditOutcomeFailure AuditOutcome = "FAILURE"
+	AuditOutcomeDenied  AuditOutcome = "DENIED"
+)
+
+// AuditRecord of who did what to which resource, written as a line of JSON
+//
+// Records are hash-chained, the hash of each being the HMAC of its members including the hash of the previous record, so
+// that edits and deletions are detected by VerifyAudit. The HMAC is keyed, so the chain cannot be recomputed after edits
+// by those able to write the log but without the key
+type AuditRecord struct {
+	Seq           uint64          `json:"seq"`
+	Time          time.Time       `json:"time"`
+	Actor         string          `json:"actor"` // From the context, see go_context.WithActor
+	Action        string          `json:"action"`
+	Resource      string          `json:"resource"`
+	Outcome       AuditOutcome    `json:"outcome"`
+	CorrelationId string          `json:"correlationId"`
+	Details       json.RawMessage `json:"details,omitempty"` // Fields, redacted of DefaultRedactedKeys
+	PrevHash      string          `json:"prevHash"`
+	Hash          string          `json:"hash"`
+}
+
+// sum of the record, being the hex encoded HMAC-SHA-256 with the key of it as JSON without its hash
+func (r AuditRecord) sum(key []byte) (string, error) {
+	r.Hash = ""
+	blob, err := json.Marshal(r)
+	if err != nil {
+		return "", go_errors.Wrap(err, "Failed marshalling audit record")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(blob)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// AuditLogger records audited actions, separately from application logs
+type AuditLogger interface {
+	// Audit the action on the resource, returning an error if it was not recorded, so callers can fail closed
+	Audit(ctx context.Context, action, resource string, outcome AuditOutcome, details ...Field) error
+	Close() error
+}
+
+type AuditConfig struct {
+	Key    []byte    // Of the HMAC of records, required, which should be a secret kept from those able to write the log
+	Path   string    // File appended to, continuing the chain of its last record
+	Writer io.Writer // Written to instead of a file, starting a new chain
+}
+
+// NewAuditLogger writing to the file at the path or to the writer of the config
+func NewAuditLogger(config AuditConfig) (AuditLogger, error) {
+	if len(config.Key) == 0 {
+		return nil, go_errors.New("Missing key")
+	}
+	a := &auditLogger{
+		key: config.Key,
+		now: time.Now,
+		redactor: newRedactor(Redaction{
+			Keys: DefaultRedactedKeys,
+		}),
+		w: config.Writer,
+	}
+	if config.Path == "" {
+		if config.Writer == nil {
+			return nil, go_errors.New("Missing path or writer")
+		}
+		return a, nil
+	}
+	f, err := os.OpenFile(config.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed opening audit log")
+	}
+	last, err := lastAuditRecord(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if last != nil {
+		a.seq, a.prevHash = last.Seq, last.Hash
+	}
+	a.file, a.w = f, f
+	return a, nil
+}
+
+// lastAuditRecord of the file, nil if it is empty
+func lastAuditRecord(r io.Reader) (*AuditRecord, error) {
+	var line []byte
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			line = append(line[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, go_errors.Wrap(err, "Failed reading audit log")
+	}
+	if line == nil {
+		return nil, nil
+	}
+	var last AuditRecord
+	if err := json.Unmarshal(line, &last); err != nil {
+		return nil, go_errors.Wrap(err, "Failed unmarshalling last audit record")
+	}
+	return &last, nil
+}
+
+type auditLogger struct {
+	file     *os.File // Nil if writing to a writer
+	key      []byte
+	mu       sync.Mutex
+	now      func() time.Time
+	prevHash string
+	redactor *redactor
+	seq      uint64
+	w        io.Writer
+}
+
+func (a *auditLogger) Audit(ctx context.Context, action, resource string, outcome AuditOutcome, details ...Field) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := AuditRecord{
+		Seq:           a.seq + 1,
+		Time:          a.now().UTC(),
+		Actor:         go_context.Actor(ctx),
+		Action:        action,
+		Resource:      resource,
+		Outcome:       outcome,
+		CorrelationId: go_context.CorrelationId(ctx),
+		PrevHash:      a.prevHash,
+	}
+	if len(details) > 0 {
+		r.Details = fieldsJSON(a.redactor.redact(details))
+	}
+	hash, err := r.sum(a.key)
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	line, err := json.Marshal(r)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed marshalling audit record")
+	}
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		return go_errors.Wrap(err, "Failed writing audit record")
+	}
+	if a.file != nil {
+		if err := a.file.Sync(); err != nil {
+			return go_errors.Wrap(err, "Failed syncing audit log")
+		}
+	}
+	a.seq, a.prevHash = r.Seq, r.Hash
+	return nil
+}
+
+// Close the file of the audit logger, if any
+func (a *auditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	a.w = closedWriter{}
+	if err != nil {
+		return go_errors.Wrap(err, "Failed closing audit log")
+	}
+	return nil
+}
+
+type closedWriter struct{}
+
+func (closedWriter) Write(p []byte) (int, error) {
+	return 0, go_errors.New("Audit log is closed")
+}
+
+// VerifyAudit chain of records read from the reader with the key they were written with, returning the last record, nil
+// if there are none
+//
+// The first record must follow the previous hash, or be the first of a chain if it is empty, e.g. for a file continuing
+// one which has been archived. Deletion of records from the end of a chain is only detected by comparing the last
+// record with one noted elsewhere
+func VerifyAudit(r io.Reader, key []byte, prevHash string) (*AuditRecord, error) {
+	var last *AuditRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return last, go_errors.Wrapf(err, "Failed unmarshalling audit record at line %d", line)
+		}
+		switch {
+		case last == nil && prevHash == "" && record.Seq != 1:
+			return last, go_errors.Errorf("Audit record at line %d has seq %d, not 1 as the first of a chain", line, record.Seq)
+		case last != nil && record.Seq != last.Seq+1:
+			return last, go_errors.Errorf("Audit record at line %d has seq %d, not %d, so records are missing", line, record.Seq, last.Seq+1)
+		case record.PrevHash != prevHash:
+			return last, go_errors.Errorf("Audit record at line %d has previous hash %q, not %q, so records are missing or edited", line, record.PrevHash, prevHash)
+		}
+		hash, err := record.sum(key)
+		if err != nil {
+			return last, err
+		}
+		if !hmac.Equal([]byte(hash), []byte(record.Hash)) {
+			// The expected hash is not in the error, as it would let those without the key forge records
+			return last, go_errors.Errorf("Audit record at line %d has hash %q, which does not match, so it is edited or the key is wrong", line, record.Hash)
+		}
+		last, prevHash = &record, record.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return last, go_errors.Wrap(err, "Failed reading audit log")
+	}
+	return last, nil
+}
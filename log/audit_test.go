@@ -0,0 +1,193 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestAuditLogger(t *testing.T) {
+	key := []byte("key")
+	path := filepath.Join(t.TempDir(), "audit.log")
+	ctx := go_context.WithActor(go_context.WithCorrelationId(context.Background(), "correlationId"), "user@example.com")
+	for _, v := range []string{"first", "second"} {
+		auditLogger, err := NewAuditLogger(AuditConfig{
+			Key:  key,
+			Path: path,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := auditLogger.Audit(ctx, "secrets.decrypt", v, AuditOutcomeSuccess, FmtString("hunter2", "password"), FmtInt(1, "version")); err != nil {
+			t.Fatal(err)
+		}
+		if err := auditLogger.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(blob)), "\n")
+
+	last, err := VerifyAudit(bytes.NewReader(blob), key, "")
+	if err != nil || last == nil || last.Seq != 2 || last.Resource != "second" {
+		t.Fatal(go_testing.Errorf(go_testing.Error{
+			Unexpected: "VerifyAudit",
+			Expected:   "second record of a valid chain resumed from the file",
+			Result:     []interface{}{last, err},
+		}))
+	}
+	for _, v := range []string{`"actor":"user@example.com"`, `"correlationId":"correlationId"`, `"details":{"password":"[REDACTED]","version":1}`} {
+		if !strings.Contains(lines[0], v) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "lines[0]",
+				Expected:   v,
+				Result:     lines[0],
+			}))
+		}
+	}
+
+	var edited AuditRecord
+	if err := json.Unmarshal([]byte(lines[1]), &edited); err != nil {
+		t.Fatal(err)
+	}
+	edited.Actor, edited.Hash = "other@example.com", ""
+	unkeyed, err := json.Marshal(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rehashed := sha256.Sum256(unkeyed)
+	edited.Hash = hex.EncodeToString(rehashed[:])
+	rehashedLine, err := json.Marshal(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data = []struct {
+		desc     string
+		input    []string
+		key      []byte
+		prevHash string
+		expected string
+	}{
+		{
+			desc:     "edited",
+			input:    []string{strings.Replace(lines[0], "user@example.com", "other@example.com", 1), lines[1]},
+			key:      key,
+			expected: "so it is edited",
+		},
+
+		{
+			desc:     "edited and rehashed without the key",
+			input:    []string{lines[0], string(rehashedLine)},
+			key:      key,
+			expected: "so it is edited",
+		},
+
+		{
+			desc:     "wrong key",
+			input:    lines,
+			key:      []byte("wrong"),
+			expected: "the key is wrong",
+		},
+
+		{
+			desc:     "first deleted",
+			key:      key,
+			input:    lines[1:],
+			expected: "not 1 as the first of a chain",
+		},
+
+		{
+			desc:     "continued from previous hash",
+			key:      key,
+			input:    lines[1:],
+			prevHash: last.PrevHash,
+		},
+
+		{
+			desc:     "reordered",
+			key:      key,
+			input:    []string{lines[1], lines[0]},
+			prevHash: last.PrevHash,
+			expected: "so records are missing",
+		},
+
+		{
+			desc:     "malformed",
+			key:      key,
+			input:    []string{lines[0], "{"},
+			expected: "at line 2",
+		},
+	}
+
+	for i, d := range data {
+		_, err := VerifyAudit(strings.NewReader(strings.Join(d.input, "\n")), d.key, d.prevHash)
+
+		if (err == nil) != (d.expected == "") || (err != nil && !strings.Contains(err.Error(), d.expected)) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+	}
+}
+
+func TestAuditLoggerClosed(t *testing.T) {
+	auditLogger, err := NewAuditLogger(AuditConfig{
+		Key:  []byte("key"),
+		Path: filepath.Join(t.TempDir(), "audit.log"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger.Close()
+
+	if err := auditLogger.Audit(context.Background(), "action", "resource", AuditOutcomeFailure); err == nil {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "err",
+			Expected:   "error auditing once closed",
+			Result:     err,
+		}))
+	}
+}
+
+func TestNewAuditLoggerMissingKey(t *testing.T) {
+	if _, err := NewAuditLogger(AuditConfig{Writer: &bytes.Buffer{}}); err == nil {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "err",
+			Expected:   "error creating audit logger without key",
+			Result:     err,
+		}))
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	helpers    sync.Map // Function names of helpers
+	hasHelpers int32    // Atomic, set once a helper is marked, so callers are found without walking frames until then
+)
+
+// Helper marks the calling function as a log helper, like testing.T.Helper
+//
+// Entries are attributed to the first caller on the stack which is not a helper, e.g. the caller of a function which
+// wraps the client with fields common to its call sites
+func Helper() {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok {
+		return
+	}
+	if _, loaded := helpers.LoadOrStore(runtime.FuncForPC(pc).Name(), struct{}{}); !loaded {
+		atomic.StoreInt32(&hasHelpers, 1)
+	}
+}
+
+// Caller skip frames above the function calling Caller, skipping helpers
+//
+// Frames of the stdlib's log package are also skipped, so output of a logger from NewStdLogger is attributed to
+// its caller. For use by implementations of Client, e.g. mocks
+func Caller(skip int) (file string, line int, function string) {
+	if atomic.LoadInt32(&hasHelpers) == 0 {
+		pc, file, line, ok := runtime.Caller(skip + 1)
+		if !ok {
+			return "", 0, ""
+		}
+		if function = runtime.FuncForPC(pc).Name(); !isStdLog(function) {
+			return file, line, function
+		}
+	}
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(skip+2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if !isHelper(frame.Function) || !more {
+			return frame.File, frame.Line, frame.Function
+		}
+	}
+}
+
+func isHelper(function string) bool {
+	if isStdLog(function) {
+		return true
+	}
+	_, ok := helpers.Load(function)
+	return ok
+}
+
+func isStdLog(function string) bool {
+	return strings.HasPrefix(function, "log.")
+}
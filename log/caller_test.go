@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"testing"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func helperLog(logClient Client) {
+	Helper()
+	logClient.Info(context.Background(), "message")
+}
+
+func wrapperLog(logClient Client) {
+	logClient.Info(context.Background(), "message")
+}
+
+func wrapperWrapperLog(logClient Client) {
+	wrapperLog(logClient.WithCallerSkip(1))
+}
+
+func TestCaller(t *testing.T) {
+	type expected struct {
+		Function string
+		Line     bool
+	}
+	var data = []struct {
+		desc     string
+		input    func(logClient Client)
+		config   Config
+		expected expected
+	}{
+		{
+			desc:  "helper skipped",
+			input: helperLog,
+			expected: expected{
+				Function: "github.com/caigwatkin/go/log.TestCaller",
+				Line:     true,
+			},
+		},
+
+		{
+			desc:  "wrapper not skipped",
+			input: wrapperLog,
+			expected: expected{
+				Function: "github.com/caigwatkin/go/log.wrapperLog",
+				Line:     true,
+			},
+		},
+
+		{
+			desc:  "caller skip",
+			input: wrapperWrapperLog,
+			expected: expected{
+				Function: "github.com/caigwatkin/go/log.wrapperWrapperLog",
+				Line:     true,
+			},
+		},
+
+		{
+			desc:  "stdlib logger",
+			input: func(logClient Client) { NewStdLogger(context.Background(), logClient, SeverityInfo).Print("message") },
+			expected: expected{
+				Function: "github.com/caigwatkin/go/log.TestCaller.func1",
+				Line:     true,
+			},
+		},
+
+		{
+			desc:  "disabled",
+			input: helperLog,
+			config: Config{
+				DisableCaller: true,
+			},
+			expected: expected{},
+		},
+	}
+
+	for i, d := range data {
+		var buf bytes.Buffer
+		d.config.Sinks = []Sink{
+			NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+		}
+		logClient := NewClient(context.Background(), d.config)
+		buf.Reset()
+		d.input(logClient)
+		var entry struct {
+			SourceLocation struct {
+				Function string
+				Line     string
+			} `json:"logging.googleapis.com/sourceLocation"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		result := expected{
+			Function: entry.SourceLocation.Function,
+			Line:     entry.SourceLocation.Line != "0",
+		}
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestCallerLine(t *testing.T) {
+	var buf bytes.Buffer
+	logClient := NewClient(context.Background(), Config{
+		Sinks: []Sink{
+			NewWriterSink(&buf, SeverityInfo, nil),
+		},
+	})
+	buf.Reset()
+	_, file, line, _ := runtime.Caller(0)
+	helperLog(logClient)
+	expected := file + ":" + strconv.Itoa(line+1) + " github.com/caigwatkin/go/log.TestCallerLine]"
+
+	if !bytes.Contains(buf.Bytes(), []byte(expected)) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "buf.String()",
+			Expected:   expected,
+			Result:     buf.String(),
+		}))
+	}
+}
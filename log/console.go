@@ -0,0 +1,202 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ConsoleConfig of the console encoder
+type ConsoleConfig struct {
+	Verbose bool      // Fields on indented lines, as NewConsoleEncoder, otherwise entries are on a single line
+	Color   ColorMode // Defaults to ColorAuto
+}
+
+// ColorMode of console output
+type ColorMode int
+
+const (
+	// ColorAuto colours output if ColorEnabled for the writer
+	ColorAuto ColorMode = iota
+
+	// ColorAlways colours output
+	ColorAlways
+
+	// ColorNever leaves output uncoloured
+	ColorNever
+)
+
+// NewConsoleEncoderFor output to the writer, coloured as configured
+//
+// Entries are compact by default, on a single line of time, severity, logger, message and then key=value fields,
+// ending with the caller and its function, qualified by its package name
+func NewConsoleEncoderFor(w io.Writer, config ConsoleConfig) Encoder {
+	color := config.Color == ColorAlways || (config.Color == ColorAuto && ColorEnabled(w))
+	if config.Verbose {
+		return consoleEncoder{
+			color: color,
+		}
+	}
+	return compactEncoder{
+		color: color,
+	}
+}
+
+// ColorEnabled for output to the writer
+//
+// NO_COLOR disables colour and FORCE_COLOR enables it, see https://no-color.org, otherwise colour is enabled if the
+// writer is a terminal which is not dumb
+func ColorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if v := os.Getenv("FORCE_COLOR"); v != "" {
+		return v != "0" && v != "false"
+	}
+	return os.Getenv("TERM") != "dumb" && isTerminal(w)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// compactEncoder of entries on a single line, with fields as key=value pairs in order
+type compactEncoder struct {
+	color bool
+}
+
+func (c compactEncoder) Encode(e Entry) string {
+	var b bytes.Buffer
+	b.WriteString(e.Time.Format("2006/01/02 15:04:05.000"))
+	b.WriteByte(' ')
+	if c.color {
+		fmt.Fprintf(&b, "\x1b[%dm%-5s%s", severityColors[e.Severity], e.Severity, colorReset)
+	} else {
+		fmt.Fprintf(&b, "%-5s", e.Severity)
+	}
+	if e.Logger != "" {
+		fmt.Fprintf(&b, " [%s]", e.Logger)
+	}
+	b.WriteByte(' ')
+	b.WriteString(consoleMessage(e.Message))
+	for _, f := range e.Fields {
+		b.WriteByte(' ')
+		writeFieldCompact(&b, f, c.color)
+	}
+	if e.CorrelationId != "" {
+		b.WriteByte(' ')
+		writeFieldCompact(&b, FmtString(e.CorrelationId, "correlationId"), c.color)
+	}
+	if e.File != "" {
+		b.WriteByte(' ')
+		writeFieldCompact(&b, FmtString(filepath.Base(e.File)+":"+strconv.Itoa(e.Line), "caller"), c.color)
+	}
+	if e.Function != "" {
+		b.WriteByte(' ')
+		writeFieldCompact(&b, FmtString(path.Base(e.Function), "function"), c.color)
+	}
+	return b.String()
+}
+
+// consoleMessageReplacer escapes line breaks, so that a message cannot split or forge console entries
+var consoleMessageReplacer = strings.NewReplacer("\r", `\r`, "\n", `\n`)
+
+// consoleMessage with line breaks escaped
+func consoleMessage(message string) string {
+	return consoleMessageReplacer.Replace(message)
+}
+
+// writeFieldCompact as key=value, quoting strings only if needed and other values as JSON
+func writeFieldCompact(b *bytes.Buffer, f Field, color bool) {
+	if color {
+		b.WriteString("\x1b[2m")
+	}
+	b.WriteString(compactString(f.key))
+	b.WriteByte('=')
+	if color {
+		b.WriteString(colorReset)
+	}
+	switch f.kind {
+	case kindAny:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		_, value := anyType(f.iface)
+		blob, err := json.Marshal(value)
+		if err != nil {
+			blob = []byte(`"NOT JSON MARSHALLABLE"`)
+		}
+		b.Write(blob)
+	case kindBytes:
+		b.WriteString(compactString(string(f.iface.([]byte))))
+	case kindDuration:
+		b.WriteString(time.Duration(f.integer).String())
+	case kindError:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		b.WriteString(compactString(errorMessage(f.iface.(error))))
+	case kindRawJSON:
+		var s string
+		if err := json.Unmarshal(f.iface.(json.RawMessage), &s); err != nil {
+			writeValueJSON(b, f)
+			return
+		}
+		b.WriteString(compactString(s))
+	case kindSecret:
+		b.WriteString(Redacted)
+	case kindString:
+		b.WriteString(compactString(f.str))
+	case kindStringer:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		b.WriteString(compactString(f.iface.(fmt.Stringer).String()))
+	case kindTime:
+		b.WriteString(f.iface.(time.Time).Format(time.RFC3339Nano))
+	default:
+		writeValueJSON(b, f)
+	}
+}
+
+// compactString unquoted unless empty or it has spaces, quotes, equals signs or unprintable runes
+func compactString(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r == '"' || r == '=' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func Test_compactEncoder(t *testing.T) {
+	at := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	var data = []struct {
+		desc     string
+		input    Entry
+		expected string
+	}{
+		{
+			desc: "fields in order",
+			input: Entry{
+				Time:          at,
+				Severity:      SeverityInfo,
+				Message:       "Request completed",
+				CorrelationId: "correlationId",
+				File:          "/src/http/handler.go",
+				Line:          12,
+				Function:      "github.com/caigwatkin/go/http.(*handler).ServeHTTP",
+				Fields: []Field{
+					FmtString("GET", "method"),
+					FmtInt(200, "status"),
+					FmtDuration(1500*time.Millisecond, "elapsed"),
+					FmtStrings([]string{"a", "b"}, "tags"),
+				},
+			},
+			expected: `2021/09/01 12:00:00.000 INFO  Request completed method=GET status=200 elapsed=1.5s tags=["a","b"] correlationId=correlationId caller=handler.go:12 function=http.(*handler).ServeHTTP`,
+		},
+
+		{
+			desc: "quoted strings and named logger",
+			input: Entry{
+				Time:     at,
+				Severity: SeverityError,
+				Message:  "Failed",
+				Logger:   "db",
+				Fields: []Field{
+					FmtString("", "empty"),
+					FmtString("a b", "spaced"),
+					FmtString("k=v", "equals"),
+					FmtError(errors.New("not found")),
+					FmtSecret("plaintext", "token"),
+				},
+			},
+			expected: `2021/09/01 12:00:00.000 ERROR [db] Failed empty="" spaced="a b" equals="k=v" error="not found" token=[REDACTED]`,
+		},
+
+		{
+			desc: "line breaks in message escaped",
+			input: Entry{
+				Time:     at,
+				Severity: SeverityWarn,
+				Message:  "Failed\r\n2021/09/01 12:00:00.000 INFO  Forged",
+			},
+			expected: `2021/09/01 12:00:00.000 WARN  Failed\r\n2021/09/01 12:00:00.000 INFO  Forged`,
+		},
+
+		{
+			desc: "any and group as JSON",
+			input: Entry{
+				Time:     at,
+				Severity: SeverityDebug,
+				Message:  "Debugging",
+				Fields: []Field{
+					FmtAny(map[string]int{"b": 2, "a": 1}, "counts"),
+					FmtGroup("user", FmtString("u1", "id")),
+					FmtRawJSON([]byte(`"raw"`), "raw"),
+				},
+			},
+			expected: `2021/09/01 12:00:00.000 DEBUG Debugging counts={"a":1,"b":2} user={"id":"u1"} raw=raw`,
+		},
+	}
+
+	for i, d := range data {
+		result := compactEncoder{}.Encode(d.input)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestNewConsoleEncoderFor(t *testing.T) {
+	entry := Entry{
+		Severity: SeverityWarn,
+		Message:  "message",
+		Fields: []Field{
+			FmtInt(1, "count"),
+		},
+	}
+	type input struct {
+		config   ConsoleConfig
+		noColor  string
+		force    string
+		terminal bool
+	}
+	type expected struct {
+		Color   bool
+		Verbose bool
+	}
+	var data = []struct {
+		desc     string
+		input    input
+		expected expected
+	}{
+		{
+			desc:     "auto not a terminal",
+			input:    input{},
+			expected: expected{},
+		},
+
+		{
+			desc: "auto forced",
+			input: input{
+				force: "1",
+			},
+			expected: expected{
+				Color: true,
+			},
+		},
+
+		{
+			desc: "auto forced off",
+			input: input{
+				force: "0",
+			},
+			expected: expected{},
+		},
+
+		{
+			desc: "no color overrides force",
+			input: input{
+				config: ConsoleConfig{
+					Verbose: true,
+				},
+				noColor: "1",
+				force:   "1",
+			},
+			expected: expected{
+				Verbose: true,
+			},
+		},
+
+		{
+			desc: "always",
+			input: input{
+				config: ConsoleConfig{
+					Color: ColorAlways,
+				},
+				noColor: "1",
+			},
+			expected: expected{
+				Color: true,
+			},
+		},
+
+		{
+			desc: "never",
+			input: input{
+				config: ConsoleConfig{
+					Verbose: true,
+					Color:   ColorNever,
+				},
+				force: "1",
+			},
+			expected: expected{
+				Verbose: true,
+			},
+		},
+	}
+
+	for i, d := range data {
+		t.Setenv("NO_COLOR", d.input.noColor)
+		t.Setenv("FORCE_COLOR", d.input.force)
+		line := NewConsoleEncoderFor(&bytes.Buffer{}, d.input.config).Encode(entry)
+		result := expected{
+			Color:   bytes.Contains([]byte(line), []byte("\x1b[")),
+			Verbose: bytes.Contains([]byte(line), []byte("\n")),
+		}
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func Test_isTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if isTerminal(f) || isTerminal(&bytes.Buffer{}) {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "isTerminal",
+			Expected:   "false for files and buffers",
+			Result:     true,
+		}))
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// ParseJSONEntry of a line encoded by the JSON encoder, or of a LogEntry exported from Cloud Logging, e.g. for viewing
+//
+// Fields are those of the payload in order, as raw JSON
+func ParseJSONEntry(line []byte) (Entry, error) {
+	var j struct {
+		Severity               string              `json:"severity"`
+		Time                   time.Time           `json:"time"`
+		Timestamp              time.Time           `json:"timestamp"`
+		Message                *string             `json:"message"`
+		SourceLocation         *jsonSourceLocation `json:"logging.googleapis.com/sourceLocation"`
+		ExportedSourceLocation *jsonSourceLocation `json:"sourceLocation"`
+		Trace                  string              `json:"logging.googleapis.com/trace"`
+		ExportedTrace          string              `json:"trace"`
+		Labels                 map[string]string   `json:"logging.googleapis.com/labels"`
+		ExportedLabels         map[string]string   `json:"labels"`
+		Payload                json.RawMessage     `json:"jsonPayload"`
+	}
+	if err := json.Unmarshal(line, &j); err != nil {
+		return Entry{}, go_errors.Wrap(err, "Failed unmarshalling entry")
+	}
+	severity, err := parseJSONSeverity(j.Severity)
+	if err != nil {
+		return Entry{}, err
+	}
+	fields, err := parsePayload(j.Payload)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{
+		Time:     j.Time,
+		Severity: severity,
+		TraceId:  j.Trace,
+		Fields:   fields,
+	}
+	if e.Time.IsZero() {
+		e.Time = j.Timestamp
+	}
+	if e.TraceId == "" {
+		e.TraceId = j.ExportedTrace
+	}
+	if i := strings.LastIndex(e.TraceId, "/traces/"); i >= 0 {
+		e.TraceId = e.TraceId[i+len("/traces/"):]
+	}
+	if j.Message != nil {
+		e.Message = *j.Message
+	} else {
+		e.Message, e.Fields = exportedPayload(e.Fields)
+	}
+	location := j.SourceLocation
+	if location == nil {
+		location = j.ExportedSourceLocation
+	}
+	if location != nil {
+		e.File, e.Function = location.File, location.Function
+		e.Line, _ = strconv.Atoi(location.Line)
+	}
+	labels := j.Labels
+	if labels == nil {
+		labels = j.ExportedLabels
+	}
+	for k, v := range labels {
+		switch k {
+		case "correlationId":
+			e.CorrelationId = v
+		case "logger":
+			e.Logger = v
+		default:
+			if e.Labels == nil {
+				e.Labels = make(map[string]string)
+			}
+			e.Labels[k] = v
+		}
+	}
+	return e, nil
+}
+
+type jsonSourceLocation struct {
+	File     string `json:"file"`
+	Line     string `json:"line"`
+	Function string `json:"function"`
+}
+
+func parseJSONSeverity(s string) (Severity, error) {
+	for k, v := range severityNames {
+		if v == s {
+			return k, nil
+		}
+	}
+	return ParseSeverity(s)
+}
+
+// parsePayload members in order, as fields of raw JSON
+func parsePayload(payload json.RawMessage) ([]Field, error) {
+	if len(payload) == 0 || string(payload) == "null" {
+		return nil, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(payload))
+	if t, err := d.Token(); err != nil || t != json.Delim('{') {
+		return nil, go_errors.New("Payload is not an object")
+	}
+	var fields []Field
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, go_errors.Wrap(err, "Failed decoding payload")
+		}
+		var value json.RawMessage
+		if err := d.Decode(&value); err != nil {
+			return nil, go_errors.Wrap(err, "Failed decoding payload")
+		}
+		fields = append(fields, FmtRawJSON(value, t.(string)))
+	}
+	return fields, nil
+}
+
+// exportedPayload of an entry exported from Cloud Logging, where the message and payload of the JSON encoder are
+// members of the payload
+func exportedPayload(fields []Field) (string, []Field) {
+	var message string
+	var rest []Field
+	for _, f := range fields {
+		switch f.key {
+		case "message":
+			if err := json.Unmarshal(f.iface.(json.RawMessage), &message); err != nil {
+				rest = append(rest, f)
+			}
+		case "jsonPayload":
+			nested, err := parsePayload(f.iface.(json.RawMessage))
+			if err != nil {
+				rest = append(rest, f)
+				continue
+			}
+			rest = append(rest, nested...)
+		default:
+			rest = append(rest, f)
+		}
+	}
+	return message, rest
+}
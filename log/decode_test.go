@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestParseJSONEntry(t *testing.T) {
+	at := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	expected := Entry{
+		Time:          at,
+		Severity:      SeverityWarn,
+		Message:       "message",
+		CorrelationId: "b,a",
+		TraceId:       "traceId",
+		File:          "file.go",
+		Line:          1,
+		Function:      "funcName",
+		Logger:        "db",
+		Labels: map[string]string{
+			"app": "app",
+		},
+		Fields: []Field{
+			FmtRawJSON([]byte(`"value"`), "name"),
+			FmtRawJSON([]byte(`{"b":1,"a":[1,2]}`), "group"),
+		},
+	}
+	var data = []struct {
+		desc     string
+		input    string
+		expected *Entry
+	}{
+		{
+			desc: "encoded",
+			input: jsonEncoder{
+				gcpProjectId: "project",
+				labels: map[string]string{
+					"app": "app",
+				},
+			}.Encode(Entry{
+				Time:          at,
+				Severity:      SeverityWarn,
+				Message:       "message",
+				CorrelationId: "b,a",
+				TraceId:       "traceId",
+				File:          "file.go",
+				Line:          1,
+				Function:      "funcName",
+				Logger:        "db",
+				Fields: []Field{
+					FmtString("value", "name"),
+					FmtGroup("group", FmtInt(1, "b"), FmtInts([]int{1, 2}, "a")),
+				},
+			}),
+			expected: &expected,
+		},
+
+		{
+			desc:     "exported",
+			input:    `{"insertId":"1","jsonPayload":{"message":"message","jsonPayload":{"name":"value","group":{"b":1,"a":[1,2]}}},"labels":{"app":"app","correlationId":"b,a","logger":"db"},"severity":"WARNING","sourceLocation":{"file":"file.go","line":"1","function":"funcName"},"timestamp":"2021-09-01T12:00:00Z","trace":"projects/project/traces/traceId"}`,
+			expected: &expected,
+		},
+
+		{
+			desc:  "invalid severity",
+			input: `{"severity":"VERBOSE","message":"message"}`,
+		},
+
+		{
+			desc:  "not JSON",
+			input: `panic: runtime error`,
+		},
+	}
+
+	for i, d := range data {
+		result, err := ParseJSONEntry([]byte(d.input))
+
+		if (err == nil) != (d.expected != nil) || (d.expected != nil && !reflect.DeepEqual(result, *d.expected)) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     []interface{}{result, err},
+			}))
+		}
+	}
+}
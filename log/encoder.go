@@ -0,0 +1,626 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Entry to be encoded and written by a sink
+type Entry struct {
+	Time          time.Time
+	Severity      Severity
+	Message       string
+	CorrelationId string
+	TraceId       string
+	File          string
+	Line          int
+	Function      string
+	Logger        string            // Name of the logger, see Client.Named
+	Labels        map[string]string // Added to the labels of the JSON encoder, e.g. by NewLabelsHook
+	Fields        []Field
+	redactor      *redactor // Of the client, while hooks are run
+	size          *int      // Of the first line encoded for the entry, for metrics, see Entry.encoded
+}
+
+// redacted entry, for hooks which write it before the client redacts it
+func (e Entry) redacted() Entry {
+	if e.redactor != nil {
+		e.Fields = e.redactor.redact(e.Fields)
+		e.redactor = nil
+	}
+	return e
+}
+
+// encoded line of the entry by a sink, noting its size for metrics if it is the first
+func (e Entry) encoded(line string) string {
+	if e.size != nil && *e.size == 0 {
+		*e.size = len(line)
+	}
+	return line
+}
+
+// Encoder of entries to a single line of output, without a trailing newline
+type Encoder interface {
+	Encode(e Entry) string
+}
+
+// NewConsoleEncoder for local development, coloured and indented for reading in a terminal
+//
+// Output is always coloured, see NewConsoleEncoderFor to colour only when writing to a terminal
+func NewConsoleEncoder() Encoder {
+	return consoleEncoder{
+		color: true,
+	}
+}
+
+// NewJSONEncoder for remote, as Cloud Logging structured LogEntries
+//
+// GCP project ID qualifies trace IDs, and labels are added to those of every entry
+func NewJSONEncoder(gcpProjectId string, labels map[string]string) Encoder {
+	return jsonEncoder{
+		gcpProjectId: gcpProjectId,
+		labels:       labels,
+	}
+}
+
+// NewErrorReportingJSONEncoder for remote, as NewJSONEncoder, with error entries shaped for Cloud Error Reporting
+func NewErrorReportingJSONEncoder(gcpProjectId string, labels map[string]string, errorReporting ErrorReporting) Encoder {
+	return jsonEncoder{
+		errorReporting: &errorReporting,
+		gcpProjectId:   gcpProjectId,
+		labels:         labels,
+	}
+}
+
+const (
+	red    = 31
+	green  = 32
+	yellow = 33
+	cyan   = 36
+
+	colorReset = "\x1b[0m"
+)
+
+var severityColors = map[Severity]int{
+	SeverityDebug:  green,
+	SeverityInfo:   cyan,
+	SeverityNotice: cyan,
+	SeverityWarn:   yellow,
+	SeverityError:  red,
+	SeverityFatal:  red,
+}
+
+// consoleEncoder of entries with fields on indented lines
+type consoleEncoder struct {
+	color bool
+}
+
+func (c consoleEncoder) Encode(e Entry) string {
+	var logger string
+	if e.Logger != "" {
+		logger = fmt.Sprintf("[%s] ", e.Logger)
+	}
+	line := fmt.Sprintf("%-5s %s %s%s", e.Severity, e.Time.Format("2006/01/02 15:04:05.000000"), logger, fmtLog(consoleMessage(e.Message), e.CorrelationId, e.File, e.Function, e.Line, e.Fields))
+	if !c.color {
+		return strings.TrimSuffix(line, colorReset)
+	}
+	return fmt.Sprintf("\x1b[%dm%s", severityColors[e.Severity], line)
+}
+
+func fmtLog(message, correlationId, file, funcName string, line int, fields []Field) string {
+	if file == "" && funcName == "" {
+		return fmt.Sprintf("[%s] [%s] %s%s", message, correlationId, fmtFields(fields), colorReset)
+	}
+	return fmt.Sprintf("[%s] [%s] [%s:%d %s] %s%s", message, correlationId, file, line, funcName, fmtFields(fields), colorReset)
+}
+
+func fmtFields(fields []Field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteString("{\n\t")
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(",\n\t")
+		}
+		writeFieldConsole(&b, f)
+	}
+	b.WriteString("\n}")
+	return b.String()
+}
+
+// writeFieldConsole as an indented name/value pair
+func writeFieldConsole(b *bytes.Buffer, f Field) {
+	b.WriteString(strconv.Quote(f.key))
+	b.WriteString(": ")
+	switch f.kind {
+	case kindAny:
+		b.WriteString(fmtAnyConsole(f.iface, "\t\t"))
+	case kindAnys:
+		values := f.iface.([]interface{})
+		writeSliceConsole(b, len(values), func(i int) string {
+			return fmtAnyConsole(values[i], "\t\t\t")
+		})
+	case kindBool:
+		b.WriteString(strconv.FormatBool(f.integer == 1))
+	case kindBools:
+		values := f.iface.([]bool)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatBool(values[i])
+		})
+	case kindByte:
+		b.WriteString(strconv.QuoteRune(rune(f.integer)))
+	case kindBytes:
+		fmt.Fprintf(b, "%q", f.iface.([]byte))
+	case kindDuration:
+		b.WriteString(strconv.Quote(time.Duration(f.integer).String()))
+	case kindDurations:
+		values := f.iface.([]time.Duration)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.Quote(values[i].String())
+		})
+	case kindError:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		info := newErrorInfo(f.iface.(error))
+		if info.trace == info.message {
+			b.WriteString(strconv.Quote(info.message))
+			return
+		}
+		var blob bytes.Buffer
+		writeErrorJSON(&blob, info)
+		if err := json.Indent(b, blob.Bytes(), "\t", "\t"); err != nil {
+			b.WriteString(strconv.Quote(info.message))
+		}
+	case kindFloat32:
+		b.WriteString(strconv.FormatFloat(f.float, 'f', 5, 64))
+	case kindFloat32s:
+		values := f.iface.([]float32)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatFloat(float64(values[i]), 'f', 5, 64)
+		})
+	case kindFloat64:
+		b.WriteString(strconv.FormatFloat(f.float, 'f', 10, 64))
+	case kindFloat64s:
+		values := f.iface.([]float64)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatFloat(values[i], 'f', 10, 64)
+		})
+	case kindGroup, kindMap, kindObject, kindRawJSON:
+		writeValueJSON(b, f)
+	case kindInt, kindInt32, kindInt64:
+		b.WriteString(strconv.FormatInt(f.integer, 10))
+	case kindInts:
+		values := f.iface.([]int)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.Itoa(values[i])
+		})
+	case kindInt32s:
+		values := f.iface.([]int32)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatInt(int64(values[i]), 10)
+		})
+	case kindInt64s:
+		values := f.iface.([]int64)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatInt(values[i], 10)
+		})
+	case kindSecret:
+		b.WriteString(strconv.Quote(Redacted))
+	case kindString:
+		b.WriteString(strconv.Quote(f.str))
+	case kindStringer:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		b.WriteString(strconv.Quote(f.iface.(fmt.Stringer).String()))
+	case kindStrings:
+		values := f.iface.([]string)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.Quote(values[i])
+		})
+	case kindTime:
+		b.WriteString(strconv.Quote(f.iface.(time.Time).Format(time.RFC3339Nano)))
+	case kindTimes:
+		values := f.iface.([]time.Time)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.Quote(values[i].Format(time.RFC3339Nano))
+		})
+	case kindUint, kindUint32, kindUint64:
+		b.WriteString(strconv.FormatUint(uint64(f.integer), 10))
+	case kindUints:
+		values := f.iface.([]uint)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatUint(uint64(values[i]), 10)
+		})
+	case kindUint32s:
+		values := f.iface.([]uint32)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatUint(uint64(values[i]), 10)
+		})
+	case kindUint64s:
+		values := f.iface.([]uint64)
+		writeSliceConsole(b, len(values), func(i int) string {
+			return strconv.FormatUint(values[i], 10)
+		})
+	}
+}
+
+func writeSliceConsole(b *bytes.Buffer, n int, value func(i int) string) {
+	if n == 0 {
+		b.WriteString("[]")
+		return
+	}
+	b.WriteString("[\n\t\t")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(",\n\t\t")
+		}
+		b.WriteString(value(i))
+	}
+	b.WriteString("\n\t]")
+}
+
+func fmtAnyConsole(value interface{}, prefix string) string {
+	if value == nil {
+		return "null"
+	}
+	typ, value := anyType(value)
+	indent := prefix[:len(prefix)-1]
+	blob, err := json.MarshalIndent(value, prefix, "\t")
+	if err != nil {
+		return fmt.Sprintf("{\n%s\"type\": %q,\n%s\"value\": \"NOT JSON MARSHALLABLE\"\n%s}", prefix, typ, prefix, indent)
+	}
+	return fmt.Sprintf("{\n%s\"type\": %q,\n%s\"value\": %s\n%s}", prefix, typ, prefix, blob, indent)
+}
+
+// errorMessage of the error, without the cost of its error info
+func errorMessage(err error) string {
+	if info, ok := err.(*errorInfo); ok {
+		return info.message
+	}
+	return fmt.Sprintf("%s", err)
+}
+
+// jsonEncoder for a Cloud Logging structured LogEntry on a single line
+//
+// See https://cloud.google.com/logging/docs/structured-logging for the special fields
+type jsonEncoder struct {
+	errorReporting *ErrorReporting // Nil unless configured
+	gcpProjectId   string
+	labels         map[string]string
+}
+
+var severityNames = map[Severity]string{
+	SeverityDebug:  "DEBUG",
+	SeverityInfo:   "INFO",
+	SeverityNotice: "NOTICE",
+	SeverityWarn:   "WARNING",
+	SeverityError:  "ERROR",
+	SeverityFatal:  "CRITICAL",
+}
+
+func (j jsonEncoder) Encode(e Entry) string {
+	var b bytes.Buffer
+	b.WriteString(`{"severity":`)
+	b.WriteString(jsonString(severityNames[e.Severity]))
+	b.WriteString(`,"time":`)
+	b.WriteString(jsonString(e.Time.UTC().Format(time.RFC3339Nano)))
+	var reported *errorInfo
+	if j.errorReporting != nil {
+		reported = reportedError(e)
+	}
+	b.WriteString(`,"message":`)
+	if reported != nil {
+		b.WriteString(jsonString(e.Message + ": " + reported.message))
+		j.writeReportedErrorEvent(&b, e, reported)
+	} else {
+		b.WriteString(jsonString(e.Message))
+	}
+	b.WriteString(`,"logging.googleapis.com/sourceLocation":{"file":`)
+	b.WriteString(jsonString(e.File))
+	b.WriteString(`,"line":`)
+	b.WriteString(jsonString(strconv.Itoa(e.Line)))
+	b.WriteString(`,"function":`)
+	b.WriteString(jsonString(e.Function))
+	b.WriteString("}")
+	if e.TraceId != "" {
+		b.WriteString(`,"logging.googleapis.com/trace":`)
+		if j.gcpProjectId != "" {
+			b.WriteString(jsonString(fmt.Sprintf("projects/%s/traces/%s", j.gcpProjectId, e.TraceId)))
+		} else {
+			b.WriteString(jsonString(e.TraceId))
+		}
+	}
+	b.WriteString(`,"logging.googleapis.com/labels":`)
+	b.WriteString(j.encodeLabels(e.CorrelationId, e.Logger, e.Labels))
+	b.WriteString(`,"jsonPayload":`)
+	writePayload(&b, e.Fields)
+	b.WriteString("}")
+	return b.String()
+}
+
+func (j jsonEncoder) encodeLabels(correlationId, logger string, entryLabels map[string]string) string {
+	labels := make(map[string]string, len(j.labels)+len(entryLabels)+2)
+	for k, v := range j.labels {
+		labels[k] = v
+	}
+	for k, v := range entryLabels {
+		labels[k] = v
+	}
+	labels["correlationId"] = correlationId
+	if logger != "" {
+		labels["logger"] = logger
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// writePayload of fields as a JSON object
+func writePayload(b *bytes.Buffer, fields []Field) {
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeFieldJSON(b, f)
+	}
+	b.WriteByte('}')
+}
+
+// writeFieldJSON as a JSON object member
+func writeFieldJSON(b *bytes.Buffer, f Field) {
+	b.WriteString(jsonString(f.key))
+	b.WriteByte(':')
+	writeValueJSON(b, f)
+}
+
+// writeValueJSON of the field
+func writeValueJSON(b *bytes.Buffer, f Field) {
+	switch f.kind {
+	case kindAny:
+		b.WriteString(fmtAnyJSON(f.iface))
+	case kindAnys:
+		values := f.iface.([]interface{})
+		writeSliceJSON(b, len(values), func(i int) string {
+			return fmtAnyJSON(values[i])
+		})
+	case kindBool:
+		b.WriteString(strconv.FormatBool(f.integer == 1))
+	case kindBools:
+		values := f.iface.([]bool)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return strconv.FormatBool(values[i])
+		})
+	case kindByte:
+		b.WriteString(jsonString(string(rune(f.integer))))
+	case kindBytes:
+		b.WriteString(jsonString(string(f.iface.([]byte))))
+	case kindDuration:
+		b.WriteString(jsonString(time.Duration(f.integer).String()))
+	case kindDurations:
+		values := f.iface.([]time.Duration)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return jsonString(values[i].String())
+		})
+	case kindError:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		writeErrorJSON(b, newErrorInfo(f.iface.(error)))
+	case kindFloat32:
+		b.WriteString(jsonFloat(f.float, 5))
+	case kindFloat32s:
+		values := f.iface.([]float32)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return jsonFloat(float64(values[i]), 5)
+		})
+	case kindFloat64:
+		b.WriteString(jsonFloat(f.float, 10))
+	case kindFloat64s:
+		values := f.iface.([]float64)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return jsonFloat(values[i], 10)
+		})
+	case kindGroup:
+		writePayload(b, f.iface.([]Field))
+	case kindInt, kindInt32, kindInt64:
+		b.WriteString(strconv.FormatInt(f.integer, 10))
+	case kindInts:
+		values := f.iface.([]int)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return strconv.Itoa(values[i])
+		})
+	case kindInt32s:
+		values := f.iface.([]int32)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return strconv.FormatInt(int64(values[i]), 10)
+		})
+	case kindInt64s:
+		values := f.iface.([]int64)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return strconv.FormatInt(values[i], 10)
+		})
+	case kindMap:
+		writeMapJSON(b, f.iface.(map[string]interface{}))
+	case kindObject:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		writePayload(b, f.iface.(LogMarshaler).MarshalLog())
+	case kindRawJSON:
+		writeRawJSON(b, f.iface.(json.RawMessage))
+	case kindSecret:
+		b.WriteString(jsonString(Redacted))
+	case kindString:
+		b.WriteString(jsonString(f.str))
+	case kindStringer:
+		if f.iface == nil {
+			b.WriteString("null")
+			return
+		}
+		b.WriteString(jsonString(f.iface.(fmt.Stringer).String()))
+	case kindStrings:
+		values := f.iface.([]string)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return jsonString(values[i])
+		})
+	case kindTime:
+		b.WriteString(jsonString(f.iface.(time.Time).Format(time.RFC3339Nano)))
+	case kindTimes:
+		values := f.iface.([]time.Time)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return jsonString(values[i].Format(time.RFC3339Nano))
+		})
+	case kindUint, kindUint32, kindUint64:
+		b.WriteString(strconv.FormatUint(uint64(f.integer), 10))
+	case kindUints:
+		values := f.iface.([]uint)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return strconv.FormatUint(uint64(values[i]), 10)
+		})
+	case kindUint32s:
+		values := f.iface.([]uint32)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return strconv.FormatUint(uint64(values[i]), 10)
+		})
+	case kindUint64s:
+		values := f.iface.([]uint64)
+		writeSliceJSON(b, len(values), func(i int) string {
+			return strconv.FormatUint(values[i], 10)
+		})
+	}
+}
+
+// writeMapJSON as an object with keys sorted and values marshalled as JSON
+func writeMapJSON(b *bytes.Buffer, values map[string]interface{}) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(jsonString(k))
+		b.WriteByte(':')
+		blob, err := json.Marshal(logValue(values[k]))
+		if err != nil {
+			blob = []byte(`"NOT JSON MARSHALLABLE"`)
+		}
+		b.Write(blob)
+	}
+	b.WriteByte('}')
+}
+
+// writeRawJSON compacted, or as a string if it is not valid JSON
+func writeRawJSON(b *bytes.Buffer, value json.RawMessage) {
+	if len(value) == 0 {
+		b.WriteString("null")
+		return
+	}
+	if err := json.Compact(b, value); err != nil {
+		b.WriteString(jsonString(string(value)))
+	}
+}
+
+func writeSliceJSON(b *bytes.Buffer, n int, value func(i int) string) {
+	b.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(value(i))
+	}
+	b.WriteByte(']')
+}
+
+func fmtAnyJSON(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	if v, ok := value.(redactedAny); ok {
+		if blob, ok := v.value.(json.RawMessage); ok { // Marshalled by the redactor
+			return fmt.Sprintf(`{"type":%s,"value":%s}`, jsonString(v.typ), blob)
+		}
+	}
+	typ, value := anyType(value)
+	blob, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf(`{"type":%s,"value":"NOT JSON MARSHALLABLE"}`, jsonString(typ))
+	}
+	return fmt.Sprintf(`{"type":%s,"value":%s}`, jsonString(typ), blob)
+}
+
+// anyType name of the value, and the value to marshal, which differs if it has been redacted or has log tags
+func anyType(value interface{}) (string, interface{}) {
+	if v, ok := value.(redactedAny); ok {
+		return v.typ, v.value
+	}
+	return reflect.TypeOf(value).String(), logValue(value)
+}
+
+// jsonFloat with fixed precision, or as a string if the value is NaN or infinite as JSON has no representation for them
+func jsonFloat(f float64, precision int) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return jsonString(strconv.FormatFloat(f, 'f', precision, 64))
+	}
+	return strconv.FormatFloat(f, 'f', precision, 64)
+}
+
+func jsonString(s string) string {
+	if !needsEscape(s) {
+		return `"` + s + `"`
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return `""`
+	}
+	return string(b)
+}
+
+// needsEscape if the string has characters which the JSON marshaller would escape or replace
+func needsEscape(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			return true
+		}
+	}
+	return false
+}
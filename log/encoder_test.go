@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"testing"
+	"time"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func Test_jsonEncoder(t *testing.T) {
+	at := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	type input struct {
+		encoder jsonEncoder
+		entry   func() Entry
+	}
+	var data = []struct {
+		desc     string
+		input    input
+		expected string
+	}{
+		{
+			desc: "notice with fields and trace",
+			input: input{
+				encoder: jsonEncoder{
+					gcpProjectId: "project",
+					labels: map[string]string{
+						"app": "app",
+					},
+				},
+				entry: func() Entry {
+					return Entry{
+						Time:          at,
+						Severity:      SeverityNotice,
+						Message:       "message",
+						CorrelationId: "correlationId",
+						TraceId:       "traceId",
+						File:          "file.go",
+						Line:          1,
+						Function:      "funcName",
+						Fields: []Field{
+							FmtString("value", "name"),
+							FmtInt(2, "count"),
+						},
+					}
+				},
+			},
+			expected: `{"severity":"NOTICE","time":"2021-09-01T12:00:00Z","message":"message","logging.googleapis.com/sourceLocation":{"file":"file.go","line":"1","function":"funcName"},"logging.googleapis.com/trace":"projects/project/traces/traceId","logging.googleapis.com/labels":{"app":"app","correlationId":"correlationId"},"jsonPayload":{"name":"value","count":2}}`,
+		},
+
+		{
+			desc: "fatal without fields or trace",
+			input: input{
+				encoder: jsonEncoder{},
+				entry: func() Entry {
+					return Entry{
+						Time:          at,
+						Severity:      SeverityFatal,
+						Message:       "multi\nline",
+						CorrelationId: "correlationId",
+						File:          "file.go",
+						Line:          1,
+						Function:      "funcName",
+					}
+				},
+			},
+			expected: `{"severity":"CRITICAL","time":"2021-09-01T12:00:00Z","message":"multi\nline","logging.googleapis.com/sourceLocation":{"file":"file.go","line":"1","function":"funcName"},"logging.googleapis.com/labels":{"correlationId":"correlationId"},"jsonPayload":{}}`,
+		},
+
+		{
+			desc: "byte field",
+			input: input{
+				encoder: jsonEncoder{},
+				entry: func() Entry {
+					return Entry{
+						Time:          at,
+						Severity:      SeverityWarn,
+						Message:       "message",
+						CorrelationId: "correlationId",
+						File:          "file.go",
+						Line:          1,
+						Function:      "funcName",
+						Fields: []Field{
+							FmtByte('A', "name"),
+						},
+					}
+				},
+			},
+			expected: `{"severity":"WARNING","time":"2021-09-01T12:00:00Z","message":"message","logging.googleapis.com/sourceLocation":{"file":"file.go","line":"1","function":"funcName"},"logging.googleapis.com/labels":{"correlationId":"correlationId"},"jsonPayload":{"name":"A"}}`,
+		},
+	}
+
+	for i, d := range data {
+		result := d.input.encoder.Encode(d.input.entry())
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
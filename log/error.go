@@ -0,0 +1,234 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	go_errors "github.com/caigwatkin/go/errors"
+	pkg_errors "github.com/pkg/errors"
+)
+
+// ErrorReporting shapes error entries encoded as JSON for Cloud Error Reporting
+//
+// Entries of at least error severity with an error field are encoded as ReportedErrorEvents, so that they are
+// picked up from logs, see https://cloud.google.com/error-reporting/docs/formatting-error-messages
+type ErrorReporting struct {
+	Service string // Defaults to the name of the entry's logger, see Client.Named, omitted if neither is set
+	Version string
+}
+
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// errorInfo of an error field, from which it is encoded
+type errorInfo struct {
+	message string
+	typ     string
+	code    int // Of the first status in the chain, 0 if none
+	items   []go_errors.Item
+	causes  []errorCause
+	stack   []stackFrame // Of the deepest error in the chain with a stack trace
+	trace   string       // Formatted with %+v, for the console
+}
+
+type errorCause struct {
+	message string
+	typ     string
+}
+
+type stackFrame struct {
+	function string
+	file     string
+	line     int
+}
+
+// newErrorInfo from the error and its chain of causes
+//
+// Wrappers of github.com/pkg/errors which only add a message or stack trace are not listed as causes
+func newErrorInfo(err error) *errorInfo {
+	if info, ok := err.(*errorInfo); ok {
+		return info
+	}
+	info := &errorInfo{
+		message: fmt.Sprintf("%s", err),
+		trace:   fmt.Sprintf("%+v", err),
+	}
+	var links []errorCause
+	for e := err; e != nil; e = cause(e) {
+		if isNilPointer(e) {
+			// Methods of a nil pointer may panic, which fmt recovers from, so the chain ends at it
+			links = append(links, newErrorCause(e))
+			break
+		}
+		if s, ok := e.(go_errors.Status); ok && info.code == 0 {
+			info.code = s.Code
+			info.items = s.Items
+		}
+		if st, ok := e.(interface{ StackTrace() pkg_errors.StackTrace }); ok {
+			info.stack = stackFrames(st.StackTrace())
+		}
+		if isPkgErrorsWrapper(e) {
+			continue
+		}
+		links = append(links, newErrorCause(e))
+	}
+	if len(links) > 0 {
+		info.typ = links[0].typ
+		info.causes = links[1:]
+	} else {
+		info.typ = reflect.TypeOf(err).String()
+	}
+	return info
+}
+
+func newErrorCause(err error) errorCause {
+	return errorCause{
+		message: fmt.Sprintf("%s", err),
+		typ:     reflect.TypeOf(err).String(),
+	}
+}
+
+// Error so that redacted error info can replace the error of a field
+func (info *errorInfo) Error() string {
+	return info.message
+}
+
+// isNilPointer error, e.g. a nil *T returned as an error
+func isNilPointer(err error) bool {
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func cause(err error) error {
+	switch v := err.(type) {
+	case go_errors.Status:
+		return v.Cause
+	case interface{ Cause() error }:
+		return v.Cause()
+	default:
+		return errors.Unwrap(err)
+	}
+}
+
+func isPkgErrorsWrapper(err error) bool {
+	t := reflect.TypeOf(err)
+	if t.Kind() != reflect.Ptr || t.Elem().PkgPath() != "github.com/pkg/errors" {
+		return false
+	}
+	name := t.Elem().Name()
+	return name == "withStack" || name == "withMessage"
+}
+
+// stackFrames of the stack trace, without those of the errors package which wraps github.com/pkg/errors
+func stackFrames(st pkg_errors.StackTrace) []stackFrame {
+	frames := make([]stackFrame, 0, len(st))
+	for _, v := range st {
+		pc := uintptr(v) - 1
+		fn := runtime.FuncForPC(pc)
+		if fn == nil || (len(frames) == 0 && strings.HasPrefix(fn.Name(), "github.com/caigwatkin/go/errors.")) {
+			continue
+		}
+		file, line := fn.FileLine(pc)
+		frames = append(frames, stackFrame{
+			function: fn.Name(),
+			file:     file,
+			line:     line,
+		})
+	}
+	return frames
+}
+
+// writeErrorJSON as an object of its message, type, status code and items, causes and stack
+func writeErrorJSON(b *bytes.Buffer, info *errorInfo) {
+	b.WriteString(`{"message":`)
+	b.WriteString(jsonString(info.message))
+	b.WriteString(`,"type":`)
+	b.WriteString(jsonString(info.typ))
+	if info.code != 0 {
+		b.WriteString(`,"code":`)
+		b.WriteString(strconv.Itoa(info.code))
+	}
+	if len(info.items) > 0 {
+		b.WriteString(`,"items":`)
+		writeSliceJSON(b, len(info.items), func(i int) string {
+			return fmt.Sprintf(`{"field":%s,"message":%s}`, jsonString(info.items[i].Field), jsonString(info.items[i].Message))
+		})
+	}
+	if len(info.causes) > 0 {
+		b.WriteString(`,"causes":`)
+		writeSliceJSON(b, len(info.causes), func(i int) string {
+			return fmt.Sprintf(`{"message":%s,"type":%s}`, jsonString(info.causes[i].message), jsonString(info.causes[i].typ))
+		})
+	}
+	if len(info.stack) > 0 {
+		b.WriteString(`,"stack":`)
+		writeSliceJSON(b, len(info.stack), func(i int) string {
+			f := info.stack[i]
+			return fmt.Sprintf(`{"function":%s,"file":%s,"line":%d}`, jsonString(f.function), jsonString(f.file), f.line)
+		})
+	}
+	b.WriteByte('}')
+}
+
+// reportedError of the first error field of the entry, nil if it has none or is below error severity
+func reportedError(e Entry) *errorInfo {
+	if e.Severity < SeverityError {
+		return nil
+	}
+	for _, v := range e.Fields {
+		if v.kind == kindError && v.iface != nil {
+			return newErrorInfo(v.iface.(error))
+		}
+	}
+	return nil
+}
+
+// writeReportedErrorEvent members of the entry
+//
+// The report location is the top of the error's stack, or the source location of the entry if it has none
+func (j jsonEncoder) writeReportedErrorEvent(b *bytes.Buffer, e Entry, info *errorInfo) {
+	location := stackFrame{
+		function: e.Function,
+		file:     e.File,
+		line:     e.Line,
+	}
+	if len(info.stack) > 0 {
+		location = info.stack[0]
+	}
+	b.WriteString(`,"@type":`)
+	b.WriteString(jsonString(reportedErrorEventType))
+	service := j.errorReporting.Service
+	if service == "" {
+		service = e.Logger
+	}
+	if service != "" {
+		b.WriteString(`,"serviceContext":{"service":`)
+		b.WriteString(jsonString(service))
+		if j.errorReporting.Version != "" {
+			b.WriteString(`,"version":`)
+			b.WriteString(jsonString(j.errorReporting.Version))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(b, `,"context":{"reportLocation":{"filePath":%s,"lineNumber":%d,"functionName":%s}}`, jsonString(location.file), location.line, jsonString(location.function))
+}
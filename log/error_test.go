@@ -0,0 +1,290 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestWriteErrorJSON(t *testing.T) {
+	type expected struct {
+		Message string
+		Type    string
+		Code    int
+		Items   []go_errors.Item
+		Causes  []map[string]string
+		Stack   bool
+	}
+	var data = []struct {
+		desc     string
+		input    error
+		expected expected
+	}{
+		{
+			desc:  "wrapped",
+			input: go_errors.Wrap(fmt.Errorf("query: %w", go_errors.New("connection refused")), "Failed reading"),
+			expected: expected{
+				Message: "Failed reading: query: connection refused",
+				Type:    "*fmt.wrapError",
+				Causes: []map[string]string{
+					{
+						"message": "connection refused",
+						"type":    "*errors.fundamental",
+					},
+				},
+				Stack: true,
+			},
+		},
+
+		{
+			desc:  "status with cause and items",
+			input: go_errors.NewStatusWithCause(go_errors.New("invalid \"name\"\nvalue"), http.StatusBadRequest, "Invalid body"),
+			expected: expected{
+				Message: "",
+				Type:    "errors.Status",
+				Code:    http.StatusBadRequest,
+				Causes: []map[string]string{
+					{
+						"message": "invalid \"name\"\nvalue",
+						"type":    "*errors.fundamental",
+					},
+				},
+				Stack: true,
+			},
+		},
+
+		{
+			desc:  "status with items",
+			input: go_errors.NewStatusWithItems(http.StatusBadRequest, "Invalid body", []go_errors.Item{{Field: "name", Message: "Required"}}),
+			expected: expected{
+				Type:  "errors.Status",
+				Code:  http.StatusBadRequest,
+				Items: []go_errors.Item{{Field: "name", Message: "Required"}},
+			},
+		},
+	}
+
+	for i, d := range data {
+		blob := strings.TrimPrefix(encodeFieldJSON(FmtError(d.input)), `"error":`)
+		var result struct {
+			Message string
+			Type    string
+			Code    int
+			Items   []go_errors.Item
+			Causes  []map[string]string
+			Stack   []map[string]interface{}
+		}
+		if err := json.Unmarshal([]byte(blob), &result); err != nil {
+			t.Fatal(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   "valid JSON",
+				Result:     blob,
+			}))
+		}
+		if d.expected.Message == "" {
+			d.expected.Message = d.input.Error()
+		}
+
+		if result.Message != d.expected.Message || result.Type != d.expected.Type || result.Code != d.expected.Code ||
+			fmt.Sprint(result.Items) != fmt.Sprint(d.expected.Items) || fmt.Sprint(result.Causes) != fmt.Sprint(d.expected.Causes) ||
+			(len(result.Stack) > 0) != d.expected.Stack {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input.Error(),
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestErrorReportingJSONEncoder(t *testing.T) {
+	err := go_errors.New("connection refused")
+	var data = []struct {
+		desc     string
+		input    Entry
+		expected string
+	}{
+		{
+			desc: "error",
+			input: Entry{
+				Severity: SeverityError,
+				Message:  "Failed reading",
+				Fields: []Field{
+					FmtError(err),
+				},
+			},
+			expected: `"message":"Failed reading: connection refused","@type":"type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent","serviceContext":{"service":"api","version":"1.0.0"},"context":{"reportLocation":{"filePath":`,
+		},
+
+		{
+			desc: "warn",
+			input: Entry{
+				Severity: SeverityWarn,
+				Message:  "Failed reading",
+				Fields: []Field{
+					FmtError(err),
+				},
+			},
+			expected: `"message":"Failed reading","logging.googleapis.com/sourceLocation"`,
+		},
+
+		{
+			desc: "error without error field",
+			input: Entry{
+				Severity: SeverityError,
+				Message:  "Failed reading",
+			},
+			expected: `"message":"Failed reading","logging.googleapis.com/sourceLocation"`,
+		},
+
+		{
+			desc: "error of named logger",
+			input: Entry{
+				Severity: SeverityError,
+				Message:  "Failed reading",
+				Logger:   "http",
+				Fields: []Field{
+					FmtError(err),
+				},
+			},
+			expected: `"serviceContext":{"service":"api","version":"1.0.0"}`,
+		},
+	}
+
+	encoder := NewErrorReportingJSONEncoder("", nil, ErrorReporting{
+		Service: "api",
+		Version: "1.0.0",
+	})
+	for i, d := range data {
+		d.input.Time = time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+		result := encoder.Encode(d.input)
+
+		if !strings.Contains(result, d.expected) || !json.Valid([]byte(result)) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestErrorReportingServiceDefault(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "named",
+			input:    "http",
+			expected: `"serviceContext":{"service":"http","version":"1.0.0"}`,
+		},
+
+		{
+			desc:     "unnamed",
+			expected: "",
+		},
+	}
+
+	encoder := NewErrorReportingJSONEncoder("", nil, ErrorReporting{
+		Version: "1.0.0",
+	})
+	for i, d := range data {
+		result := encoder.Encode(Entry{
+			Severity: SeverityError,
+			Message:  "Failed reading",
+			Logger:   d.input,
+			Fields: []Field{
+				FmtError(go_errors.New("connection refused")),
+			},
+		})
+
+		if d.expected != "" && !strings.Contains(result, d.expected) || d.expected == "" && strings.Contains(result, "serviceContext") {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestClientErrorTypedNil(t *testing.T) {
+	var data = []struct {
+		desc  string
+		input Encoder
+	}{
+		{
+			desc:  "json",
+			input: NewJSONEncoder("", nil),
+		},
+
+		{
+			desc:  "console",
+			input: NewConsoleEncoderFor(nil, ConsoleConfig{Verbose: true, Color: ColorNever}),
+		},
+
+		{
+			desc:  "compact",
+			input: NewConsoleEncoderFor(nil, ConsoleConfig{Color: ColorNever}),
+		},
+	}
+
+	for i, d := range data {
+		var buf bytes.Buffer
+		logClient := NewClient(context.Background(), Config{
+			Sinks: []Sink{
+				NewWriterSink(&buf, SeverityInfo, d.input),
+			},
+		})
+		buf.Reset()
+		var err error = (*valueError)(nil)
+		logClient.Error(context.Background(), "Failed", FmtError(err))
+
+		if !strings.Contains(buf.String(), "<nil>") && !strings.Contains(buf.String(), `\u003cnil\u003e`) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "buf.String()",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   "error logged as <nil>",
+				Result:     buf.String(),
+			}))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"fmt"
+	"os"
+)
+
+// Hook of entries before they are encoded, see Config.Hooks
+//
+// Hooks are run in order on each entry output, before it is redacted, and may change it, drop it, or fork it, e.g. by
+// writing a copy to another sink. Fields added by hooks are redacted. The entry's fields and labels may be shared with
+// other entries, so hooks replace them rather than changing them in place
+type Hook interface {
+	// Hook the entry, returning false to drop it, in which case later hooks are not run and it is not written
+	Hook(e *Entry) bool
+}
+
+// HookFunc adapts a func to a hook
+type HookFunc func(e *Entry) bool
+
+func (f HookFunc) Hook(e *Entry) bool {
+	return f(e)
+}
+
+// runHook on a copy of the entry, isolating the caller from a panic, after which the entry is kept unchanged
+func runHook(h Hook, e Entry) (result Entry, keep bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintln(os.Stderr, "Log hook panicked", r)
+			result, keep = e, true
+		}
+	}()
+	result = e
+	return result, h.Hook(&result)
+}
+
+// NewLabelsHook adding the labels to entries, e.g. the pod name, without replacing labels they have
+func NewLabelsHook(labels map[string]string) Hook {
+	return HookFunc(func(e *Entry) bool {
+		merged := make(map[string]string, len(labels)+len(e.Labels))
+		for k, v := range labels {
+			merged[k] = v
+		}
+		for k, v := range e.Labels {
+			merged[k] = v
+		}
+		e.Labels = merged
+		return true
+	})
+}
+
+// NewForwardHook writing entries of at least the severity to the sink as well, e.g. errors to an alerting channel
+//
+// Entries are written synchronously, so the writers of slow sinks should be wrapped with NewAsyncWriter
+func NewForwardHook(min Severity, sink Sink) Hook {
+	return HookFunc(func(e *Entry) bool {
+		if e.Severity >= min && sink.Enabled(e.Severity) {
+			if err := sink.Write(e.redacted()); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed forwarding log entry", err)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestHooks(t *testing.T) {
+	appendField := func(name string) Hook {
+		return HookFunc(func(e *Entry) bool {
+			e.Fields = append(e.Fields[:len(e.Fields):len(e.Fields)], FmtBool(true, name))
+			return true
+		})
+	}
+	var data = []struct {
+		desc     string
+		input    []Hook
+		expected string
+	}{
+		{
+			desc:     "in order",
+			input:    []Hook{appendField("first"), appendField("second")},
+			expected: `"jsonPayload":{"name":"value","first":true,"second":true}}`,
+		},
+
+		{
+			desc: "added fields are redacted",
+			input: []Hook{
+				HookFunc(func(e *Entry) bool {
+					e.Fields = append(e.Fields[:len(e.Fields):len(e.Fields)], FmtString("plaintext", "password"))
+					return true
+				}),
+			},
+			expected: `"jsonPayload":{"name":"value","password":"[REDACTED]"}}`,
+		},
+
+		{
+			desc: "dropped",
+			input: []Hook{
+				HookFunc(func(e *Entry) bool {
+					return !strings.HasPrefix(e.Message, "Health")
+				}),
+				HookFunc(func(e *Entry) bool {
+					panic("not run for dropped entries")
+				}),
+			},
+			expected: "",
+		},
+
+		{
+			desc: "panicking is isolated",
+			input: []Hook{
+				HookFunc(func(e *Entry) bool {
+					e.Message = "changed"
+					panic("panicking")
+				}),
+				appendField("after"),
+			},
+			expected: `"message":"Health check",`,
+		},
+
+		{
+			desc: "labels",
+			input: []Hook{
+				HookFunc(func(e *Entry) bool {
+					e.Labels = map[string]string{
+						"pod": "entry",
+					}
+					return true
+				}),
+				NewLabelsHook(map[string]string{
+					"pod":     "pod",
+					"version": "1",
+				}),
+			},
+			expected: `"logging.googleapis.com/labels":{"correlationId":"","pod":"entry","version":"1"}`,
+		},
+	}
+
+	for i, d := range data {
+		var buf bytes.Buffer
+		logClient := NewClient(context.Background(), Config{
+			Sinks: []Sink{
+				NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+			},
+			Hooks: d.input,
+		})
+		buf.Reset()
+		logClient.Info(context.Background(), "Health check", FmtString("value", "name"))
+		result := buf.String()
+
+		if (d.expected == "" && result != "") || !strings.Contains(result, d.expected) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestNewForwardHook(t *testing.T) {
+	var buf, forwarded bytes.Buffer
+	logClient := NewClient(context.Background(), Config{
+		Sinks: []Sink{
+			NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+		},
+		Hooks: []Hook{
+			NewForwardHook(SeverityError, NewWriterSink(&forwarded, SeverityDebug, NewJSONEncoder("", nil))),
+		},
+	})
+	buf.Reset()
+	logClient.Info(context.Background(), "Info")
+	logClient.Error(context.Background(), "Error", FmtString("plaintext", "password"))
+	result := []int{strings.Count(buf.String(), "\n"), strings.Count(forwarded.String(), "\n")}
+
+	if result[0] != 2 || result[1] != 1 || !strings.Contains(forwarded.String(), `"message":"Error"`) || strings.Contains(forwarded.String(), "plaintext") {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result",
+			Expected:   "both entries written, only the error forwarded, redacted",
+			Result:     []string{buf.String(), forwarded.String()},
+		}))
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// Level is the minimum severity logged, which is safe to change at runtime
+//
+// Overrides are keyed by a prefix of the caller's function name, e.g. "github.com/caigwatkin/go/database" or
+// "github.com/caigwatkin/go/database.(*client).logQuery", with the longest matching prefix taking precedence
+type Level struct {
+	mu    sync.Mutex // Serialises writes, reads are lock free
+	now   func() time.Time
+	state atomic.Value // levelState
+}
+
+type levelState struct {
+	min            Severity
+	overrides      []levelOverride // Longest prefix first
+	debugUntil     time.Time
+	debugForbidden bool
+}
+
+type levelOverride struct {
+	prefix string
+	min    Severity
+}
+
+// NewLevel with the minimum severity
+func NewLevel(min Severity) *Level {
+	l := &Level{
+		now: time.Now,
+	}
+	l.state.Store(levelState{
+		min: min,
+	})
+	return l
+}
+
+// Min severity logged, without overrides or timed debug
+func (l *Level) Min() Severity {
+	return l.load().min
+}
+
+// SetMin severity logged
+func (l *Level) SetMin(min Severity) {
+	l.update(func(s *levelState) {
+		s.min = min
+	})
+}
+
+// Overrides of the min severity keyed by caller function name prefix
+func (l *Level) Overrides() map[string]Severity {
+	overrides := make(map[string]Severity)
+	for _, v := range l.load().overrides {
+		overrides[v.prefix] = v.min
+	}
+	return overrides
+}
+
+// SetOverride of the min severity for callers with function names starting with the prefix
+func (l *Level) SetOverride(prefix string, min Severity) {
+	l.update(func(s *levelState) {
+		s.setOverride(prefix, min)
+	})
+}
+
+// RemoveOverride for the prefix
+func (l *Level) RemoveOverride(prefix string) {
+	l.update(func(s *levelState) {
+		s.overrides = withoutOverride(s.overrides, prefix)
+	})
+}
+
+// SetOverrides replacing all existing overrides
+func (l *Level) SetOverrides(overrides map[string]Severity) {
+	l.update(func(s *levelState) {
+		s.overrides = nil
+		for k, v := range overrides {
+			s.setOverride(k, v)
+		}
+	})
+}
+
+// DebugFor logs everything for the duration, after which the min severity and overrides apply again
+//
+// A duration of 0 ends timed debug
+func (l *Level) DebugFor(d time.Duration) {
+	l.update(func(s *levelState) {
+		s.debugUntil = time.Time{}
+		if d > 0 {
+			s.debugUntil = l.now().Add(d)
+		}
+	})
+}
+
+// DebugUntil is when timed debug ends, zero if it is not active
+func (l *Level) DebugUntil() time.Time {
+	until := l.load().debugUntil
+	if !l.now().Before(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+// ForbidDebug so that neither the min severity, overrides nor timed debug enable debug, e.g. in prod
+//
+// Debug severities, already set or set later, are raised to info, and timed debug is ended
+func (l *Level) ForbidDebug() {
+	l.update(func(s *levelState) {
+		s.debugForbidden = true
+	})
+}
+
+// DebugForbidden if debug may not be enabled, see ForbidDebug
+func (l *Level) DebugForbidden() bool {
+	return l.load().debugForbidden
+}
+
+// Enabled if the severity is logged for the caller function name
+func (l *Level) Enabled(severity Severity, funcName string) bool {
+	s := l.load()
+	if !s.debugUntil.IsZero() && l.now().Before(s.debugUntil) {
+		return true
+	}
+	for _, v := range s.overrides {
+		if strings.HasPrefix(funcName, v.prefix) {
+			return severity >= v.min
+		}
+	}
+	return severity >= s.min
+}
+
+// overridden if any overrides are set, so the caller function name is needed to check if severities are enabled
+func (l *Level) overridden() bool {
+	return len(l.load().overrides) > 0
+}
+
+func (l *Level) load() levelState {
+	return l.state.Load().(levelState)
+}
+
+func (l *Level) update(f func(s *levelState)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.load()
+	s.overrides = append([]levelOverride(nil), s.overrides...)
+	f(&s)
+	if s.debugForbidden {
+		s.raiseDebug()
+	}
+	l.state.Store(s)
+}
+
+func (s *levelState) raiseDebug() {
+	if s.min < SeverityInfo {
+		s.min = SeverityInfo
+	}
+	for i, v := range s.overrides {
+		if v.min < SeverityInfo {
+			s.overrides[i].min = SeverityInfo
+		}
+	}
+	s.debugUntil = time.Time{}
+}
+
+func (s *levelState) setOverride(prefix string, min Severity) {
+	s.overrides = withoutOverride(s.overrides, prefix)
+	s.overrides = append(s.overrides, levelOverride{
+		prefix: prefix,
+		min:    min,
+	})
+	sort.SliceStable(s.overrides, func(i, j int) bool {
+		return len(s.overrides[i].prefix) > len(s.overrides[j].prefix)
+	})
+}
+
+func withoutOverride(overrides []levelOverride, prefix string) []levelOverride {
+	var result []levelOverride
+	for _, v := range overrides {
+		if v.prefix != prefix {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// ParseSeverity from its name, case insensitive
+func ParseSeverity(s string) (Severity, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	for k, v := range severityStrings {
+		if v == name {
+			return k, nil
+		}
+	}
+	return 0, go_errors.Errorf("Invalid severity %q, must be one of DEBUG, INFO, NOTICE, WARN, ERROR, or FATAL", s)
+}
+
+// MarshalText as the severity name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText from the severity name
+func (s *Severity) UnmarshalText(text []byte) error {
+	v, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	go_environment "github.com/caigwatkin/go/environment"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestLevelEnabled(t *testing.T) {
+	type input struct {
+		Severity Severity
+		FuncName string
+	}
+	var data = []struct {
+		desc     string
+		input    input
+		expected bool
+	}{
+		{
+			desc: "below min",
+			input: input{
+				Severity: SeverityDebug,
+				FuncName: "github.com/caigwatkin/go/http.handler",
+			},
+			expected: false,
+		},
+
+		{
+			desc: "at min",
+			input: input{
+				Severity: SeverityInfo,
+				FuncName: "github.com/caigwatkin/go/http.handler",
+			},
+			expected: true,
+		},
+
+		{
+			desc: "package override lowers min",
+			input: input{
+				Severity: SeverityDebug,
+				FuncName: "github.com/caigwatkin/go/database.(*client).logQuery",
+			},
+			expected: true,
+		},
+
+		{
+			desc: "function override takes precedence over package override",
+			input: input{
+				Severity: SeverityWarn,
+				FuncName: "github.com/caigwatkin/go/database.(*client).noisy",
+			},
+			expected: false,
+		},
+
+		{
+			desc: "function override allows at its min",
+			input: input{
+				Severity: SeverityError,
+				FuncName: "github.com/caigwatkin/go/database.(*client).noisy",
+			},
+			expected: true,
+		},
+	}
+
+	level := NewLevel(SeverityInfo)
+	level.SetOverride("github.com/caigwatkin/go/database", SeverityDebug)
+	level.SetOverride("github.com/caigwatkin/go/database.(*client).noisy", SeverityError)
+
+	for i, d := range data {
+		result := level.Enabled(d.input.Severity, d.input.FuncName)
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestLevelDebugFor(t *testing.T) {
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	level := NewLevel(SeverityWarn)
+	level.now = func() time.Time {
+		return now
+	}
+	level.SetOverride("github.com/caigwatkin/go/database", SeverityError)
+	level.DebugFor(10 * time.Minute)
+
+	var data = []struct {
+		desc     string
+		input    time.Duration
+		expected bool
+	}{
+		{
+			desc:     "during",
+			input:    0,
+			expected: true,
+		},
+
+		{
+			desc:     "before end",
+			input:    10*time.Minute - time.Nanosecond,
+			expected: true,
+		},
+
+		{
+			desc:     "reverted",
+			input:    10 * time.Minute,
+			expected: false,
+		},
+	}
+
+	start := now
+	for i, d := range data {
+		now = start.Add(d.input)
+		result := level.Enabled(SeverityDebug, "github.com/caigwatkin/go/database.Open")
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+		if (level.DebugUntil().IsZero()) == d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "level.DebugUntil()",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     level.DebugUntil(),
+			}))
+		}
+	}
+	if level.Min() != SeverityWarn || level.Overrides()["github.com/caigwatkin/go/database"] != SeverityError {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "level",
+			Expected:   "min and overrides unchanged after timed debug",
+			Result:     level.Overrides(),
+		}))
+	}
+}
+
+func TestLevelForbidDebug(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    func(level *Level)
+		expected bool
+	}{
+		{
+			desc: "min",
+			input: func(level *Level) {
+				level.SetMin(SeverityDebug)
+			},
+		},
+
+		{
+			desc: "override",
+			input: func(level *Level) {
+				level.SetOverride("github.com/caigwatkin/go/database", SeverityDebug)
+			},
+		},
+
+		{
+			desc: "debug for",
+			input: func(level *Level) {
+				level.DebugFor(10 * time.Minute)
+			},
+		},
+	}
+
+	for i, d := range data {
+		for _, forbidFirst := range []bool{true, false} {
+			level := NewLevel(SeverityInfo)
+			if forbidFirst {
+				level.ForbidDebug()
+			}
+			d.input(level)
+			if !forbidFirst {
+				level.ForbidDebug()
+			}
+			result := level.Enabled(SeverityDebug, "github.com/caigwatkin/go/database.Open")
+
+			if result != d.expected || !level.Enabled(SeverityInfo, "github.com/caigwatkin/go/database.Open") {
+				t.Error(go_testing.Errorf(go_testing.Error{
+					Unexpected: "result",
+					Desc:       d.desc,
+					At:         i,
+					Input:      forbidFirst,
+					Expected:   d.expected,
+					Result:     result,
+				}))
+			}
+		}
+	}
+}
+
+func TestNewClientForbidsDebug(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    go_environment.Environment
+		expected bool
+	}{
+		{
+			desc: "dev",
+			input: go_environment.Environment{
+				Stage: go_environment.StageDev,
+			},
+			expected: true,
+		},
+
+		{
+			desc: "prod",
+			input: go_environment.Environment{
+				Stage: go_environment.StageProd,
+			},
+			expected: false,
+		},
+
+		{
+			desc: "prod with override",
+			input: go_environment.Environment{
+				DebugProdOverride: true,
+				Stage:             go_environment.StageProd,
+			},
+			expected: true,
+		},
+	}
+
+	for i, d := range data {
+		var buf bytes.Buffer
+		logClient := NewClient(context.Background(), Config{
+			Env:   d.input,
+			Level: NewLevel(SeverityDebug),
+			Sinks: []Sink{
+				NewWriterSink(&buf, SeverityDebug, NewJSONEncoder("", nil)),
+			},
+		})
+		buf.Reset()
+		logClient.Debug(context.Background(), "Debug")
+		result := buf.Len() > 0
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    string
+		expected Severity
+		err      bool
+	}{
+		{
+			desc:     "upper",
+			input:    "WARN",
+			expected: SeverityWarn,
+		},
+
+		{
+			desc:     "lower with space",
+			input:    " debug ",
+			expected: SeverityDebug,
+		},
+
+		{
+			desc:  "invalid",
+			input: "verbose",
+			err:   true,
+		},
+	}
+
+	for i, d := range data {
+		result, err := ParseSeverity(d.input)
+
+		if (err != nil) != d.err || result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
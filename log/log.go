@@ -20,11 +20,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"net"
+	"net/url"
 	"os"
-	"reflect"
-	"runtime"
-	"strings"
+	"sync"
 	"time"
 
 	go_context "github.com/caigwatkin/go/context"
@@ -38,42 +38,135 @@ type Client interface {
 	Warn(ctx context.Context, message string, fields ...Field)
 	Error(ctx context.Context, message string, fields ...Field)
 	Fatal(ctx context.Context, message string, fields ...Field)
+	Flush(ctx context.Context) error
+	Close(ctx context.Context) error
+	RegisterShutdownHook(hook func(ctx context.Context))
+	With(fields ...Field) Client
+	Named(name string) Client
+	WithCallerSkip(skip int) Client
 }
 
-var (
-	remote bool
-)
-
 type Config struct {
-	Env go_environment.Environment
-}
+	Env            go_environment.Environment
+	GcpProjectId   string            // Used to qualify trace IDs in remote logs
+	Labels         map[string]string // Added to the labels of remote logs
+	Sinks          []Sink            // Defaults to stdout and stderr, encoded as JSON when remote and for the console otherwise
+	Console        *ConsoleConfig    // Of the default console encoder, defaults to compact and coloured if stdout is a terminal
+	Level          *Level            // Defaults to debug if enabled by the environment, otherwise info, and forbids debug if the environment does not allow it
+	Async          *AsyncConfig      // Buffers the default stdout and stderr, counting writes dropped in the metrics, wrap writers of sinks with NewAsyncWriter otherwise
+	Sampling       *SamplingConfig   // Suppresses repetitive entries, nil outputs all
+	Redaction      *Redaction        // Defaults to masking DefaultRedactedKeys
+	ErrorReporting *ErrorReporting   // Shapes error entries of the default remote encoder for Cloud Error Reporting
+	Metrics        *Metrics          // Counts entries output, nil counts none
+	Hooks          []Hook            `json:"-"` // Run in order on entries output, before redaction, counting and writing
+	DisableCaller  bool              // Omits the caller of entries, for hot paths, which also disables level overrides
+	Fatal          FatalPolicy
+	FatalExit      int                                  // Exit code of FatalPolicyExit, defaults to 1
+	FatalHook      func(message string, fields []Field) `json:"-"` // Called by FatalPolicyHook
+	FatalTimeout   time.Duration                        // For flushing and shutdown hooks of FatalPolicyExit, defaults to 5s
+}
+
+// FatalPolicy of the client after a fatal entry is output and flushed
+type FatalPolicy int
+
+const (
+	// FatalPolicyPanic with the message, the default
+	//
+	// Suits libraries and code which recovers, but note recovery middleware, e.g. in HTTP handlers, swallows the panic
+	FatalPolicyPanic FatalPolicy = iota
+
+	// FatalPolicyExit the process with the exit code after running shutdown hooks and closing the client
+	//
+	// Suits cmd tools and services, where a fatal condition must stop the process, but deferred calls do not run
+	FatalPolicyExit
+
+	// FatalPolicyHook calls the fatal hook, then Fatal returns
+	//
+	// Suits tests, which record the call, as code after Fatal continues to run
+	FatalPolicyHook
+)
 
 // NewClient for logging
 func NewClient(ctx context.Context, config Config) Client {
-	fmt.Println("Initializing", config)
+	fmt.Println("Initializing") // The config is logged once the client is initialized, as it may have secrets to redact
+
+	var sink Sink
+	var closers []io.Closer
+	switch len(config.Sinks) {
+	case 0:
+		var stdoutEncoder, stderrEncoder Encoder
+		if config.Env.Remote {
+			stdoutEncoder = NewJSONEncoder(config.GcpProjectId, config.Labels)
+			if config.ErrorReporting != nil {
+				stdoutEncoder = NewErrorReportingJSONEncoder(config.GcpProjectId, config.Labels, *config.ErrorReporting)
+			}
+			stderrEncoder = stdoutEncoder
+		} else {
+			var console ConsoleConfig
+			if config.Console != nil {
+				console = *config.Console
+			}
+			// Each writer has its own encoder, as either may be a terminal while the other is redirected
+			stdoutEncoder = NewConsoleEncoderFor(os.Stdout, console)
+			stderrEncoder = NewConsoleEncoderFor(os.Stderr, console)
+		}
+		var stdout, stderr io.Writer = os.Stdout, os.Stderr
+		if config.Async != nil {
+			asyncStdout := NewAsyncWriter(os.Stdout, *config.Async)
+			asyncStderr := NewAsyncWriter(os.Stderr, *config.Async)
+			stdout, stderr = asyncStdout, asyncStderr
+			closers = append(closers, asyncStdout, asyncStderr)
+			if config.Metrics != nil {
+				config.Metrics.CountDropped(asyncStdout)
+				config.Metrics.CountDropped(asyncStderr)
+			}
+		}
+		sink = newStdSink(stdout, stderr, stdoutEncoder, stderrEncoder)
+	case 1:
+		sink = config.Sinks[0]
+	default:
+		sink = NewFanOutSink(config.Sinks...)
+	}
+
+	level := config.Level
+	if level == nil {
+		level = NewLevel(SeverityInfo)
+		if config.Env.DebugEnabled() {
+			level.SetMin(SeverityDebug)
+		}
+	}
+	if !config.Env.DebugAllowed() {
+		level.ForbidDebug()
+	}
 
-	remote = config.Env.Remote
+	if config.Fatal == FatalPolicyExit && config.FatalExit == 0 {
+		config.FatalExit = 1
+	}
+	if config.Fatal == FatalPolicyHook && config.FatalHook == nil {
+		config.FatalHook = func(string, []Field) {}
+	}
+	if config.FatalTimeout == 0 {
+		config.FatalTimeout = 5 * time.Second
+	}
 
-	flag := 0
-	colorCyan := ""
-	colorGreen := ""
-	colorRed := ""
-	colorYellow := ""
-	if !remote {
-		flag = log.Ldate | log.Ltime | log.Lmicroseconds
-		colorCyan = fmt.Sprintf("\x1b[%dm", cyan)
-		colorGreen = fmt.Sprintf("\x1b[%dm", green)
-		colorRed = fmt.Sprintf("\x1b[%dm", red)
-		colorYellow = fmt.Sprintf("\x1b[%dm", yellow)
+	redaction := Redaction{
+		Keys: DefaultRedactedKeys,
+	}
+	if config.Redaction != nil {
+		redaction = *config.Redaction
 	}
 
 	c := client{
-		config:      config,
-		loggerDebug: log.New(os.Stdout, fmt.Sprintf("%sDEBUG ", colorGreen), flag),
-		loggerInfo:  log.New(os.Stdout, fmt.Sprintf("%sINFO  ", colorCyan), flag),
-		loggerWarn:  log.New(os.Stderr, fmt.Sprintf("%sWARN  ", colorYellow), flag),
-		loggerError: log.New(os.Stderr, fmt.Sprintf("%sERROR ", colorRed), flag),
-		loggerFatal: log.New(os.Stderr, fmt.Sprintf("%sFATAL ", colorRed), flag),
+		closers:  closers,
+		config:   config,
+		level:    level,
+		redactor: newRedactor(redaction),
+		shutdown: &shutdownHooks{},
+		sink:     sink,
+	}
+	if config.Sampling != nil {
+		c.sampler = newSampler(*config.Sampling)
+		go c.sampler.run(c.summarise)
 	}
 
 	c.Info(ctx, "Initialized", FmtAny(config, "config"))
@@ -81,73 +174,255 @@ func NewClient(ctx context.Context, config Config) Client {
 }
 
 type client struct {
-	config      Config
-	loggerDebug *log.Logger
-	loggerInfo  *log.Logger
-	loggerWarn  *log.Logger
-	loggerError *log.Logger
-	loggerFatal *log.Logger
+	callerSkip int         // See WithCallerSkip
+	closers    []io.Closer // Created by the client, so closed by it
+	config     Config
+	fields     []Field // Bound, see With
+	level      *Level
+	name       string // See Named
+	redactor   *redactor
+	sampler    *sampler // Nil unless configured
+	shutdown   *shutdownHooks
+	sink       Sink
+}
+
+type shutdownHooks struct {
+	mu    sync.Mutex
+	hooks []func(ctx context.Context)
 }
 
 // Debug log at debug level
 func (c client) Debug(ctx context.Context, message string, fields ...Field) {
-	if c.config.Env.Debug {
-		c.output(ctx, severityDebug, message, fields)
-	}
+	c.output(ctx, SeverityDebug, message, fields)
 }
 
 // Info log at info level
 func (c client) Info(ctx context.Context, message string, fields ...Field) {
-	c.output(ctx, severityInfo, message, fields)
+	c.output(ctx, SeverityInfo, message, fields)
 }
 
-// Notice log at notice level
+// Notice log at notice level, then flush
 func (c client) Notice(ctx context.Context, message string, fields ...Field) {
-	c.output(ctx, severityNotice, message, fields)
+	c.output(ctx, SeverityNotice, message, fields)
+	c.flushOrReport(ctx)
 }
 
 // Warn log at warn level
 func (c client) Warn(ctx context.Context, message string, fields ...Field) {
-	c.output(ctx, severityWarn, message, fields)
+	c.output(ctx, SeverityWarn, message, fields)
 }
 
 // Error log at error level
 func (c client) Error(ctx context.Context, message string, fields ...Field) {
-	c.output(ctx, severityError, message, fields)
+	c.output(ctx, SeverityError, message, fields)
 }
 
-// Fatal log at fatal level
+// Fatal log at fatal level, then flush and apply the fatal policy
 func (c client) Fatal(ctx context.Context, message string, fields ...Field) {
-	c.output(ctx, severityFatal, message, fields)
+	c.output(ctx, SeverityFatal, message, fields)
+	switch c.config.Fatal {
+	case FatalPolicyExit:
+		ctx, cancel := context.WithTimeout(go_context.ShutDown(), c.config.FatalTimeout)
+		defer cancel()
+		c.runShutdownHooks(ctx)
+		if err := c.Close(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed closing log client", err)
+		}
+		osExit(c.config.FatalExit)
+	case FatalPolicyHook:
+		c.flushOrReport(ctx)
+		c.config.FatalHook(message, fields)
+	default:
+		c.flushOrReport(ctx)
+		panic(message)
+	}
+}
+
+// osExit is replaced in tests
+var osExit = os.Exit
+
+// RegisterShutdownHook to run before exiting with FatalPolicyExit, in reverse order of registration
+//
+// Use for cleanup which would otherwise be deferred, e.g. closing database clients
+func (c client) RegisterShutdownHook(hook func(ctx context.Context)) {
+	c.shutdown.mu.Lock()
+	defer c.shutdown.mu.Unlock()
+	c.shutdown.hooks = append(c.shutdown.hooks, hook)
+}
+
+func (c client) runShutdownHooks(ctx context.Context) {
+	c.shutdown.mu.Lock()
+	hooks := make([]func(ctx context.Context), len(c.shutdown.hooks))
+	copy(hooks, c.shutdown.hooks)
+	c.shutdown.mu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i](ctx)
+	}
+}
+
+// Flush entries buffered by sinks, waiting until they are written or the context is done
+func (c client) Flush(ctx context.Context) error {
+	return flush(ctx, c.sink)
 }
 
-// Field to log
-type Field string
+// Close after summarising suppressed entries and flushing, for use at shutdown
+//
+// Only writers created by the client are closed, sinks given in config are left to their creator to close
+func (c client) Close(ctx context.Context) error {
+	if c.sampler != nil {
+		c.sampler.close()
+		if suppressed := c.sampler.takeSuppressed(); suppressed != nil {
+			c.summarise(suppressed)
+		}
+	}
+	err := c.Flush(ctx)
+	for _, v := range c.closers {
+		if e := v.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (c client) flushOrReport(ctx context.Context) {
+	if err := c.Flush(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed flushing log entries", err)
+	}
+}
+
+// With fields bound to a child client, which are output before the fields of every entry
+//
+// The child shares the parent's sinks, level and shutdown hooks
+func (c client) With(fields ...Field) Client {
+	bound := make([]Field, 0, len(c.fields)+len(fields))
+	bound = append(bound, c.fields...)
+	c.fields = append(bound, fields...)
+	return c
+}
+
+// Named child client, for filtering output by component
+//
+// Names of children of named clients are joined with ".", e.g. "http.headers"
+func (c client) Named(name string) Client {
+	if c.name != "" {
+		name = c.name + "." + name
+	}
+	c.name = name
+	return c
+}
+
+// WithCallerSkip child client, which attributes entries to the caller skip frames above the caller of its methods
+//
+// Use in wrappers of the client which are called from other wrappers, otherwise mark wrappers with Helper
+func (c client) WithCallerSkip(skip int) Client {
+	c.callerSkip += skip
+	return c
+}
+
+// Field to log, a typed key/value pair which is encoded by the client when the entry is output
+//
+// Fields of entries which are not output, e.g. debug entries when debug is not enabled, are never encoded
+type Field struct {
+	kind    fieldKind
+	key     string
+	integer int64
+	float   float64
+	str     string
+	iface   interface{}
+}
+
+// Key of the field
+func (f Field) Key() string {
+	return f.key
+}
+
+// Value of the field, of the type given to its constructor, e.g. time.Duration for FmtDuration
+func (f Field) Value() interface{} {
+	switch f.kind {
+	case kindBool:
+		return f.integer == 1
+	case kindByte:
+		return byte(f.integer)
+	case kindDuration:
+		return time.Duration(f.integer)
+	case kindFloat32:
+		return float32(f.float)
+	case kindFloat64:
+		return f.float
+	case kindInt:
+		return int(f.integer)
+	case kindInt32:
+		return int32(f.integer)
+	case kindInt64:
+		return f.integer
+	case kindSecret:
+		return Redacted
+	case kindString:
+		return f.str
+	case kindUint:
+		return uint(f.integer)
+	case kindUint32:
+		return uint32(f.integer)
+	case kindUint64:
+		return uint64(f.integer)
+	default:
+		return f.iface
+	}
+}
+
+type fieldKind uint8
+
+const (
+	kindAny fieldKind = iota
+	kindAnys
+	kindBool
+	kindBools
+	kindByte
+	kindBytes
+	kindDuration
+	kindDurations
+	kindError
+	kindFloat32
+	kindFloat32s
+	kindFloat64
+	kindFloat64s
+	kindGroup
+	kindInt
+	kindInts
+	kindInt32
+	kindInt32s
+	kindInt64
+	kindInt64s
+	kindMap
+	kindObject
+	kindRawJSON
+	kindSecret
+	kindString
+	kindStringer
+	kindStrings
+	kindTime
+	kindTimes
+	kindUint
+	kindUints
+	kindUint32
+	kindUint32s
+	kindUint64
+	kindUint64s
+)
 
 // FmtAny using JSON marshaller with indenting
 //
 // Use this to format for logging any object that can be JSON unmarshalled
 // Type and value will be logged
 // If JSON unmarshalling fails, the value will not be logged
+//
+// Values which implement LogMarshaler are logged as with FmtObject, and fields of structs are omitted or masked by
+// log tags, e.g. `log:"-"` and `log:"redact"`
 func FmtAny(value interface{}, name string) Field {
-	if remote {
-		if value == nil {
-			return Field(fmt.Sprintf("%q:null", name))
-		}
-		blob, err := json.Marshal(value)
-		if err != nil {
-			return Field(fmt.Sprintf("%q:{\"type\":%q,\"value\":\"NOT JSON MARSHALLABLE\"}", name, reflect.TypeOf(value)))
-		}
-		return Field(fmt.Sprintf("%q:{\"type\":%q,\"value\":%s}", name, reflect.TypeOf(value), blob))
+	if v, ok := value.(LogMarshaler); ok {
+		return FmtObject(v, name)
 	}
-	if value == nil {
-		return Field(fmt.Sprintf("%q: null", name))
-	}
-	blob, err := json.MarshalIndent(value, "\t\t", "\t")
-	if err != nil {
-		return Field(fmt.Sprintf("%q: {\n\t\t\"type\": %q,\n\t\t\"value\": \"NOT JSON MARSHALLABLE\"\n\t}", name, reflect.TypeOf(value)))
-	}
-	return Field(fmt.Sprintf("%q: {\n\t\t\"type\": %q,\n\t\t\"value\": %s\n\t}", name, reflect.TypeOf(value), blob))
+	return Field{kind: kindAny, key: name, iface: value}
 }
 
 // FmtAnys using JSON marshaller with indenting
@@ -156,308 +431,308 @@ func FmtAny(value interface{}, name string) Field {
 // Type and value will be logged
 // If JSON unmarshalling fails, the value will not be logged
 func FmtAnys(values []interface{}, name string) Field {
-	if remote {
-		var vals []interface{}
-		for _, v := range values {
-			if v == nil {
-				vals = append(vals, "null")
-				continue
-			}
-			var s string
-			if blob, err := json.Marshal(v); err != nil {
-				s = fmt.Sprintf("{\"type\":%q,\"value\":\"NOT JSON MARSHALLABLE\"}", reflect.TypeOf(v))
-			} else {
-				s = fmt.Sprintf("{\"type\":%q,\"value\":%s}", reflect.TypeOf(v), blob)
-			}
-			vals = append(vals, s)
-		}
-		return fmtSlice(vals, name, "%s")
-	}
-	var vals []interface{}
-	for _, v := range values {
-		if v == nil {
-			vals = append(vals, "null")
-			continue
-		}
-		var s string
-		if blob, err := json.MarshalIndent(v, "\t\t\t", "\t"); err != nil {
-			s = fmt.Sprintf("{\n\t\t\t\"type\": %q,\n\t\t\t\"value\": \"NOT JSON MARSHALLABLE\"\n\t\t}", reflect.TypeOf(v))
-		} else {
-			s = fmt.Sprintf("{\n\t\t\t\"type\": %q,\n\t\t\t\"value\": %s\n\t\t}", reflect.TypeOf(v), blob)
-		}
-		vals = append(vals, s)
-	}
-	return fmtSlice(vals, name, "%s")
+	return Field{kind: kindAnys, key: name, iface: values}
 }
 
 // FmtBool as name/value pair for logging
 func FmtBool(value bool, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%t", name, value))
+	var i int64
+	if value {
+		i = 1
 	}
-	return Field(fmt.Sprintf("%q: %t", name, value))
+	return Field{kind: kindBool, key: name, integer: i}
 }
 
 // FmtBools as name/[values] pair for logging
 func FmtBools(values []bool, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
-	}
-	return fmtSlice(vals, name, "%t")
+	return Field{kind: kindBools, key: name, iface: values}
 }
 
 // FmtByte as name/value pair for logging
 func FmtByte(value byte, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%q", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %q", name, value))
+	return Field{kind: kindByte, key: name, integer: int64(value)}
 }
 
 // FmtBytes as name/value pair for logging
 func FmtBytes(value []byte, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%q", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %q", name, value))
+	return Field{kind: kindBytes, key: name, iface: value}
 }
 
 // FmtDuration as name/value pair for logging
 func FmtDuration(value time.Duration, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%q", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %q", name, value))
+	return Field{kind: kindDuration, key: name, integer: int64(value)}
 }
 
 // FmtDurations as name/[values] pair for logging
 func FmtDurations(values []time.Duration, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
-	}
-	return fmtSlice(vals, name, "%q")
+	return Field{kind: kindDurations, key: name, iface: values}
 }
 
 // FmtError as name/value pair for logging
 func FmtError(err error) Field {
-	if remote {
-		if err == nil {
-			return Field("\"error\":null")
-		}
-		friendly := fmt.Sprintf("%s", err)
-		trace := fmt.Sprintf("%+v", err)
-		if trace == friendly {
-			return Field(fmt.Sprintf("\"error\":%q", friendly))
-		}
-		return Field(fmt.Sprintf("\"error\":{\"friendly\":%q,\"trace\":%s}", friendly, trace))
-	}
-	if err == nil {
-		return Field("\"error\": null")
-	}
-	friendly := fmt.Sprintf("%s", err)
-	trace := fmt.Sprintf("%+v", err)
-	if trace == friendly {
-		return Field(fmt.Sprintf("\"error\": %q", friendly))
-	}
-	return Field(fmt.Sprintf("\"error\": {\n\t\t\"friendly\": %q,\n\t\t\"trace\": %s\n\t}", friendly, trace))
+	return Field{kind: kindError, key: "error", iface: err}
 }
 
 // FmtFloat32 as name/value pair for logging
 func FmtFloat32(value float32, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%.5f", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %.5f", name, value))
+	return Field{kind: kindFloat32, key: name, float: float64(value)}
 }
 
 // FmtFloat32s as name/[values] pair for logging
 func FmtFloat32s(values []float32, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
-	}
-	return fmtSlice(vals, name, "%.5f")
+	return Field{kind: kindFloat32s, key: name, iface: values}
 }
 
 // FmtFloat64 as name/value pair for logging
 func FmtFloat64(value float64, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%.10f", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %.10f", name, value))
+	return Field{kind: kindFloat64, key: name, float: value}
 }
 
 // FmtFloat64s as name/[values] pair for logging
 func FmtFloat64s(values []float64, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
-	}
-	return fmtSlice(vals, name, "%.10f")
+	return Field{kind: kindFloat64s, key: name, iface: values}
+}
+
+// FmtGroup of fields nested under the name for logging
+func FmtGroup(name string, fields ...Field) Field {
+	return Field{kind: kindGroup, key: name, iface: fields}
 }
 
 // FmtInt as name/value pair for logging
 func FmtInt(value int, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%d", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %d", name, value))
+	return Field{kind: kindInt, key: name, integer: int64(value)}
 }
 
 // FmtInts as name/[values] pair for logging
 func FmtInts(values []int, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
-	}
-	return fmtSlice(vals, name, "%d")
+	return Field{kind: kindInts, key: name, iface: values}
 }
 
 // FmtInt32 as name/value pair for logging
 func FmtInt32(value int32, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%d", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %d", name, value))
+	return Field{kind: kindInt32, key: name, integer: int64(value)}
 }
 
 // FmtInt32s as name/[values] pair for logging
 func FmtInt32s(values []int32, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
-	}
-	return fmtSlice(vals, name, "%d")
+	return Field{kind: kindInt32s, key: name, iface: values}
 }
 
 // FmtInt64 as name/value pair for logging
 func FmtInt64(value int64, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%d", name, value))
-	}
-	return Field(fmt.Sprintf("%q: %d", name, value))
+	return Field{kind: kindInt64, key: name, integer: value}
 }
 
 // FmtInt64s as name/[values] pair for logging
 func FmtInt64s(values []int64, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
+	return Field{kind: kindInt64s, key: name, iface: values}
+}
+
+// FmtIP as name/value pair for logging
+func FmtIP(value net.IP, name string) Field {
+	return Field{kind: kindStringer, key: name, iface: value}
+}
+
+// FmtMap as name/{values} pair for logging, with values JSON marshalled and keys sorted
+func FmtMap(values map[string]interface{}, name string) Field {
+	return Field{kind: kindMap, key: name, iface: values}
+}
+
+// FmtObject of the fields the value marshals to for logging, nested under the name
+//
+// The value is only marshalled if the entry is output, and is logged as null if it is nil, including a nil pointer
+func FmtObject(value LogMarshaler, name string) Field {
+	if isNilValue(value) {
+		return Field{kind: kindObject, key: name}
 	}
-	return fmtSlice(vals, name, "%d")
+	return Field{kind: kindObject, key: name, iface: value}
+}
+
+// FmtRawJSON as name/value pair for logging, embedded as JSON if it is valid, otherwise as a string
+func FmtRawJSON(value json.RawMessage, name string) Field {
+	return Field{kind: kindRawJSON, key: name, iface: value}
+}
+
+// FmtSecret as name/masked value pair for logging
+//
+// The value is never output, use this for plaintext secrets, passwords and tokens
+func FmtSecret(_ interface{}, name string) Field {
+	return Field{kind: kindSecret, key: name}
 }
 
 // FmtString as name/value pair for logging
 func FmtString(value string, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%q", name, value))
+	return Field{kind: kindString, key: name, str: value}
+}
+
+// FmtStringer as name/value pair for logging
+//
+// String is only called if the entry is output, and not for nil pointers, which are logged as null
+func FmtStringer(value fmt.Stringer, name string) Field {
+	if isNilValue(value) {
+		return Field{kind: kindStringer, key: name}
 	}
-	return Field(fmt.Sprintf("%q: %q", name, value))
+	return Field{kind: kindStringer, key: name, iface: value}
 }
 
 // FmtStrings as name/[values] pair for logging
 func FmtStrings(values []string, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v)
-	}
-	return fmtSlice(vals, name, "%q")
+	return Field{kind: kindStrings, key: name, iface: values}
 }
 
 // FmtTime as name/value pair for logging
 func FmtTime(value time.Time, name string) Field {
-	if remote {
-		return Field(fmt.Sprintf("%q:%q", name, value.Format(time.RFC3339Nano)))
-	}
-	return Field(fmt.Sprintf("%q: %q", name, value.Format(time.RFC3339Nano)))
+	return Field{kind: kindTime, key: name, iface: value}
 }
 
 // FmtTimes as name/[values] pair for logging
 func FmtTimes(values []time.Time, name string) Field {
-	var vals []interface{}
-	for _, v := range values {
-		vals = append(vals, v.Format(time.RFC3339Nano))
-	}
-	return fmtSlice(vals, name, "%q")
+	return Field{kind: kindTimes, key: name, iface: values}
 }
 
-func fmtSlice(values []interface{}, name, format string) Field {
-	if remote {
-		if len(values) == 0 {
-			return Field(fmt.Sprintf("%q:[]", name))
-		}
-		f := make([]string, len(values))
-		for i, v := range values {
-			f[i] = fmt.Sprintf(format, v)
-		}
-		return Field(fmt.Sprintf("%q:[%s]", name, strings.Join(f, ",")))
-	}
-	if len(values) == 0 {
-		return Field(fmt.Sprintf("%q: []", name))
-	}
-	f := make([]string, len(values))
-	for i, v := range values {
-		f[i] = fmt.Sprintf(format, v)
-	}
-	return Field(fmt.Sprintf("%q: [\n\t\t%s\n\t]", name, strings.Join(f, ",\n\t\t")))
+// FmtUint as name/value pair for logging
+func FmtUint(value uint, name string) Field {
+	return Field{kind: kindUint, key: name, integer: int64(value)}
 }
 
-const (
-	red    = 31
-	green  = 32
-	yellow = 33
-	cyan   = 36
-
-	severityDebug  = iota
-	severityInfo   = iota
-	severityNotice = iota // Flush, if applicable
-	severityWarn   = iota
-	severityError  = iota
-	severityFatal  = iota // Flush, if applicable
-)
+// FmtUints as name/[values] pair for logging
+func FmtUints(values []uint, name string) Field {
+	return Field{kind: kindUints, key: name, iface: values}
+}
 
-func (c client) output(ctx context.Context, severity int, message string, fields []Field) {
-	line, funcName := runtimeLineAndFuncName(2)
-	message = fmtLog(message, go_context.CorrelationId(ctx), funcName, line, fields)
-	switch severity {
-	case severityDebug:
-		c.loggerDebug.Println(message)
-	case severityInfo, severityNotice:
-		c.loggerInfo.Println(message)
-	case severityWarn:
-		c.loggerWarn.Println(message)
-	case severityError:
-		c.loggerError.Println(message)
-	case severityFatal:
-		c.loggerFatal.Panicln(message)
-	}
+// FmtUint32 as name/value pair for logging
+func FmtUint32(value uint32, name string) Field {
+	return Field{kind: kindUint32, key: name, integer: int64(value)}
 }
 
-func runtimeLineAndFuncName(skip int) (int, string) {
-	pc, _, line, _ := runtime.Caller(skip + 1)
-	funcName := runtime.FuncForPC(pc).Name()
-	return line, funcName
+// FmtUint32s as name/[values] pair for logging
+func FmtUint32s(values []uint32, name string) Field {
+	return Field{kind: kindUint32s, key: name, iface: values}
 }
 
-func fmtLog(message, correlationId, funcName string, line int, fields []Field) string {
-	if remote {
-		return fmt.Sprintf("[%s] [%s] [%s:%d] %s", message, correlationId, funcName, line, fmtFields(fields))
-	}
-	return fmt.Sprintf("[%s] [%s] [%s:%d] %s\x1b[0m", message, correlationId, funcName, line, fmtFields(fields))
+// FmtUint64 as name/value pair for logging
+func FmtUint64(value uint64, name string) Field {
+	return Field{kind: kindUint64, key: name, integer: int64(value)}
 }
 
-func fmtFields(fields []Field) string {
-	if len(fields) == 0 {
-		return ""
+// FmtUint64s as name/[values] pair for logging
+func FmtUint64s(values []uint64, name string) Field {
+	return Field{kind: kindUint64s, key: name, iface: values}
+}
+
+// FmtURL as name/value pair for logging, with any password masked
+func FmtURL(value *url.URL, name string) Field {
+	return Field{kind: kindStringer, key: name, iface: redactedURL{value}}
+}
+
+// Severity of a log entry, in increasing order
+type Severity int
+
+const (
+	SeverityDebug Severity = iota
+	SeverityInfo
+	SeverityNotice // Flushes after output
+	SeverityWarn
+	SeverityError
+	SeverityFatal // Flushes after output, then follows the fatal policy of the config
+)
+
+var severityStrings = map[Severity]string{
+	SeverityDebug:  "DEBUG",
+	SeverityInfo:   "INFO",
+	SeverityNotice: "NOTICE",
+	SeverityWarn:   "WARN",
+	SeverityError:  "ERROR",
+	SeverityFatal:  "FATAL",
+}
+
+func (s Severity) String() string {
+	if v, ok := severityStrings[s]; ok {
+		return v
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+func (c client) output(ctx context.Context, severity Severity, message string, fields []Field) {
+	var file, funcName string
+	var line int
+	located := c.config.DisableCaller
+	if !located && c.level.overridden() {
+		file, line, funcName = Caller(2 + c.callerSkip)
+		located = true
+	}
+	if !c.level.Enabled(severity, funcName) || !c.sink.Enabled(severity) {
+		return
+	}
+	if c.sampler != nil && !c.sampler.allow(severity, message) {
+		return
+	}
+	if !located {
+		file, line, funcName = Caller(2 + c.callerSkip)
+	}
+	c.write(Entry{
+		Time:          time.Now(),
+		Severity:      severity,
+		Message:       message,
+		CorrelationId: go_context.CorrelationId(ctx),
+		TraceId:       go_context.TraceId(ctx),
+		File:          file,
+		Line:          line,
+		Function:      funcName,
+		Logger:        c.name,
+		Fields:        c.withFields(fields),
+	})
+}
+
+// summarise entries suppressed by sampling, keyed by message, bypassing sampling
+func (c client) summarise(suppressed map[string]int) {
+	if !c.level.Enabled(SeverityWarn, "") || !c.sink.Enabled(SeverityWarn) {
+		return
+	}
+	var total int
+	for _, v := range suppressed {
+		total += v
+	}
+	c.write(Entry{
+		Time:     time.Now(),
+		Severity: SeverityWarn,
+		Message:  "Log entries suppressed",
+		Logger:   c.name,
+		Fields: []Field{
+			FmtInt(total, "total"),
+			FmtAny(suppressed, "suppressed"),
+		},
+	})
+}
+
+// write the entry after running hooks and redacting it, so fields added by hooks are redacted
+func (c client) write(e Entry) {
+	for _, v := range c.config.Hooks {
+		var keep bool
+		e.redactor = c.redactor // For hooks which write the entry, see Entry.redacted
+		if e, keep = runHook(v, e); !keep {
+			return
+		}
 	}
-	var fs []string
-	for _, field := range fields {
-		fs = append(fs, string(field))
+	e.Fields = c.redactor.redact(e.Fields)
+	e.redactor = nil
+	var size int
+	if c.config.Metrics != nil {
+		e.size = &size // Noted by the sink encoding the entry, so it is not encoded again for metrics
 	}
-	if remote {
-		return fmt.Sprintf("{%s}", strings.Join(fs, ","))
+	if err := c.sink.Write(e); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing log entry", err)
+	}
+	if c.config.Metrics != nil {
+		c.config.Metrics.record(e, size)
+	}
+}
+
+func (c client) withFields(fields []Field) []Field {
+	if len(c.fields) == 0 {
+		return fields
 	}
-	return fmt.Sprintf("{\n\t%s\n}", strings.Join(fs, ",\n\t"))
+	all := make([]Field, 0, len(c.fields)+len(fields))
+	all = append(all, c.fields...)
+	return append(all, fields...)
 }
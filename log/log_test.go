@@ -17,11 +17,16 @@ limitations under the License.
 package log
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,6 +53,7 @@ func Test_NewClient(t *testing.T) {
 					Env: go_environment.Environment{
 						App: "app",
 					},
+					FatalTimeout: 5 * time.Second,
 				},
 			},
 		},
@@ -76,7 +82,7 @@ func Test_NewClient(t *testing.T) {
 				Result:     result,
 			}))
 
-		} else if v.config != d.expected.config {
+		} else if !reflect.DeepEqual(v.config, d.expected.config) {
 			t.Error(go_testing.Errorf(go_testing.Error{
 				Unexpected: "result.config",
 				Desc:       d.desc,
@@ -167,31 +173,29 @@ func Test_FmtAny(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtAny(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtAny(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtAny(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtAny(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -281,31 +285,29 @@ func Test_FmtAnys(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtAnys(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtAnys(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtAnys(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtAnys(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -351,31 +353,29 @@ func Test_FmtBool(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtBool(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtBool(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtBool(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtBool(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -445,31 +445,29 @@ func Test_FmtBools(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtBools(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtBools(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtBools(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtBools(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -497,7 +495,7 @@ func Test_FmtByte(t *testing.T) {
 			},
 			expected: expected{
 				Result:       "\"name\": 'A'",
-				ResultRemote: "\"name\":'A'",
+				ResultRemote: "\"name\":\"A\"",
 			},
 		},
 
@@ -509,37 +507,35 @@ func Test_FmtByte(t *testing.T) {
 			},
 			expected: expected{
 				Result:       "\"name\": '\\x00'",
-				ResultRemote: "\"name\":'\\x00'",
+				ResultRemote: "\"name\":\"\\u0000\"",
 			},
 		},
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtByte(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtByte(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtByte(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtByte(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -615,37 +611,35 @@ func Test_FmtBytes(t *testing.T) {
 			},
 			expected: expected{
 				Result:       "\"name\": \"\\x00\\x19\\x12\"",
-				ResultRemote: "\"name\":\"\\x00\\x19\\x12\"",
+				ResultRemote: "\"name\":\"\\u0000\\u0019\\u0012\"",
 			},
 		},
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtBytes(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtBytes(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtBytes(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtBytes(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -739,31 +733,29 @@ func Test_FmtDuration(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtDuration(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtDuration(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtDuration(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtDuration(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -833,45 +825,45 @@ func Test_FmtDurations(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtDurations(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtDurations(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtDurations(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtDurations(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
 }
 
 func Test_FmtError(t *testing.T) {
+	_, file, line, _ := runtime.Caller(0)
 	errWithTrace := go_errors.New("error")
-	trace := fmt.Sprintf("%+v", errWithTrace)
 	type input struct {
 		err error
 	}
 	type expected struct {
-		Result       string
-		ResultRemote string
+		Result             string
+		ResultPrefix       string // Followed by the rest of the stack
+		ResultRemote       string
+		ResultRemotePrefix string // Followed by the rest of the stack
 	}
 	var data = []struct {
 		desc     string
@@ -896,7 +888,18 @@ func Test_FmtError(t *testing.T) {
 			},
 			expected: expected{
 				Result:       "\"error\": \"some_string\"",
-				ResultRemote: "\"error\":\"some_string\"",
+				ResultRemote: "\"error\":{\"message\":\"some_string\",\"type\":\"*errors.errorString\"}",
+			},
+		},
+
+		{
+			desc: "typed nil",
+			input: input{
+				err: (*valueError)(nil),
+			},
+			expected: expected{
+				Result:       "\"error\": \"<nil>\"",
+				ResultRemote: "\"error\":{\"message\":\"\\u003cnil\\u003e\",\"type\":\"*log.valueError\"}",
 			},
 		},
 
@@ -906,43 +909,50 @@ func Test_FmtError(t *testing.T) {
 				err: errWithTrace,
 			},
 			expected: expected{
-				Result:       fmt.Sprintf("\"error\": {\n\t\t\"friendly\": \"error\",\n\t\t\"trace\": %s\n\t}", trace),
-				ResultRemote: fmt.Sprintf("\"error\":{\"friendly\":\"error\",\"trace\":%s}", trace),
+				ResultPrefix:       fmt.Sprintf("\"error\": {\n\t\t\"message\": \"error\",\n\t\t\"type\": \"*errors.fundamental\",\n\t\t\"stack\": [\n\t\t\t{\n\t\t\t\t\"function\": \"github.com/caigwatkin/go/log.Test_FmtError\",\n\t\t\t\t\"file\": %s,\n\t\t\t\t\"line\": %d\n\t\t\t},", jsonString(file), line+1),
+				ResultRemotePrefix: fmt.Sprintf("\"error\":{\"message\":\"error\",\"type\":\"*errors.fundamental\",\"stack\":[{\"function\":\"github.com/caigwatkin/go/log.Test_FmtError\",\"file\":%s,\"line\":%d},", jsonString(file), line+1),
 			},
 		},
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtError(d.input.err)
+		result := encodeFieldConsole(FmtError(d.input.err))
 
-		if string(result) != d.expected.Result {
+		if (d.expected.ResultPrefix == "" && result != d.expected.Result) || !strings.HasPrefix(result, d.expected.ResultPrefix) {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
-				Expected:   d.expected.Result,
-				Result:     string(result),
+				Expected:   d.expected,
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtError(d.input.err)
+		resultRemote := encodeFieldJSON(FmtError(d.input.err))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if (d.expected.ResultRemotePrefix == "" && resultRemote != d.expected.ResultRemote) || !strings.HasPrefix(resultRemote, d.expected.ResultRemotePrefix) {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
-				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Expected:   d.expected,
+				Result:     resultRemote,
 			}))
 		}
 	}
 }
 
+// valueError has a value receiver, so its Error method panics if called on a nil pointer
+type valueError struct {
+	message string
+}
+
+func (e valueError) Error() string {
+	return e.message
+}
+
 func Test_FmtFloat32(t *testing.T) {
 	type input struct {
 		Value float32
@@ -1067,31 +1077,29 @@ func Test_FmtFloat32(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtFloat32(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtFloat32(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtFloat32(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtFloat32(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1161,31 +1169,29 @@ func Test_FmtFloat32s(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtFloat32s(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtFloat32s(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtFloat32s(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtFloat32s(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1315,31 +1321,29 @@ func Test_FmtFloat64(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtFloat64(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtFloat64(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtFloat64(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtFloat64(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1409,31 +1413,29 @@ func Test_FmtFloat64s(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtFloat64s(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtFloat64s(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtFloat64s(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtFloat64s(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1491,31 +1493,29 @@ func Test_FmtInt(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtInt(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtInt(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtInt(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtInt(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1585,31 +1585,29 @@ func Test_FmtInts(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtInts(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtInts(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtInts(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtInts(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1667,31 +1665,29 @@ func Test_FmtInt32(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtInt32(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtInt32(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtInt32(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtInt32(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1761,31 +1757,29 @@ func Test_FmtInt32s(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtInt32s(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtInt32s(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtInt32s(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtInt32s(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1843,31 +1837,29 @@ func Test_FmtInt64(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtInt64(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtInt64(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtInt64(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtInt64(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -1937,31 +1929,29 @@ func Test_FmtInt64s(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtInt64s(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtInt64s(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtInt64s(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtInt64s(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -2007,31 +1997,29 @@ func Test_FmtString(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtString(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtString(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtString(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtString(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -2101,31 +2089,29 @@ func Test_FmtStrings(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtStrings(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtStrings(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtStrings(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtStrings(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -2175,31 +2161,29 @@ func Test_FmtTime(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtTime(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtTime(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtTime(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtTime(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
@@ -2273,41 +2257,37 @@ func Test_FmtTimes(t *testing.T) {
 	}
 
 	for i, d := range data {
-		remote = false
-		result := FmtTimes(d.input.Value, d.input.Name)
+		result := encodeFieldConsole(FmtTimes(d.input.Value, d.input.Name))
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := FmtTimes(d.input.Value, d.input.Name)
+		resultRemote := encodeFieldJSON(FmtTimes(d.input.Value, d.input.Name))
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
 }
 
-func Test_FmtSlice(t *testing.T) {
+func Test_writeSlice(t *testing.T) {
 	type input struct {
-		Value  []interface{}
-		Name   string
-		format string
+		Value []string
 	}
 	type expected struct {
 		Result       string
@@ -2321,93 +2301,99 @@ func Test_FmtSlice(t *testing.T) {
 		{
 			desc: "single",
 			input: input{
-				Value:  []interface{}{"string"},
-				Name:   "name",
-				format: "%q",
+				Value: []string{"string"},
 			},
 			expected: expected{
-				Result:       "\"name\": [\n\t\t\"string\"\n\t]",
-				ResultRemote: "\"name\":[\"string\"]",
+				Result:       "[\n\t\t\"string\"\n\t]",
+				ResultRemote: "[\"string\"]",
 			},
 		},
 
 		{
 			desc: "multi",
 			input: input{
-				Value:  []interface{}{"string", "also string"},
-				Name:   "name",
-				format: "%q",
+				Value: []string{"string", "also string"},
 			},
 			expected: expected{
-				Result:       "\"name\": [\n\t\t\"string\",\n\t\t\"also string\"\n\t]",
-				ResultRemote: "\"name\":[\"string\",\"also string\"]",
+				Result:       "[\n\t\t\"string\",\n\t\t\"also string\"\n\t]",
+				ResultRemote: "[\"string\",\"also string\"]",
 			},
 		},
 
 		{
 			desc: "empty",
 			input: input{
-				Value:  []interface{}{},
-				Name:   "name",
-				format: "",
+				Value: []string{},
 			},
 			expected: expected{
-				Result:       "\"name\": []",
-				ResultRemote: "\"name\":[]",
+				Result:       "[]",
+				ResultRemote: "[]",
 			},
 		},
 
 		{
 			desc: "nil",
 			input: input{
-				Value:  nil,
-				Name:   "name",
-				format: "",
+				Value: nil,
 			},
 			expected: expected{
-				Result:       "\"name\": []",
-				ResultRemote: "\"name\":[]",
+				Result:       "[]",
+				ResultRemote: "[]",
 			},
 		},
 	}
 
 	for i, d := range data {
-		remote = false
-		result := fmtSlice(d.input.Value, d.input.Name, d.input.format)
+		var b bytes.Buffer
+		writeSliceConsole(&b, len(d.input.Value), func(i int) string {
+			return strconv.Quote(d.input.Value[i])
+		})
+		result := b.String()
 
-		if string(result) != d.expected.Result {
+		if result != d.expected.Result {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(result)",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.Result,
-				Result:     string(result),
+				Result:     result,
 			}))
 		}
 
-		remote = true
-		resultRemote := fmtSlice(d.input.Value, d.input.Name, d.input.format)
+		b.Reset()
+		writeSliceJSON(&b, len(d.input.Value), func(i int) string {
+			return jsonString(d.input.Value[i])
+		})
+		resultRemote := b.String()
 
-		if string(resultRemote) != d.expected.ResultRemote {
+		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "string(resultRemote)",
+				Unexpected: "resultRemote",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
 				Expected:   d.expected.ResultRemote,
-				Result:     string(resultRemote),
+				Result:     resultRemote,
 			}))
 		}
 	}
 }
 
-func Test_runtimeLineAndFuncName(t *testing.T) {
-	line, funcName := runtimeLineAndFuncName(0)
-	pc, _, l, _ := runtime.Caller(0)
+func Test_Caller(t *testing.T) {
+	file, line, funcName := Caller(0)
+	pc, f, l, _ := runtime.Caller(0)
+	expectedFile := f
 	expectedLine := l - 1
 	expectedFuncName := runtime.FuncForPC(pc).Name()
 
+	if file != expectedFile {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "file",
+			Expected:   expectedFile,
+			Result:     file,
+		}))
+	}
 	if line != expectedLine {
 		t.Error(go_testing.Errorf(go_testing.Error{
 			Unexpected: "funcName",
@@ -2437,23 +2423,23 @@ func Test_FmtFields(t *testing.T) {
 		{
 			desc: "single",
 			input: []Field{
-				Field("field"),
+				FmtString("value", "field"),
 			},
 			expected: expected{
-				Result:       "{\n\tfield\n}",
-				ResultRemote: "{field}",
+				Result:       "{\n\t\"field\": \"value\"\n}",
+				ResultRemote: "{\"field\":\"value\"}",
 			},
 		},
 
 		{
 			desc: "multi",
 			input: []Field{
-				Field("field"),
-				Field("also_field"),
+				FmtString("value", "field"),
+				FmtInt(1, "also_field"),
 			},
 			expected: expected{
-				Result:       "{\n\tfield,\n\talso_field\n}",
-				ResultRemote: "{field,also_field}",
+				Result:       "{\n\t\"field\": \"value\",\n\t\"also_field\": 1\n}",
+				ResultRemote: "{\"field\":\"value\",\"also_field\":1}",
 			},
 		},
 
@@ -2462,7 +2448,7 @@ func Test_FmtFields(t *testing.T) {
 			input: []Field{},
 			expected: expected{
 				Result:       "",
-				ResultRemote: "",
+				ResultRemote: "{}",
 			},
 		},
 
@@ -2471,13 +2457,12 @@ func Test_FmtFields(t *testing.T) {
 			input: nil,
 			expected: expected{
 				Result:       "",
-				ResultRemote: "",
+				ResultRemote: "{}",
 			},
 		},
 	}
 
 	for i, d := range data {
-		remote = false
 		result := fmtFields(d.input)
 
 		if result != d.expected.Result {
@@ -2491,8 +2476,9 @@ func Test_FmtFields(t *testing.T) {
 			}))
 		}
 
-		remote = true
-		resultRemote := fmtFields(d.input)
+		var b bytes.Buffer
+		writePayload(&b, d.input)
+		resultRemote := b.String()
 
 		if resultRemote != d.expected.ResultRemote {
 			t.Error(go_testing.Errorf(go_testing.Error{
@@ -2511,35 +2497,29 @@ func Test_FmtLog(t *testing.T) {
 	type input struct {
 		Message       string
 		CorrelationId string
+		File          string
 		FuncName      string
 		Line          int
 		Fields        []Field
-		Remote        bool
-	}
-	type expected struct {
-		Result       string
-		ResultRemote string
 	}
 	var data = []struct {
 		desc     string
 		input    input
-		expected expected
+		expected string
 	}{
 		{
 			desc: "single",
 			input: input{
 				Message:       "message",
 				CorrelationId: "correlationId",
+				File:          "file.go",
 				FuncName:      "funcName",
 				Line:          0,
 				Fields: []Field{
-					Field("field"),
+					FmtString("value", "field"),
 				},
 			},
-			expected: expected{
-				Result:       "[message] [correlationId] [funcName:0] {\n\tfield\n}\x1b[0m",
-				ResultRemote: "[message] [correlationId] [funcName:0] {field}",
-			},
+			expected: "[message] [correlationId] [file.go:0 funcName] {\n\t\"field\": \"value\"\n}\x1b[0m",
 		},
 
 		{
@@ -2547,17 +2527,15 @@ func Test_FmtLog(t *testing.T) {
 			input: input{
 				Message:       "message",
 				CorrelationId: "correlationId",
+				File:          "file.go",
 				FuncName:      "funcName",
 				Line:          0,
 				Fields: []Field{
-					Field("field"),
-					Field("also_field"),
+					FmtString("value", "field"),
+					FmtInt(1, "also_field"),
 				},
 			},
-			expected: expected{
-				Result:       "[message] [correlationId] [funcName:0] {\n\tfield,\n\talso_field\n}\x1b[0m",
-				ResultRemote: "[message] [correlationId] [funcName:0] {field,also_field}",
-			},
+			expected: "[message] [correlationId] [file.go:0 funcName] {\n\t\"field\": \"value\",\n\t\"also_field\": 1\n}\x1b[0m",
 		},
 
 		{
@@ -2565,14 +2543,12 @@ func Test_FmtLog(t *testing.T) {
 			input: input{
 				Message:       "message",
 				CorrelationId: "correlationId",
+				File:          "file.go",
 				FuncName:      "funcName",
 				Line:          0,
 				Fields:        []Field{},
 			},
-			expected: expected{
-				Result:       "[message] [correlationId] [funcName:0] \x1b[0m",
-				ResultRemote: "[message] [correlationId] [funcName:0] ",
-			},
+			expected: "[message] [correlationId] [file.go:0 funcName] \x1b[0m",
 		},
 
 		{
@@ -2580,44 +2556,260 @@ func Test_FmtLog(t *testing.T) {
 			input: input{
 				Message:       "message",
 				CorrelationId: "correlationId",
+				File:          "file.go",
 				FuncName:      "funcName",
 				Line:          0,
 				Fields:        nil,
 			},
-			expected: expected{
-				Result:       "[message] [correlationId] [funcName:0] \x1b[0m",
-				ResultRemote: "[message] [correlationId] [funcName:0] ",
+			expected: "[message] [correlationId] [file.go:0 funcName] \x1b[0m",
+		},
+
+		{
+			desc: "caller disabled",
+			input: input{
+				Message:       "message",
+				CorrelationId: "correlationId",
+				Fields: []Field{
+					FmtString("value", "field"),
+				},
 			},
+			expected: "[message] [correlationId] {\n\t\"field\": \"value\"\n}\x1b[0m",
 		},
 	}
 
 	for i, d := range data {
-		remote = false
-		result := fmtLog(d.input.Message, d.input.CorrelationId, d.input.FuncName, d.input.Line, d.input.Fields)
+		result := fmtLog(d.input.Message, d.input.CorrelationId, d.input.File, d.input.FuncName, d.input.Line, d.input.Fields)
 
-		if result != d.expected.Result {
+		if result != d.expected {
 			t.Error(go_testing.Errorf(go_testing.Error{
 				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
-				Expected:   d.expected.Result,
+				Expected:   d.expected,
 				Result:     result,
 			}))
 		}
+	}
+}
+
+func Test_Fatal(t *testing.T) {
+	type expected struct {
+		Panicked bool
+		Exit     int
+		Hooked   string
+		Shutdown []string
+	}
+	var data = []struct {
+		desc     string
+		input    FatalPolicy
+		expected expected
+	}{
+		{
+			desc:  "panic",
+			input: FatalPolicyPanic,
+			expected: expected{
+				Panicked: true,
+			},
+		},
 
-		remote = true
-		resultRemote := fmtLog(d.input.Message, d.input.CorrelationId, d.input.FuncName, d.input.Line, d.input.Fields)
+		{
+			desc:  "exit",
+			input: FatalPolicyExit,
+			expected: expected{
+				Exit:     1,
+				Shutdown: []string{"second", "first"},
+			},
+		},
 
-		if resultRemote != d.expected.ResultRemote {
+		{
+			desc:  "hook",
+			input: FatalPolicyHook,
+			expected: expected{
+				Hooked: "message",
+			},
+		},
+	}
+
+	defer func() {
+		osExit = os.Exit
+	}()
+	for i, d := range data {
+		var result expected
+		osExit = func(code int) {
+			result.Exit = code
+		}
+		var buf bytes.Buffer
+		logClient := NewClient(context.Background(), Config{
+			Sinks: []Sink{
+				NewWriterSink(&buf, SeverityInfo, nil),
+			},
+			Fatal: d.input,
+			FatalHook: func(message string, fields []Field) {
+				result.Hooked = message
+			},
+		})
+		logClient.RegisterShutdownHook(func(ctx context.Context) {
+			result.Shutdown = append(result.Shutdown, "first")
+		})
+		logClient.RegisterShutdownHook(func(ctx context.Context) {
+			result.Shutdown = append(result.Shutdown, "second")
+		})
+		func() {
+			defer func() {
+				result.Panicked = recover() != nil
+			}()
+			logClient.Fatal(context.Background(), "message")
+		}()
+
+		if !reflect.DeepEqual(result, d.expected) {
 			t.Error(go_testing.Errorf(go_testing.Error{
-				Unexpected: "resultRemote",
+				Unexpected: "result",
 				Desc:       d.desc,
 				At:         i,
 				Input:      d.input,
-				Expected:   d.expected.ResultRemote,
-				Result:     resultRemote,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+		if !strings.Contains(buf.String(), "FATAL") {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "buf.String()",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   "FATAL",
+				Result:     buf.String(),
 			}))
 		}
 	}
 }
+
+func Test_WithNamed(t *testing.T) {
+	var buf bytes.Buffer
+	logClient := NewClient(context.Background(), Config{
+		Sinks: []Sink{
+			NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+		},
+	})
+	var data = []struct {
+		desc     string
+		input    Client
+		expected []string
+	}{
+		{
+			desc:  "named",
+			input: logClient.Named("secrets"),
+			expected: []string{
+				`"logger":"secrets"`,
+				`"jsonPayload":{"name":"value"}`,
+			},
+		},
+
+		{
+			desc:  "nested named with fields",
+			input: logClient.Named("http").With(FmtInt(1, "bound")).Named("headers").With(FmtBool(true, "also bound")),
+			expected: []string{
+				`"logger":"http.headers"`,
+				`"jsonPayload":{"bound":1,"also bound":true,"name":"value"}`,
+			},
+		},
+
+		{
+			desc:  "parent unchanged",
+			input: logClient,
+			expected: []string{
+				`"logging.googleapis.com/labels":{"correlationId":""}`,
+				`"jsonPayload":{"name":"value"}`,
+			},
+		},
+	}
+
+	for i, d := range data {
+		buf.Reset()
+		d.input.Info(context.Background(), "message", FmtString("value", "name"))
+		result := buf.String()
+
+		for _, e := range d.expected {
+			if !strings.Contains(result, e) {
+				t.Error(go_testing.Errorf(go_testing.Error{
+					Unexpected: "result",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   e,
+					Result:     result,
+				}))
+			}
+		}
+	}
+}
+
+func benchmarkClient(encoder Encoder, debug bool) client {
+	return client{
+		config: Config{
+			Env: go_environment.Environment{
+				Debug: debug,
+				Stage: go_environment.StageDev,
+			},
+		},
+		sink: NewWriterSink(io.Discard, SeverityDebug, encoder),
+	}
+}
+
+func benchmarkFields() []Field {
+	return []Field{
+		FmtString("value", "string"),
+		FmtInt(1, "int"),
+		FmtDuration(time.Second, "duration"),
+		FmtStrings([]string{"a", "b"}, "strings"),
+		FmtError(errors.New("error")),
+	}
+}
+
+func BenchmarkDebugDisabled(b *testing.B) {
+	c := benchmarkClient(NewConsoleEncoder(), false)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Debug(ctx, "message",
+			FmtString("value", "string"),
+			FmtInt(1, "int"),
+			FmtDuration(time.Second, "duration"),
+			FmtStrings([]string{"a", "b"}, "strings"),
+		)
+	}
+}
+
+func BenchmarkInfoConsole(b *testing.B) {
+	c := benchmarkClient(NewConsoleEncoder(), false)
+	ctx := context.Background()
+	fields := benchmarkFields()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Info(ctx, "message", fields...)
+	}
+}
+
+func BenchmarkInfoJSON(b *testing.B) {
+	c := benchmarkClient(NewJSONEncoder("", nil), false)
+	ctx := context.Background()
+	fields := benchmarkFields()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Info(ctx, "message", fields...)
+	}
+}
+
+func encodeFieldConsole(f Field) string {
+	var b bytes.Buffer
+	writeFieldConsole(&b, f)
+	return b.String()
+}
+
+func encodeFieldJSON(f Field) string {
+	var b bytes.Buffer
+	writeFieldJSON(&b, f)
+	return b.String()
+}
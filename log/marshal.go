@@ -0,0 +1,261 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// LogMarshaler is implemented by types which marshal themselves to fields for logging, without reflection
+//
+// See FmtObject
+type LogMarshaler interface {
+	MarshalLog() []Field
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	logMarshalerType  = reflect.TypeOf((*LogMarshaler)(nil)).Elem()
+	logTagged         sync.Map // reflect.Type to whether values of it are changed by logValue
+)
+
+// logValue for marshalling as JSON, with fields of structs omitted or masked by their log tags
+//
+// Values of types without log tags or log marshalers are returned unchanged, so they are marshalled as JSON would
+func logValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case redactedAny:
+		return v.value
+	case LogMarshaler:
+		if isNilValue(v) {
+			return nil
+		}
+		return fieldsJSON(v.MarshalLog())
+	}
+	if !hasLogTags(reflect.TypeOf(value)) {
+		return value
+	}
+	return taggedValue(reflect.ValueOf(value))
+}
+
+// isNilValue if the value is nil or a nil pointer, of which methods such as MarshalLog and String may panic
+func isNilValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func fieldsJSON(fields []Field) json.RawMessage {
+	var b bytes.Buffer
+	writePayload(&b, fields)
+	return b.Bytes()
+}
+
+func hasLogTags(t reflect.Type) bool {
+	if v, ok := logTagged.Load(t); ok {
+		return v.(bool)
+	}
+	has := hasLogTagsVisiting(t, make(map[reflect.Type]bool))
+	logTagged.Store(t, has)
+	return has
+}
+
+func hasLogTagsVisiting(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if t.Implements(logMarshalerType) {
+		return true
+	}
+	if t.Implements(jsonMarshalerType) || visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	switch t.Kind() {
+	case reflect.Array, reflect.Map, reflect.Ptr, reflect.Slice:
+		return hasLogTagsVisiting(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			if f.Tag.Get("log") != "" || hasLogTagsVisiting(f.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// taggedValue of a value of a type with log tags, as values which marshal as JSON would without them
+func taggedValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.CanInterface() {
+		switch w := v.Interface().(type) {
+		case LogMarshaler:
+			if isNilValue(w) {
+				return nil
+			}
+			return fieldsJSON(w.MarshalLog())
+		case json.Marshaler:
+			return w
+		}
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return taggedValue(v.Elem())
+	case reflect.Array, reflect.Slice:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if !hasLogTags(v.Type().Elem()) && v.CanInterface() {
+			return v.Interface()
+		}
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = taggedValue(v.Index(i))
+		}
+		return values
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if !hasLogTags(v.Type().Elem()) && v.CanInterface() {
+			return v.Interface()
+		}
+		values := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			values[fmt.Sprint(iter.Key().Interface())] = taggedValue(iter.Value())
+		}
+		return values
+	case reflect.Struct:
+		return taggedStruct(v)
+	default:
+		if !v.CanInterface() {
+			return nil // Promoted through an unexported embedded struct
+		}
+		return v.Interface()
+	}
+}
+
+// taggedStruct as an object of its exported fields named as JSON would, omitting and masking by log tags
+func taggedStruct(v reflect.Value) orderedObject {
+	t := v.Type()
+	var object orderedObject
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		logTag := f.Tag.Get("log")
+		if logTag == "-" {
+			continue
+		}
+		name, opts := f.Name, ""
+		if jsonTag, ok := f.Tag.Lookup("json"); ok {
+			if jsonTag == "-" {
+				continue
+			}
+			tagName := jsonTag
+			if i := strings.Index(jsonTag, ","); i >= 0 {
+				tagName, opts = jsonTag[:i], jsonTag[i:]
+			}
+			if tagName != "" {
+				name = tagName
+			} else if f.Anonymous {
+				name = ""
+			}
+		} else if f.Anonymous {
+			name = ""
+		}
+		fv := v.Field(i)
+		if strings.Contains(opts, ",omitempty") && fv.IsZero() {
+			continue
+		}
+		if name == "" {
+			if embedded, ok := taggedValue(fv).(orderedObject); ok {
+				object = append(object, embedded...)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		var value interface{} = Redacted
+		if logTag != "redact" {
+			value = taggedValue(fv)
+		}
+		object = append(object, orderedMember{
+			key:   name,
+			value: value,
+		})
+	}
+	return object
+}
+
+// orderedObject marshals as a JSON object with members in order
+type orderedObject []orderedMember
+
+type orderedMember struct {
+	key   string
+	value interface{}
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, v := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value, err := json.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(jsonString(v.key))
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// redactedURL is a stringer of a URL with any password masked
+type redactedURL struct {
+	*url.URL
+}
+
+func (u redactedURL) String() string {
+	if u.URL == nil {
+		return ""
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// MetricsOtherMessages is the message of counters of entries with messages beyond the max of NewMetrics
+const MetricsOtherMessages = "[other]"
+
+// SizeBuckets are the upper bounds, in bytes, of the buckets of the histogram of entry sizes
+var SizeBuckets = []int{128, 256, 512, 1024, 2048, 4096, 8192, 16384}
+
+// Metrics of entries output, counted by severity, logger name and message, and their sizes
+//
+// Share the metrics with the client through its config, and expose them with MountLogMetrics of the admin package.
+// Entries suppressed by sampling are not output, so are only counted as part of its summaries
+type Metrics struct {
+	maxMessages int
+	mu          sync.Mutex
+	counters    map[metricsKey]*MetricsCounter
+	messages    map[string]bool
+	sizes       []uint64 // Per bucket, not cumulative, with the last for sizes over the largest bucket
+	sizesCount  uint64
+	sizesSum    uint64
+	dropped     []func() uint64
+}
+
+type metricsKey struct {
+	severity Severity
+	logger   string
+	message  string
+}
+
+// NewMetrics counting up to max distinct messages, defaulting to 1000, with those beyond as MetricsOtherMessages
+//
+// Messages should be constant, with variable details in fields, so the number of counters is bounded
+func NewMetrics(maxMessages int) *Metrics {
+	if maxMessages <= 0 {
+		maxMessages = 1000
+	}
+	return &Metrics{
+		maxMessages: maxMessages,
+		counters:    make(map[metricsKey]*MetricsCounter),
+		messages:    make(map[string]bool),
+		sizes:       make([]uint64, len(SizeBuckets)+1),
+	}
+}
+
+// MetricsCounter of entries of a severity, logger name and message
+type MetricsCounter struct {
+	Severity      Severity  `json:"severity"`
+	Logger        string    `json:"logger"`
+	Message       string    `json:"message"`
+	Count         uint64    `json:"count"`
+	CorrelationId string    `json:"correlationId,omitempty"` // Of the latest entry with one
+	Latest        time.Time `json:"latest"`
+}
+
+// MetricsSnapshot of metrics at a time
+type MetricsSnapshot struct {
+	Counters []MetricsCounter `json:"counters"` // Sorted by severity, logger name and message
+	Sizes    SizeHistogram    `json:"sizes"`
+	Dropped  uint64           `json:"dropped"` // Writes dropped by async writers, see CountDropped
+}
+
+// SizeHistogram of entry sizes, being the bytes of the line first encoded for each by a sink
+//
+// Entries written only by sinks from outside this package are not encoded by it, so are not in the histogram
+type SizeHistogram struct {
+	Buckets []SizeBucket `json:"buckets"` // Cumulative, of SizeBuckets
+	Count   uint64       `json:"count"`
+	Sum     uint64       `json:"sum"`
+}
+
+// SizeBucket of entries of at most the upper bound in bytes
+type SizeBucket struct {
+	UpperBound int    `json:"upperBound"`
+	Count      uint64 `json:"count"`
+}
+
+// BySeverity totals of the counters
+func (s MetricsSnapshot) BySeverity() map[Severity]uint64 {
+	totals := make(map[Severity]uint64)
+	for _, v := range s.Counters {
+		totals[v.Severity] += v.Count
+	}
+	return totals
+}
+
+// CountDropped writes of the async writer in the metrics
+//
+// The client counts those of its default async writers, count those wrapping the writers of sinks given in config
+func (m *Metrics) CountDropped(w *AsyncWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped = append(m.dropped, w.Dropped)
+}
+
+// record the entry, with the size of its encoded line, or 0 if no sink of this package encoded it
+func (m *Metrics) record(e Entry, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	message := e.Message
+	if !m.messages[message] {
+		if len(m.messages) < m.maxMessages {
+			m.messages[message] = true
+		} else {
+			message = MetricsOtherMessages
+		}
+	}
+	key := metricsKey{
+		severity: e.Severity,
+		logger:   e.Logger,
+		message:  message,
+	}
+	c, ok := m.counters[key]
+	if !ok {
+		c = &MetricsCounter{
+			Severity: e.Severity,
+			Logger:   e.Logger,
+			Message:  message,
+		}
+		m.counters[key] = c
+	}
+	c.Count++
+	c.Latest = e.Time
+	if e.CorrelationId != "" {
+		c.CorrelationId = e.CorrelationId
+	}
+	if size == 0 {
+		return
+	}
+	m.sizes[sort.SearchInts(SizeBuckets, size)]++
+	m.sizesCount++
+	m.sizesSum += uint64(size)
+}
+
+// Snapshot of the metrics
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := MetricsSnapshot{
+		Counters: make([]MetricsCounter, 0, len(m.counters)),
+		Sizes: SizeHistogram{
+			Buckets: make([]SizeBucket, len(SizeBuckets)),
+			Count:   m.sizesCount,
+			Sum:     m.sizesSum,
+		},
+	}
+	for _, v := range m.counters {
+		s.Counters = append(s.Counters, *v)
+	}
+	for _, v := range m.dropped {
+		s.Dropped += v()
+	}
+	sort.Slice(s.Counters, func(i, j int) bool {
+		a, b := s.Counters[i], s.Counters[j]
+		if a.Severity != b.Severity {
+			return a.Severity < b.Severity
+		}
+		if a.Logger != b.Logger {
+			return a.Logger < b.Logger
+		}
+		return a.Message < b.Message
+	})
+	var cumulative uint64
+	for i, v := range SizeBuckets {
+		cumulative += m.sizes[i]
+		s.Sizes.Buckets[i] = SizeBucket{
+			UpperBound: v,
+			Count:      cumulative,
+		}
+	}
+	return s
+}
+
+// WritePrometheus text exposition format of the metrics to the writer
+//
+// See https://prometheus.io/docs/instrumenting/exposition_formats
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	return m.Snapshot().write(w, false)
+}
+
+// WriteOpenMetrics text format of the metrics to the writer, with the latest correlation ID of each counter as an exemplar
+//
+// See https://openmetrics.io
+func (m *Metrics) WriteOpenMetrics(w io.Writer) error {
+	return m.Snapshot().write(w, true)
+}
+
+func (s MetricsSnapshot) write(w io.Writer, openMetrics bool) error {
+	var b bytes.Buffer
+	entries := "log_entries_total"
+	if openMetrics {
+		entries = "log_entries"
+	}
+	fmt.Fprintf(&b, "# HELP %s Log entries output, by severity, logger name and message.\n", entries)
+	fmt.Fprintf(&b, "# TYPE %s counter\n", entries)
+	for _, v := range s.Counters {
+		fmt.Fprintf(&b, `log_entries_total{severity="%s",logger="%s",message="%s"} %d`, v.Severity, labelValue(v.Logger), labelValue(v.Message), v.Count)
+		if openMetrics && v.CorrelationId != "" && len(v.CorrelationId) <= 100 {
+			fmt.Fprintf(&b, ` # {correlationId="%s"} 1 %s`, labelValue(v.CorrelationId), strconv.FormatFloat(float64(v.Latest.UnixNano())/1e9, 'f', 3, 64))
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString("# HELP log_entry_size_bytes Sizes of log entries, being the bytes of their encoded lines.\n")
+	b.WriteString("# TYPE log_entry_size_bytes histogram\n")
+	for _, v := range s.Sizes.Buckets {
+		upperBound := strconv.Itoa(v.UpperBound)
+		if openMetrics {
+			upperBound += ".0"
+		}
+		fmt.Fprintf(&b, "log_entry_size_bytes_bucket{le=\"%s\"} %d\n", upperBound, v.Count)
+	}
+	fmt.Fprintf(&b, "log_entry_size_bytes_bucket{le=\"+Inf\"} %d\n", s.Sizes.Count)
+	fmt.Fprintf(&b, "log_entry_size_bytes_sum %d\n", s.Sizes.Sum)
+	fmt.Fprintf(&b, "log_entry_size_bytes_count %d\n", s.Sizes.Count)
+	dropped := "log_dropped_total"
+	if openMetrics {
+		dropped = "log_dropped"
+	}
+	fmt.Fprintf(&b, "# HELP %s Log writes dropped by async writers due to their overflow policy.\n", dropped)
+	fmt.Fprintf(&b, "# TYPE %s counter\n", dropped)
+	fmt.Fprintf(&b, "log_dropped_total %d\n", s.Dropped)
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return go_errors.Wrap(err, "Failed writing metrics")
+	}
+	return nil
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
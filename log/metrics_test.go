@@ -0,0 +1,184 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	go_context "github.com/caigwatkin/go/context"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(3)
+	var buf bytes.Buffer
+	logClient := NewClient(context.Background(), Config{
+		Sinks: []Sink{
+			NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+		},
+		Metrics: metrics,
+	})
+	ctx := go_context.WithCorrelationId(context.Background(), "first")
+	logClient.Error(ctx, "Failed")
+	logClient.Error(go_context.WithCorrelationId(context.Background(), "second"), "Failed")
+	logClient.Error(context.Background(), "Failed")
+	logClient.Named("db").Info(ctx, "Connected")
+	logClient.Info(ctx, "Beyond max messages")
+	logClient.Debug(ctx, "Below level")
+
+	result := metrics.Snapshot()
+	for i := range result.Counters {
+		result.Counters[i].Latest = time.Time{}
+	}
+	expected := []MetricsCounter{
+		{
+			Severity: SeverityInfo,
+			Message:  "Initialized",
+			Count:    1,
+		},
+		{
+			Severity:      SeverityInfo,
+			Message:       MetricsOtherMessages,
+			Count:         1,
+			CorrelationId: "first",
+		},
+		{
+			Severity:      SeverityInfo,
+			Logger:        "db",
+			Message:       "Connected",
+			Count:         1,
+			CorrelationId: "first",
+		},
+		{
+			Severity:      SeverityError,
+			Message:       "Failed",
+			Count:         3,
+			CorrelationId: "second",
+		},
+	}
+
+	if len(result.Counters) != len(expected) {
+		t.Fatal(go_testing.Errorf(go_testing.Error{
+			Unexpected: "len(result.Counters)",
+			Expected:   len(expected),
+			Result:     result.Counters,
+		}))
+	}
+	for i, v := range expected {
+		if result.Counters[i] != v {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result.Counters",
+				At:         i,
+				Expected:   v,
+				Result:     result.Counters[i],
+			}))
+		}
+	}
+	if s := result.BySeverity(); s[SeverityError] != 3 || s[SeverityInfo] != 3 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result.BySeverity()",
+			Expected:   map[Severity]uint64{SeverityInfo: 3, SeverityError: 3},
+			Result:     s,
+		}))
+	}
+	if result.Sizes.Count != 6 {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result.Sizes.Count",
+			Expected:   6,
+			Result:     result.Sizes.Count,
+		}))
+	}
+	if expected := uint64(buf.Len() - strings.Count(buf.String(), "\n")); result.Sizes.Sum != expected {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result.Sizes.Sum",
+			Expected:   expected,
+			Result:     result.Sizes.Sum,
+		}))
+	}
+}
+
+func TestMetricsWrite(t *testing.T) {
+	metrics := NewMetrics(0)
+	metrics.record(Entry{
+		Time:          time.Unix(1630497600, 0),
+		Severity:      SeverityError,
+		Message:       `Failed "quoted"`,
+		CorrelationId: "correlationId",
+	}, 100)
+	metrics.record(Entry{
+		Severity: SeverityInfo,
+		Message:  "Long",
+	}, 250)
+	metrics.record(Entry{
+		Severity: SeverityInfo,
+		Message:  "Not encoded",
+	}, 0)
+	var data = []struct {
+		desc     string
+		input    func(b *bytes.Buffer) error
+		expected []string
+	}{
+		{
+			desc:  "prometheus",
+			input: func(b *bytes.Buffer) error { return metrics.WritePrometheus(b) },
+			expected: []string{
+				"# TYPE log_entries_total counter\n",
+				`log_entries_total{severity="ERROR",logger="",message="Failed \"quoted\""} 1` + "\n",
+				"log_entry_size_bytes_bucket{le=\"128\"} 1\n",
+				"log_entry_size_bytes_bucket{le=\"256\"} 2\n",
+				"log_entry_size_bytes_bucket{le=\"+Inf\"} 2\n",
+				"log_entry_size_bytes_count 2\n",
+				"# TYPE log_dropped_total counter\n",
+				"log_dropped_total 0\n",
+			},
+		},
+
+		{
+			desc:  "openmetrics",
+			input: func(b *bytes.Buffer) error { return metrics.WriteOpenMetrics(b) },
+			expected: []string{
+				"# TYPE log_entries counter\n",
+				`log_entries_total{severity="ERROR",logger="",message="Failed \"quoted\""} 1 # {correlationId="correlationId"} 1 1630497600.000` + "\n",
+				"log_entry_size_bytes_bucket{le=\"128.0\"} 1\n",
+				"# TYPE log_dropped counter\n",
+				"# EOF\n",
+			},
+		},
+	}
+
+	for i, d := range data {
+		var b bytes.Buffer
+		if err := d.input(&b); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range d.expected {
+			if !strings.Contains(b.String(), v) {
+				t.Error(go_testing.Errorf(go_testing.Error{
+					Unexpected: "result",
+					Desc:       d.desc,
+					At:         i,
+					Expected:   v,
+					Result:     b.String(),
+				}))
+			}
+		}
+	}
+}
@@ -23,3 +23,25 @@ func (c client) Warn(_ context.Context, _ string, _ ...log.Field) {}
 func (c client) Error(_ context.Context, _ string, _ ...log.Field) {}
 
 func (c client) Fatal(_ context.Context, _ string, _ ...log.Field) {}
+
+func (c client) Flush(_ context.Context) error {
+	return nil
+}
+
+func (c client) Close(_ context.Context) error {
+	return nil
+}
+
+func (c client) RegisterShutdownHook(_ func(ctx context.Context)) {}
+
+func (c client) With(_ ...log.Field) log.Client {
+	return c
+}
+
+func (c client) Named(_ string) log.Client {
+	return c
+}
+
+func (c client) WithCallerSkip(_ int) log.Client {
+	return c
+}
@@ -0,0 +1,189 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	go_context "github.com/caigwatkin/go/context"
+	"github.com/caigwatkin/go/log"
+)
+
+// Recorder is a log client which records entries for assertions in tests
+//
+// It is safe for concurrent use, and children from With and Named record to their parent
+type Recorder struct {
+	callerSkip int
+	fields     []log.Field
+	name       string
+	recording  *recording
+	t          testing.TB
+}
+
+type recording struct {
+	mu      sync.Mutex
+	entries []log.Entry
+	hooks   []func(ctx context.Context)
+}
+
+// NewRecorder which dumps recorded entries to the test log if the test fails
+func NewRecorder(t testing.TB) *Recorder {
+	r := &Recorder{
+		recording: &recording{},
+		t:         t,
+	}
+	t.Cleanup(func() {
+		if t.Failed() {
+			r.dump()
+		}
+	})
+	return r
+}
+
+func (r *Recorder) Debug(ctx context.Context, message string, fields ...log.Field) {
+	r.record(ctx, log.SeverityDebug, message, fields)
+}
+
+func (r *Recorder) Info(ctx context.Context, message string, fields ...log.Field) {
+	r.record(ctx, log.SeverityInfo, message, fields)
+}
+
+func (r *Recorder) Notice(ctx context.Context, message string, fields ...log.Field) {
+	r.record(ctx, log.SeverityNotice, message, fields)
+}
+
+func (r *Recorder) Warn(ctx context.Context, message string, fields ...log.Field) {
+	r.record(ctx, log.SeverityWarn, message, fields)
+}
+
+func (r *Recorder) Error(ctx context.Context, message string, fields ...log.Field) {
+	r.record(ctx, log.SeverityError, message, fields)
+}
+
+// Fatal records the entry, and returns without panicking or exiting
+func (r *Recorder) Fatal(ctx context.Context, message string, fields ...log.Field) {
+	r.record(ctx, log.SeverityFatal, message, fields)
+}
+
+func (r *Recorder) Flush(_ context.Context) error {
+	return nil
+}
+
+func (r *Recorder) Close(_ context.Context) error {
+	return nil
+}
+
+// RegisterShutdownHook records the hook, see ShutdownHooks
+func (r *Recorder) RegisterShutdownHook(hook func(ctx context.Context)) {
+	r.recording.mu.Lock()
+	defer r.recording.mu.Unlock()
+	r.recording.hooks = append(r.recording.hooks, hook)
+}
+
+func (r *Recorder) With(fields ...log.Field) log.Client {
+	c := *r
+	c.fields = append(append([]log.Field{}, r.fields...), fields...)
+	return &c
+}
+
+func (r *Recorder) Named(name string) log.Client {
+	c := *r
+	if r.name != "" {
+		name = r.name + "." + name
+	}
+	c.name = name
+	return &c
+}
+
+func (r *Recorder) WithCallerSkip(skip int) log.Client {
+	c := *r
+	c.callerSkip += skip
+	return &c
+}
+
+// Entries recorded of at least the severity, in order
+func (r *Recorder) Entries(severity log.Severity) []log.Entry {
+	r.recording.mu.Lock()
+	defer r.recording.mu.Unlock()
+	var entries []log.Entry
+	for _, v := range r.recording.entries {
+		if v.Severity >= severity {
+			entries = append(entries, v)
+		}
+	}
+	return entries
+}
+
+// FindMessage returns the first entry recorded with the message
+func (r *Recorder) FindMessage(message string) (log.Entry, bool) {
+	for _, v := range r.Entries(log.SeverityDebug) {
+		if v.Message == message {
+			return v, true
+		}
+	}
+	return log.Entry{}, false
+}
+
+// RequireField of the first entry recorded with the message, failing the test immediately if there is none
+func (r *Recorder) RequireField(message, key string) interface{} {
+	r.t.Helper()
+	e, ok := r.FindMessage(message)
+	if !ok {
+		r.t.Fatalf("No entry with message %q", message)
+	}
+	for _, v := range e.Fields {
+		if v.Key() == key {
+			return v.Value()
+		}
+	}
+	r.t.Fatalf("No field %q in entry with message %q", key, message)
+	return nil
+}
+
+// ShutdownHooks registered, in order of registration
+func (r *Recorder) ShutdownHooks() []func(ctx context.Context) {
+	r.recording.mu.Lock()
+	defer r.recording.mu.Unlock()
+	return append([]func(ctx context.Context){}, r.recording.hooks...)
+}
+
+// Reset entries recorded
+func (r *Recorder) Reset() {
+	r.recording.mu.Lock()
+	defer r.recording.mu.Unlock()
+	r.recording.entries = nil
+}
+
+func (r *Recorder) record(ctx context.Context, severity log.Severity, message string, fields []log.Field) {
+	file, line, function := log.Caller(2 + r.callerSkip)
+	e := log.Entry{
+		Time:          time.Now(),
+		Severity:      severity,
+		Message:       message,
+		CorrelationId: go_context.CorrelationId(ctx),
+		TraceId:       go_context.TraceId(ctx),
+		File:          file,
+		Line:          line,
+		Function:      function,
+		Logger:        r.name,
+		Fields:        append(append([]log.Field{}, r.fields...), fields...),
+	}
+	r.recording.mu.Lock()
+	defer r.recording.mu.Unlock()
+	r.recording.entries = append(r.recording.entries, e)
+}
+
+func (r *Recorder) dump() {
+	entries := r.Entries(log.SeverityDebug)
+	r.t.Logf("Recorded %d log entries", len(entries))
+	for _, e := range entries {
+		fields := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			fields[i] = fmt.Sprintf("%s=%v", f.Key(), f.Value())
+		}
+		r.t.Logf("%s [%s] [%s] [%s] [%s:%d] {%s}", e.Severity, e.Logger, e.Message, e.CorrelationId, e.Function, e.Line, strings.Join(fields, ", "))
+	}
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// Redacted replaces masked values
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedKeys are masked when no redaction policy is configured
+var DefaultRedactedKeys = []string{
+	"Authorization",
+	"Cookie",
+	"DatabaseUrl",
+	"Proxy-Authorization",
+	"Set-Cookie",
+	"X-Api-Key",
+	"password",
+}
+
+// Redaction policy of fields of entries output by the client, applied before they are encoded
+//
+// Keys are matched without case against field names and keys within values, e.g. header names of an http.Header
+type Redaction struct {
+	Keys      []string         // Values of which are masked
+	Scrubbers []*regexp.Regexp // Matches of which are masked within strings, including within values and errors
+	MaxBytes  int              // Of bytes fields, 0 is unlimited
+	MaxString int              // Of strings, including within values and errors, 0 is unlimited
+	MaxAny    int              // Of the JSON of values, 0 is unlimited
+}
+
+type redactor struct {
+	config Redaction
+	keys   map[string]bool // Lower case
+}
+
+func newRedactor(config Redaction) *redactor {
+	r := &redactor{
+		config: config,
+		keys:   make(map[string]bool, len(config.Keys)),
+	}
+	for _, v := range config.Keys {
+		r.keys[strings.ToLower(v)] = true
+	}
+	return r
+}
+
+// redact fields, copying them only if one is changed
+//
+// Values which are costly to encode, e.g. of FmtAny and FmtError, are replaced with their encoding, so encoders do not
+// encode them again
+func (r *redactor) redact(fields []Field) []Field {
+	if !r.active() {
+		return fields
+	}
+	redacted, _ := r.fields(fields)
+	return redacted
+}
+
+// active if the policy may change any field
+func (r *redactor) active() bool {
+	return len(r.keys) > 0 || len(r.config.Scrubbers) > 0 || r.config.MaxBytes > 0 || r.config.MaxString > 0 || r.config.MaxAny > 0
+}
+
+func (r *redactor) fields(fields []Field) ([]Field, bool) {
+	var redacted []Field
+	for i, f := range fields {
+		v, changed := r.field(f)
+		if changed && redacted == nil {
+			redacted = make([]Field, i, len(fields))
+			copy(redacted, fields[:i])
+		}
+		if redacted != nil {
+			redacted = append(redacted, v)
+		}
+	}
+	if redacted == nil {
+		return fields, false
+	}
+	return redacted, true
+}
+
+func (r *redactor) field(f Field) (Field, bool) {
+	if f.kind != kindSecret && r.keys[strings.ToLower(f.key)] {
+		return FmtSecret(nil, f.key), true
+	}
+	switch f.kind {
+	case kindAny:
+		if v, ok := r.any(f.iface); ok {
+			f.iface = v
+			return f, true
+		}
+	case kindAnys:
+		values := f.iface.([]interface{})
+		var redacted []interface{}
+		for i, v := range values {
+			w, ok := r.any(v)
+			if ok && redacted == nil {
+				redacted = make([]interface{}, len(values))
+				copy(redacted, values)
+			}
+			if ok {
+				redacted[i] = w
+			}
+		}
+		if redacted != nil {
+			f.iface = redacted
+			return f, true
+		}
+	case kindBytes:
+		value := f.iface.([]byte)
+		s := truncate(r.scrub(string(value)), r.config.MaxBytes)
+		if s != string(value) {
+			f.iface = []byte(s)
+			return f, true
+		}
+	case kindError:
+		if f.iface == nil {
+			break
+		}
+		f.iface, _ = r.error(newErrorInfo(f.iface.(error)))
+		return f, true
+	case kindGroup:
+		if fields, ok := r.fields(f.iface.([]Field)); ok {
+			f.iface = fields
+			return f, true
+		}
+	case kindMap:
+		values := f.iface.(map[string]interface{})
+		var redacted map[string]interface{}
+		for k, v := range values {
+			var w interface{} = Redacted
+			ok := r.keys[strings.ToLower(k)]
+			if !ok {
+				w, ok = r.any(v)
+			}
+			if ok && redacted == nil {
+				redacted = make(map[string]interface{}, len(values))
+				for k, v := range values {
+					redacted[k] = v
+				}
+			}
+			if ok {
+				redacted[k] = w
+			}
+		}
+		if redacted != nil {
+			f.iface = redacted
+			return f, true
+		}
+	case kindObject:
+		if f.iface == nil {
+			break
+		}
+		fields, _ := r.fields(f.iface.(LogMarshaler).MarshalLog())
+		return FmtGroup(f.key, fields...), true
+	case kindRawJSON:
+		v, ok := r.any(f.iface)
+		if !ok {
+			break
+		}
+		switch w := v.(redactedAny).value.(type) {
+		case json.RawMessage:
+			f.iface = w
+		case string:
+			return FmtString(w, f.key), true // Truncated, so no longer valid JSON
+		}
+		return f, true
+	case kindString:
+		if s := r.string(f.str); s != f.str {
+			f.str = s
+			return f, true
+		}
+	case kindStringer:
+		if f.iface == nil {
+			break
+		}
+		value := f.iface.(fmt.Stringer).String()
+		if s := r.string(value); s != value {
+			return FmtString(s, f.key), true
+		}
+	case kindStrings:
+		values := f.iface.([]string)
+		var redacted []string
+		for i, v := range values {
+			s := r.string(v)
+			if s != v && redacted == nil {
+				redacted = make([]string, len(values))
+				copy(redacted, values)
+			}
+			if redacted != nil {
+				redacted[i] = s
+			}
+		}
+		if redacted != nil {
+			f.iface = redacted
+			return f, true
+		}
+	}
+	return f, false
+}
+
+// error info redacted, if changed
+func (r *redactor) error(info *errorInfo) (*errorInfo, bool) {
+	redacted := *info
+	redacted.message = r.string(info.message)
+	redacted.trace = r.string(info.trace)
+	changed := redacted.message != info.message || redacted.trace != info.trace
+	redacted.causes = make([]errorCause, len(info.causes))
+	for i, v := range info.causes {
+		redacted.causes[i] = errorCause{
+			message: r.string(v.message),
+			typ:     v.typ,
+		}
+		changed = changed || redacted.causes[i].message != v.message
+	}
+	redacted.items = make([]go_errors.Item, len(info.items))
+	for i, v := range info.items {
+		redacted.items[i] = go_errors.Item{
+			Field:   v.Field,
+			Message: r.string(v.Message),
+		}
+		changed = changed || redacted.items[i].Message != v.Message
+	}
+	return &redacted, changed
+}
+
+// any value as JSON, redacted and truncated, unless it is not marshallable
+func (r *redactor) any(value interface{}) (interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	blob, err := json.Marshal(logValue(value))
+	if err != nil {
+		return nil, false
+	}
+	redacted := blob
+	if r.config.MaxString > 0 || r.mayMatch(blob) {
+		d := json.NewDecoder(bytes.NewReader(blob))
+		d.UseNumber()
+		var generic interface{}
+		if err := d.Decode(&generic); err != nil {
+			return nil, false
+		}
+		if redacted, err = json.Marshal(r.generic(generic)); err != nil {
+			return nil, false
+		}
+	}
+	a := redactedAny{
+		typ:   reflect.TypeOf(value).String(),
+		value: json.RawMessage(redacted),
+	}
+	if r.config.MaxAny > 0 && len(redacted) > r.config.MaxAny {
+		a.value = truncate(string(redacted), r.config.MaxAny)
+	}
+	return a, true
+}
+
+// mayMatch if the JSON has a key or a match of a scrubber, cheaply checked before decoding it
+func (r *redactor) mayMatch(blob []byte) bool {
+	if len(r.keys) > 0 {
+		lower := bytes.ToLower(blob)
+		for k := range r.keys {
+			if bytes.Contains(lower, []byte(`"`+k+`"`)) {
+				return true
+			}
+		}
+	}
+	for _, v := range r.config.Scrubbers {
+		if v.Match(blob) {
+			return true
+		}
+	}
+	return false
+}
+
+// generic value decoded from JSON, redacted
+func (r *redactor) generic(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, w := range v {
+			if r.keys[strings.ToLower(k)] {
+				v[k] = Redacted
+			} else {
+				v[k] = r.generic(w)
+			}
+		}
+	case []interface{}:
+		for i, w := range v {
+			v[i] = r.generic(w)
+		}
+	case string:
+		return r.string(v)
+	}
+	return value
+}
+
+func (r *redactor) string(s string) string {
+	return truncate(r.scrub(s), r.config.MaxString)
+}
+
+func (r *redactor) scrub(s string) string {
+	for _, v := range r.config.Scrubbers {
+		s = v.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// truncate to at most max bytes, without splitting a rune, followed by a marker of the number of bytes truncated
+func truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s…[truncated %d bytes]", s[:n], len(s)-n)
+}
+
+// redactedAny is encoded with the type of the value it replaces
+type redactedAny struct {
+	typ   string
+	value interface{}
+}
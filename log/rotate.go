@@ -0,0 +1,178 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+type RotatingFileConfig struct {
+	Path       string        // File written to, rotated files are kept alongside it with a timestamp suffix
+	MaxSize    int64         // Bytes after which the file is rotated, 0 for no limit
+	MaxAge     time.Duration // Age after which the file is rotated, 0 for no limit
+	MaxBackups int           // Rotated files kept, oldest removed first, 0 to keep all
+}
+
+// RotatingFile is a writer to a file which is rotated once it exceeds a size or age
+type RotatingFile struct {
+	config   RotatingFileConfig
+	file     *os.File
+	mu       sync.Mutex
+	now      func() time.Time
+	openedAt time.Time
+	size     int64
+}
+
+// NewRotatingFile for writing to, e.g. with NewWriterSink
+//
+// An existing file is appended to
+func NewRotatingFile(config RotatingFileConfig) (*RotatingFile, error) {
+	if config.Path == "" {
+		return nil, go_errors.New("Missing path")
+	}
+	r := &RotatingFile{
+		config: config,
+		now:    time.Now,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write to the file, rotating first if writing would exceed the max size or the file has exceeded the max age
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, go_errors.New("Rotating file is closed")
+	}
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, go_errors.Wrap(err, "Failed writing to file")
+	}
+	return n, nil
+}
+
+// Close the file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return go_errors.Wrap(err, "Failed closing file")
+	}
+	return nil
+}
+
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.config.MaxSize > 0 && r.size+n > r.config.MaxSize {
+		return true
+	}
+	return r.config.MaxAge > 0 && r.now().Sub(r.openedAt) >= r.config.MaxAge
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.config.Path), 0755); err != nil {
+		return go_errors.Wrap(err, "Failed making directory")
+	}
+	f, err := os.OpenFile(r.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed opening file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return go_errors.Wrap(err, "Failed getting file info")
+	}
+	r.file = f
+	r.size = info.Size()
+	r.openedAt = r.now()
+	if r.size > 0 {
+		r.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return go_errors.Wrap(err, "Failed closing file")
+	}
+	r.file = nil
+	backup := fmt.Sprintf("%s.%s", r.config.Path, r.now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(r.config.Path, backup); err != nil {
+		return go_errors.Wrap(err, "Failed renaming file")
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.removeBackups()
+}
+
+// removeBackups in excess of the max, which sort oldest first by their timestamp suffix
+func (r *RotatingFile) removeBackups() error {
+	if r.config.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > r.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return go_errors.Wrap(err, "Failed removing backup")
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func (r *RotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(r.config.Path + ".*")
+	if err != nil {
+		return nil, go_errors.Wrap(err, "Failed listing backups")
+	}
+	var backups []string
+	for _, v := range matches {
+		if _, err := time.Parse("20060102T150405.000000000", strings.TrimPrefix(v, r.config.Path+".")); err == nil {
+			backups = append(backups, v)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	type expected struct {
+		Backups int
+		Current string
+	}
+	var data = []struct {
+		desc     string
+		input    RotatingFileConfig
+		writes   []string
+		advance  time.Duration
+		expected expected
+	}{
+		{
+			desc:   "no limits",
+			input:  RotatingFileConfig{},
+			writes: []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			expected: expected{
+				Backups: 0,
+				Current: "aaaa\nbbbb\ncccc\n",
+			},
+		},
+
+		{
+			desc: "max size",
+			input: RotatingFileConfig{
+				MaxSize: 10,
+			},
+			writes: []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			expected: expected{
+				Backups: 1,
+				Current: "cccc\n",
+			},
+		},
+
+		{
+			desc: "max size with max backups",
+			input: RotatingFileConfig{
+				MaxSize:    5,
+				MaxBackups: 1,
+			},
+			writes: []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			expected: expected{
+				Backups: 1,
+				Current: "cccc\n",
+			},
+		},
+
+		{
+			desc: "max age",
+			input: RotatingFileConfig{
+				MaxAge: time.Hour,
+			},
+			writes:  []string{"aaaa\n", "bbbb\n"},
+			advance: time.Hour,
+			expected: expected{
+				Backups: 1,
+				Current: "bbbb\n",
+			},
+		},
+	}
+
+	for i, d := range data {
+		d.input.Path = filepath.Join(t.TempDir(), "log", "app.log")
+		r, err := NewRotatingFile(d.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+		r.now = func() time.Time {
+			return now
+		}
+		r.openedAt = now
+		for _, w := range d.writes {
+			if _, err := r.Write([]byte(w)); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(d.advance + time.Millisecond)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		backups, err := r.backups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		current, err := os.ReadFile(d.input.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := expected{
+			Backups: len(backups),
+			Current: string(current),
+		}
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// SamplingConfig of entries which would otherwise be output, for suppressing repetitive messages under load
+//
+// Entries are sampled by message first, then rate limited by severity. Error and fatal entries are neither unless
+// IncludeErrors is set
+type SamplingConfig struct {
+	Interval        time.Duration           // Over which entries are counted for sampling, defaults to 1s
+	Default         *SamplingRule           // For messages without a rule, nil does not sample them
+	Messages        map[string]SamplingRule // Keyed by message
+	RateLimits      map[Severity]RateLimit  // Token bucket per severity
+	IncludeErrors   bool                    // Samples and rate limits error and fatal entries
+	SummaryInterval time.Duration           // Between summary entries of the number suppressed, defaults to 1m
+}
+
+// SamplingRule outputs the first entries with a message each interval, then 1 in every Thereafter
+type SamplingRule struct {
+	First      int
+	Thereafter int // 0 suppresses the rest of the interval
+}
+
+// RateLimit of a token bucket, which starts full
+type RateLimit struct {
+	Rate  float64 // Entries per second
+	Burst int     // Entries output at once, defaults to 1
+}
+
+type sampler struct {
+	config SamplingConfig
+	now    func() time.Time
+
+	mu          sync.Mutex
+	counts      map[string]int // Per message in the current interval
+	intervalEnd time.Time
+	buckets     map[Severity]*tokenBucket
+	suppressed  map[string]int // Per message since the last summary
+
+	stop     chan struct{}
+	finished chan struct{}
+	once     sync.Once
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newSampler(config SamplingConfig) *sampler {
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.SummaryInterval <= 0 {
+		config.SummaryInterval = time.Minute
+	}
+	s := &sampler{
+		config:     config,
+		now:        time.Now,
+		counts:     make(map[string]int),
+		buckets:    make(map[Severity]*tokenBucket),
+		suppressed: make(map[string]int),
+		stop:       make(chan struct{}),
+		finished:   make(chan struct{}),
+	}
+	for k, v := range config.RateLimits {
+		if v.Burst < 1 {
+			v.Burst = 1
+		}
+		s.buckets[k] = &tokenBucket{
+			limit:  v,
+			tokens: float64(v.Burst),
+		}
+	}
+	return s
+}
+
+// allow the entry to be output, counting it as suppressed otherwise
+func (s *sampler) allow(severity Severity, message string) bool {
+	if severity >= SeverityError && !s.config.IncludeErrors {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !s.sample(now, message) || !s.limit(now, severity) {
+		s.suppressed[message]++
+		return false
+	}
+	return true
+}
+
+// sample by message, with the lock held
+func (s *sampler) sample(now time.Time, message string) bool {
+	rule, ok := s.config.Messages[message]
+	if !ok {
+		if s.config.Default == nil {
+			return true
+		}
+		rule = *s.config.Default
+	}
+	if !now.Before(s.intervalEnd) {
+		s.counts = make(map[string]int)
+		s.intervalEnd = now.Add(s.config.Interval)
+	}
+	s.counts[message]++
+	n := s.counts[message] - rule.First
+	if n <= 0 {
+		return true
+	}
+	return rule.Thereafter > 0 && n%rule.Thereafter == 0
+}
+
+// limit by severity, with the lock held
+func (s *sampler) limit(now time.Time, severity Severity) bool {
+	b, ok := s.buckets[severity]
+	if !ok {
+		return true
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// takeSuppressed since the last call, keyed by message
+func (s *sampler) takeSuppressed() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.suppressed) == 0 {
+		return nil
+	}
+	suppressed := s.suppressed
+	s.suppressed = make(map[string]int)
+	return suppressed
+}
+
+// run summarising suppressed entries each summary interval until closed
+func (s *sampler) run(summarise func(suppressed map[string]int)) {
+	defer close(s.finished)
+	ticker := time.NewTicker(s.config.SummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		if suppressed := s.takeSuppressed(); suppressed != nil {
+			summarise(suppressed)
+		}
+	}
+}
+
+// close stops summarising, waiting for a summary in progress
+func (s *sampler) close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.finished
+}
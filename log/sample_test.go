@@ -0,0 +1,240 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestSamplerAllow(t *testing.T) {
+	type input struct {
+		Severity Severity
+		Message  string
+		Count    int
+	}
+	type expected struct {
+		Allowed    int
+		Suppressed int
+	}
+	var data = []struct {
+		desc     string
+		input    input
+		expected expected
+	}{
+		{
+			desc: "message rule, first then 1 in thereafter",
+			input: input{
+				Severity: SeverityInfo,
+				Message:  "HTTP Response",
+				Count:    10,
+			},
+			expected: expected{
+				Allowed:    2 + 2,
+				Suppressed: 6,
+			},
+		},
+
+		{
+			desc: "default rule suppresses rest of interval",
+			input: input{
+				Severity: SeverityInfo,
+				Message:  "Reading",
+				Count:    10,
+			},
+			expected: expected{
+				Allowed:    5,
+				Suppressed: 5,
+			},
+		},
+
+		{
+			desc: "rate limited severity",
+			input: input{
+				Severity: SeverityWarn,
+				Message:  "Retrying",
+				Count:    10,
+			},
+			expected: expected{
+				Allowed:    3,
+				Suppressed: 7,
+			},
+		},
+
+		{
+			desc: "errors not sampled",
+			input: input{
+				Severity: SeverityError,
+				Message:  "HTTP Response",
+				Count:    10,
+			},
+			expected: expected{
+				Allowed:    10,
+				Suppressed: 0,
+			},
+		},
+	}
+
+	for i, d := range data {
+		s := newSampler(SamplingConfig{
+			Default: &SamplingRule{
+				First: 5,
+			},
+			Messages: map[string]SamplingRule{
+				"HTTP Response": {
+					First:      2,
+					Thereafter: 3,
+				},
+				"Retrying": {
+					First: 100,
+				},
+			},
+			RateLimits: map[Severity]RateLimit{
+				SeverityWarn: {
+					Rate:  1,
+					Burst: 3,
+				},
+			},
+		})
+		now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+		s.now = func() time.Time {
+			return now
+		}
+		var result expected
+		for j := 0; j < d.input.Count; j++ {
+			if s.allow(d.input.Severity, d.input.Message) {
+				result.Allowed++
+			}
+		}
+		result.Suppressed = s.takeSuppressed()[d.input.Message]
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestSamplerRefill(t *testing.T) {
+	s := newSampler(SamplingConfig{
+		RateLimits: map[Severity]RateLimit{
+			SeverityInfo: {
+				Rate: 2,
+			},
+		},
+	})
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		return now
+	}
+
+	var data = []struct {
+		desc     string
+		input    time.Duration
+		expected bool
+	}{
+		{
+			desc:     "full",
+			input:    0,
+			expected: true,
+		},
+
+		{
+			desc:     "half refilled",
+			input:    250 * time.Millisecond,
+			expected: false,
+		},
+
+		{
+			desc:     "refilled",
+			input:    500 * time.Millisecond,
+			expected: true,
+		},
+
+		{
+			desc:     "empty",
+			input:    600 * time.Millisecond,
+			expected: false,
+		},
+	}
+
+	start := now
+	for i, d := range data {
+		now = start.Add(d.input)
+		result := s.allow(SeverityInfo, "message")
+
+		if result != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+	}
+}
+
+func TestClientSamplingSummary(t *testing.T) {
+	var buf bytes.Buffer
+	logClient := NewClient(context.Background(), Config{
+		Sinks: []Sink{
+			NewWriterSink(&buf, SeverityInfo, NewJSONEncoder("", nil)),
+		},
+		Sampling: &SamplingConfig{
+			Messages: map[string]SamplingRule{
+				"HTTP Response": {
+					First: 1,
+				},
+			},
+		},
+	})
+	for i := 0; i < 5; i++ {
+		logClient.Info(context.Background(), "HTTP Response")
+	}
+	logClient.Error(context.Background(), "HTTP Response")
+	if err := logClient.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	result := struct {
+		Responses int
+		Summary   bool
+	}{
+		Responses: strings.Count(buf.String(), `"message":"HTTP Response"`),
+		Summary:   strings.Contains(buf.String(), `"total":4,"suppressed":{"type":"map[string]int","value":{"HTTP Response":4}}`),
+	}
+	if result.Responses != 2 || !result.Summary {
+		t.Error(go_testing.Errorf(go_testing.Error{
+			Unexpected: "result",
+			Expected:   "2 responses output, including the error, and a summary of 4 suppressed",
+			Result:     buf.String(),
+		}))
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+// Sink to which entries are written
+//
+// Write is only called with entries of a severity for which the sink is enabled, and may be called concurrently
+type Sink interface {
+	Enabled(severity Severity) bool
+	Write(e Entry) error
+}
+
+// NewWriterSink writing entries of at least the given severity to the writer
+//
+// Entries are encoded with the encoder, or the verbose console encoder if nil, coloured if ColorEnabled for the writer,
+// and written one per line
+func NewWriterSink(w io.Writer, level Severity, encoder Encoder) Sink {
+	if encoder == nil {
+		encoder = NewConsoleEncoderFor(w, ConsoleConfig{
+			Verbose: true,
+		})
+	}
+	return &writerSink{
+		encoder: encoder,
+		level:   level,
+		w:       w,
+	}
+}
+
+type writerSink struct {
+	encoder Encoder
+	level   Severity
+	mu      sync.Mutex
+	w       io.Writer
+}
+
+func (s *writerSink) Enabled(severity Severity) bool {
+	return severity >= s.level
+}
+
+func (s *writerSink) Write(e Entry) error {
+	line := []byte(e.encoded(s.encoder.Encode(e)) + "\n")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(line); err != nil {
+		return go_errors.Wrap(err, "Failed writing to writer")
+	}
+	return nil
+}
+
+// Flush the writer if it is a flusher
+func (s *writerSink) Flush(ctx context.Context) error {
+	if f, ok := s.w.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// NewFanOutSink writing entries to each of the sinks which is enabled for their severity
+//
+// All enabled sinks are written to, even if some fail
+func NewFanOutSink(sinks ...Sink) Sink {
+	return fanOutSink(sinks)
+}
+
+type fanOutSink []Sink
+
+func (s fanOutSink) Enabled(severity Severity) bool {
+	for _, v := range s {
+		if v.Enabled(severity) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s fanOutSink) Write(e Entry) error {
+	var failed []error
+	for _, v := range s {
+		if !v.Enabled(e.Severity) {
+			continue
+		}
+		if err := v.Write(e); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return joinErrors("writing to", failed)
+}
+
+// Flush each of the sinks which is a flusher
+func (s fanOutSink) Flush(ctx context.Context) error {
+	var failed []error
+	for _, v := range s {
+		if err := flush(ctx, v); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return joinErrors("flushing", failed)
+}
+
+func flush(ctx context.Context, sink Sink) error {
+	if f, ok := sink.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+func joinErrors(action string, failed []error) error {
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return go_errors.Errorf("Failed %s %d sinks, first error: %s", action, len(failed), failed[0])
+	}
+}
+
+// stdSink writes entries below warn to stdout, and the rest to stderr, each with its own encoder
+type stdSink struct {
+	stdout Sink
+	stderr Sink
+}
+
+func newStdSink(stdout, stderr io.Writer, stdoutEncoder, stderrEncoder Encoder) Sink {
+	return stdSink{
+		stdout: NewWriterSink(stdout, SeverityDebug, stdoutEncoder),
+		stderr: NewWriterSink(stderr, SeverityDebug, stderrEncoder),
+	}
+}
+
+func (s stdSink) Enabled(severity Severity) bool {
+	return true
+}
+
+func (s stdSink) Write(e Entry) error {
+	if e.Severity < SeverityWarn {
+		return s.stdout.Write(e)
+	}
+	return s.stderr.Write(e)
+}
+
+func (s stdSink) Flush(ctx context.Context) error {
+	return NewFanOutSink(s.stdout, s.stderr).(Flusher).Flush(ctx)
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	go_environment "github.com/caigwatkin/go/environment"
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("failed")
+}
+
+func TestSinks(t *testing.T) {
+	var debug, warn bytes.Buffer
+	type expected struct {
+		Debug []string
+		Warn  []string
+	}
+	var data = []struct {
+		desc     string
+		input    Severity
+		expected expected
+	}{
+		{
+			desc:  "debug",
+			input: SeverityDebug,
+			expected: expected{
+				Debug: []string{"DEBUG"},
+			},
+		},
+
+		{
+			desc:  "notice",
+			input: SeverityNotice,
+			expected: expected{
+				Debug: []string{"NOTICE"},
+			},
+		},
+
+		{
+			desc:  "warn",
+			input: SeverityWarn,
+			expected: expected{
+				Debug: []string{"WARN"},
+				Warn:  []string{"WARNING"},
+			},
+		},
+	}
+
+	logClient := NewClient(context.Background(), Config{
+		Env: go_environment.Environment{
+			Debug: true,
+			Stage: go_environment.StageLocal,
+		},
+		Sinks: []Sink{
+			NewWriterSink(&debug, SeverityDebug, NewConsoleEncoder()),
+			NewWriterSink(&warn, SeverityWarn, NewJSONEncoder("", nil)),
+		},
+	})
+
+	for i, d := range data {
+		debug.Reset()
+		warn.Reset()
+		switch d.input {
+		case SeverityDebug:
+			logClient.Debug(context.Background(), "message", FmtString("value", "name"))
+		case SeverityNotice:
+			logClient.Notice(context.Background(), "message", FmtString("value", "name"))
+		case SeverityWarn:
+			logClient.Warn(context.Background(), "message", FmtString("value", "name"))
+		}
+
+		for _, v := range []struct {
+			name     string
+			result   string
+			expected []string
+		}{
+			{"debug", debug.String(), d.expected.Debug},
+			{"warn", warn.String(), d.expected.Warn},
+		} {
+			if (len(v.expected) == 0) != (v.result == "") {
+				t.Error(go_testing.Errorf(go_testing.Error{
+					Unexpected: v.name,
+					Desc:       d.desc,
+					At:         i,
+					Input:      d.input,
+					Expected:   v.expected,
+					Result:     v.result,
+				}))
+			}
+			for _, e := range v.expected {
+				if !strings.Contains(v.result, e) || !strings.Contains(v.result, "message") {
+					t.Error(go_testing.Errorf(go_testing.Error{
+						Unexpected: v.name,
+						Desc:       d.desc,
+						At:         i,
+						Input:      d.input,
+						Expected:   e,
+						Result:     v.result,
+					}))
+				}
+			}
+		}
+	}
+}
+
+func TestFanOutSink(t *testing.T) {
+	var buf bytes.Buffer
+	var data = []struct {
+		desc     string
+		input    []Sink
+		expected bool
+	}{
+		{
+			desc: "success",
+			input: []Sink{
+				NewWriterSink(&buf, SeverityDebug, nil),
+			},
+			expected: false,
+		},
+
+		{
+			desc: "failure does not stop other sinks",
+			input: []Sink{
+				NewWriterSink(failingWriter{}, SeverityDebug, nil),
+				NewWriterSink(&buf, SeverityDebug, nil),
+			},
+			expected: true,
+		},
+
+		{
+			desc: "disabled sinks are not written",
+			input: []Sink{
+				NewWriterSink(failingWriter{}, SeverityError, nil),
+				NewWriterSink(&buf, SeverityDebug, nil),
+			},
+			expected: false,
+		},
+	}
+
+	for i, d := range data {
+		buf.Reset()
+		err := NewFanOutSink(d.input...).Write(Entry{
+			Severity: SeverityInfo,
+			Message:  "message",
+		})
+
+		if (err != nil) != d.expected {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "err",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   d.expected,
+				Result:     err,
+			}))
+		}
+		if !strings.Contains(buf.String(), "message") {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "buf",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   "message",
+				Result:     buf.String(),
+			}))
+		}
+	}
+}
+
+func TestStdSink(t *testing.T) {
+	type expected struct {
+		Stdout string
+		Stderr string
+	}
+	var data = []struct {
+		desc     string
+		input    Severity
+		expected expected
+	}{
+		{
+			desc:  "info to stdout coloured",
+			input: SeverityInfo,
+			expected: expected{
+				Stdout: "\x1b[",
+			},
+		},
+
+		{
+			desc:  "warn to stderr uncoloured",
+			input: SeverityWarn,
+			expected: expected{
+				Stderr: "WARN  message",
+			},
+		},
+	}
+
+	for i, d := range data {
+		var stdout, stderr bytes.Buffer
+		sink := newStdSink(&stdout, &stderr, NewConsoleEncoderFor(&stdout, ConsoleConfig{Color: ColorAlways}), NewConsoleEncoderFor(&stderr, ConsoleConfig{Color: ColorNever}))
+		if err := sink.Write(Entry{Severity: d.input, Message: "message"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(stdout.String(), d.expected.Stdout) || !strings.Contains(stderr.String(), d.expected.Stderr) ||
+			(d.expected.Stdout == "") != (stdout.Len() == 0) || (d.expected.Stderr == "") != (stderr.Len() == 0) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     expected{Stdout: stdout.String(), Stderr: stderr.String()},
+			}))
+		}
+	}
+}
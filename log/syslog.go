@@ -0,0 +1,155 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	go_errors "github.com/caigwatkin/go/errors"
+)
+
+type SyslogConfig struct {
+	Network  string        // One of "udp" or "tcp"
+	Address  string        // Host and port of the collector
+	AppName  string        // Defaults to "-"
+	Hostname string        // Defaults to the OS hostname
+	Facility int           // Defaults to 1, user-level messages
+	Timeout  time.Duration // For dialing and writing, defaults to 5s
+}
+
+// NewSyslogSink writing entries of at least the given severity to a syslog collector as RFC 5424 messages
+//
+// Messages are sent as datagrams over UDP, and with octet counting framing over TCP
+// Entries are encoded with the encoder, or the JSON encoder if nil
+func NewSyslogSink(config SyslogConfig, level Severity, encoder Encoder) (Sink, error) {
+	if config.Network != "udp" && config.Network != "tcp" {
+		return nil, go_errors.Errorf("Unsupported network %q", config.Network)
+	}
+	if config.Address == "" {
+		return nil, go_errors.New("Missing address")
+	}
+	if config.AppName == "" {
+		config.AppName = "-"
+	}
+	if config.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = "-"
+		}
+		config.Hostname = hostname
+	}
+	if config.Facility == 0 {
+		config.Facility = 1
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if encoder == nil {
+		encoder = NewJSONEncoder("", nil)
+	}
+	s := &syslogSink{
+		config:  config,
+		encoder: encoder,
+		level:   level,
+	}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type syslogSink struct {
+	config  SyslogConfig
+	conn    net.Conn
+	encoder Encoder
+	level   Severity
+	mu      sync.Mutex
+}
+
+var syslogSeverities = map[Severity]int{
+	SeverityDebug:  7,
+	SeverityInfo:   6,
+	SeverityNotice: 5,
+	SeverityWarn:   4,
+	SeverityError:  3,
+	SeverityFatal:  2,
+}
+
+func (s *syslogSink) Enabled(severity Severity) bool {
+	return severity >= s.level
+}
+
+// Write the entry, redialling once if a TCP connection has been lost
+func (s *syslogSink) Write(e Entry) error {
+	message := s.format(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.write(message)
+	if err != nil && s.config.Network == "tcp" {
+		s.conn.Close()
+		if err = s.dial(); err == nil {
+			err = s.write(message)
+		}
+	}
+	if err != nil {
+		return go_errors.Wrap(err, "Failed writing to syslog")
+	}
+	return nil
+}
+
+// Close the connection
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+func (s *syslogSink) dial() error {
+	conn, err := net.DialTimeout(s.config.Network, s.config.Address, s.config.Timeout)
+	if err != nil {
+		return go_errors.Wrap(err, "Failed dialing syslog")
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslogSink) write(message string) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.config.Timeout)); err != nil {
+		return err
+	}
+	if s.config.Network == "tcp" {
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+	_, err := s.conn.Write([]byte(message))
+	return err
+}
+
+// format as "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG"
+func (s *syslogSink) format(e Entry) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		s.config.Facility*8+syslogSeverities[e.Severity],
+		e.Time.UTC().Format(time.RFC3339Nano),
+		s.config.Hostname,
+		s.config.AppName,
+		os.Getpid(),
+		e.encoded(s.encoder.Encode(e)),
+	)
+}
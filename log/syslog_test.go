@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Cai Gwatkin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	go_testing "github.com/caigwatkin/go/testing"
+)
+
+func TestSyslogSink(t *testing.T) {
+	var data = []struct {
+		desc     string
+		input    string
+		listen   func(t *testing.T) (string, <-chan string)
+		expected string
+	}{
+		{
+			desc:     "udp",
+			input:    "udp",
+			listen:   listenUDP,
+			expected: "<12>1 2021-09-01T12:00:00Z host app ",
+		},
+
+		{
+			desc:     "tcp",
+			input:    "tcp",
+			listen:   listenTCP,
+			expected: "<12>1 2021-09-01T12:00:00Z host app ",
+		},
+	}
+
+	for i, d := range data {
+		address, received := d.listen(t)
+		sink, err := NewSyslogSink(SyslogConfig{
+			Network:  d.input,
+			Address:  address,
+			AppName:  "app",
+			Hostname: "host",
+		}, SeverityInfo, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sink.Enabled(SeverityDebug) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "sink.Enabled(SeverityDebug)",
+				Desc:       d.desc,
+				At:         i,
+				Expected:   false,
+				Result:     true,
+			}))
+		}
+		if err := sink.Write(Entry{
+			Time:     time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC),
+			Severity: SeverityWarn,
+			Message:  "message",
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		var result string
+		select {
+		case result = <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for syslog message")
+		}
+
+		if !strings.HasPrefix(result, d.expected) || !strings.HasSuffix(result, `"jsonPayload":{}}`) {
+			t.Error(go_testing.Errorf(go_testing.Error{
+				Unexpected: "result",
+				Desc:       d.desc,
+				At:         i,
+				Input:      d.input,
+				Expected:   d.expected,
+				Result:     result,
+			}))
+		}
+		sink.(io.Closer).Close()
+	}
+}
+
+func listenUDP(t *testing.T) (string, <-chan string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	received := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 65536)
+		n, _, err := conn.ReadFrom(buf)
+		if err == nil {
+			received <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), received
+}
+
+func listenTCP(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		length, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			return
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return
+		}
+		received <- fmt.Sprintf("%s", buf)
+	}()
+	return l.Addr().String(), received
+}
@@ -20,6 +20,7 @@ type Config struct {
 }
 
 func NewClient(ctx context.Context, config Config, logClient go_log.Client, schemaFileNames []string) (Client, error) {
+	logClient = logClient.Named("schema")
 	logClient.Info(ctx, "Initializing", go_log.FmtAny(config, "config"), go_log.FmtStrings(schemaFileNames, "schemaFileNames"))
 
 	type schemaAndFileNameAndError struct {
@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 
 	"cloud.google.com/go/storage"
+	go_environment "github.com/caigwatkin/go/environment"
 	go_errors "github.com/caigwatkin/go/errors"
 	go_log "github.com/caigwatkin/go/log"
 	cloudkms "google.golang.org/api/cloudkms/v1"
@@ -40,7 +41,7 @@ type Client interface {
 }
 
 type Config struct {
-	Env             string
+	Stage           go_environment.Stage
 	GcpProjectId    string
 	CloudkmsKeyRing string
 	CloudkmsKey     string
@@ -48,8 +49,12 @@ type Config struct {
 
 // NewClient returns an implementation of the client interface that allows secret management
 func NewClient(ctx context.Context, config Config, logClient go_log.Client) (Client, error) {
+	logClient = logClient.Named("secrets")
 	logClient.Info(ctx, "Initializing", go_log.FmtAny(config, "config"))
 
+	if err := config.Stage.Validate(); err != nil {
+		return nil, go_errors.Wrap(err, "Failed validating stage")
+	}
 	cloudkmsService, err := cloudkms.NewService(ctx)
 	if err != nil {
 		return nil, go_errors.Wrap(err, "Failed initializing cloudkms service")
@@ -62,9 +67,9 @@ func NewClient(ctx context.Context, config Config, logClient go_log.Client) (Cli
 	logClient.Info(ctx, "Initialized")
 	return client{
 		cloudkmsService: cloudkmsService,
-		env:             config.Env,
 		cryptoKey:       fmt.Sprintf("projects/%s/locations/global/keyRings/%s/cryptoKeys/%s", config.GcpProjectId, config.CloudkmsKeyRing, config.CloudkmsKey),
 		secrets:         make(map[string][]byte),
+		stage:           config.Stage,
 		storageClient:   storageClient,
 	}, nil
 }
@@ -72,9 +77,9 @@ func NewClient(ctx context.Context, config Config, logClient go_log.Client) (Cli
 // Required secrets map, where the key is the domain of the secret and the values are the types of secrets
 //
 // This should map to the naming scheme of the encrypted secret file, e.g.:
-//   - Secret file naming should be "secret_domain-secret_type-cloudkms_env.json"
+//   - Secret file naming should be "secret_domain-secret_type-cloudkms_stage.json"
 //   - If a required secret is from some api, it is a key, the domain is "some_api" and the type "key"
-//   - If the file was encrypted using cloudkms in a "dev" env, the file name is "some_api-key-cloudkms_dev.json"
+//   - If the file was encrypted using cloudkms for the "dev" stage, the file name is "some_api-key-cloudkms_dev.json"
 type Required map[string][]string
 
 // ReduceRequired secrets into one set
@@ -112,8 +117,8 @@ func reduceRequiredTypes(reduced, new []string) []string {
 type client struct {
 	cloudkmsService *cloudkms.Service
 	cryptoKey       string
-	env             string
 	secrets         map[string][]byte
+	stage           go_environment.Stage
 	storageClient   *storage.Client
 }
 
@@ -195,9 +200,9 @@ func (c client) DownloadAndDecryptAndCache(ctx context.Context, bucket, dir stri
 func (c client) download(ctx context.Context, bucket *storage.BucketHandle, dir, domain, kind string) (*Secret, error) {
 	var file string
 	if dir != "" {
-		file = fmt.Sprintf("%s/%s-%s-cloudkms_%s.json", dir, domain, kind, c.env)
+		file = fmt.Sprintf("%s/%s-%s-cloudkms_%s.json", dir, domain, kind, c.stage)
 	} else {
-		file = fmt.Sprintf("%s-%s-cloudkms_%s.json", domain, kind, c.env)
+		file = fmt.Sprintf("%s-%s-cloudkms_%s.json", domain, kind, c.stage)
 	}
 	fileObject := bucket.Object(file)
 	reader, err := fileObject.NewReader(ctx)